@@ -0,0 +1,375 @@
+// Package config
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/filewatcher"
+	"gopkg.in/yaml.v3"
+)
+
+// Log levels that can be used in a config file.
+const (
+	LevelQuiet   = "quiet"
+	LevelNormal  = "normal"
+	LevelVerbose = "verbose"
+	LevelDev     = "dev"
+)
+
+// Config is the contents of a mimic config file. JSON files are read the same way as YAML.
+type Config struct {
+	Pairs    []Pair                   `yaml:"pairs"`
+	Ignore   []string                 `yaml:"ignore"`
+	Include  []string                 `yaml:"include"`
+	Backend  string                   `yaml:"backend"`
+	Interval time.Duration            `yaml:"interval"`
+	Debounce time.Duration            `yaml:"debounce"`
+	LogLevel string                   `yaml:"log_level"`
+	Color    bool                     `yaml:"color"`
+	Delete   filewatcher.DeletePolicy `yaml:"delete"`
+	Compare  filehandler.Compare      `yaml:"compare"`
+	InPlace  bool                     `yaml:"in_place"`
+	// Bidirectional mirrors every pair both ways, with Conflict deciding what happens when a
+	// path changed on both sides.
+	Bidirectional bool                       `yaml:"bidirectional"`
+	Conflict      filewatcher.ConflictPolicy `yaml:"conflict"`
+	Symlinks      filewatcher.SymlinkPolicy  `yaml:"symlinks"`
+	Preserve      []string                   `yaml:"preserve"`
+	HardLinks     bool                       `yaml:"hard_links"`
+	ProgressSize  string                     `yaml:"progress_size"`
+	Delta         bool                       `yaml:"delta"`
+	StateDir      string                     `yaml:"state_dir"`
+	Retries       int                        `yaml:"retries"`
+	DrainTimeout  time.Duration              `yaml:"drain_timeout"`
+	FailFast      bool                       `yaml:"fail_fast"`
+	Control       string                     `yaml:"control"`
+	Prune         Prune                      `yaml:"prune"`
+	Hooks         Hooks                      `yaml:"hooks"`
+}
+
+// Pair is a source directory and the destinations it is mirrored into. Ignore and include
+// patterns are added to the global ones, Delete, Compare, Conflict, Symlinks and Preserve
+// override the global ones.
+// A pair is mirrored both ways when it, or the config, is bidirectional.
+type Pair struct {
+	Source        string                     `yaml:"source"`
+	Destination   string                     `yaml:"destination"`
+	Destinations  []string                   `yaml:"destinations"`
+	Ignore        []string                   `yaml:"ignore"`
+	Include       []string                   `yaml:"include"`
+	Delete        filewatcher.DeletePolicy   `yaml:"delete"`
+	Compare       filehandler.Compare        `yaml:"compare"`
+	Bidirectional bool                       `yaml:"bidirectional"`
+	Conflict      filewatcher.ConflictPolicy `yaml:"conflict"`
+	Symlinks      filewatcher.SymlinkPolicy  `yaml:"symlinks"`
+	Preserve      []string                   `yaml:"preserve"`
+}
+
+// Prune reconciles the destinations with their sources on startup.
+type Prune struct {
+	Enabled   bool    `yaml:"enabled"`
+	DryRun    bool    `yaml:"dry_run"`
+	Trash     string  `yaml:"trash"`
+	Threshold float64 `yaml:"threshold"`
+}
+
+// Hooks are the shell commands run after the destination changes.
+type Hooks struct {
+	AfterSync   string `yaml:"after_sync"`
+	AfterChange string `yaml:"after_change"`
+}
+
+// Error is a problem found in a config file.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ErrorList is every problem found in a config file.
+type ErrorList []*Error
+
+func (el ErrorList) Error() string {
+	msgs := make([]string, len(el))
+	for i, e := range el {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// lineError matches the 'line N: message' form used in the yaml errors.
+var lineError = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// ErrUnsupportedFormat is returned for config files in a format mimic can't read, which is
+// anything but YAML and JSON.
+var ErrUnsupportedFormat = errors.New("unsupported config format, use YAML or JSON")
+
+// unsupported are the extensions of config formats that aren't read, rather than being mistaken
+// for broken YAML.
+var unsupported = map[string]bool{".toml": true, ".ini": true, ".hcl": true}
+
+// Load reads and validates the config file at the given path.
+func Load(path string) (*Config, error) {
+	if unsupported[strings.ToLower(filepath.Ext(path))] {
+		return nil, fmt.Errorf("'%v': %w", path, ErrUnsupportedFormat)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse decodes and validates a config. Any problems are returned as an ErrorList.
+func Parse(b []byte) (*Config, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, toErrorList(err)
+	}
+
+	cfg := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, toErrorList(err)
+	}
+
+	if errs := cfg.validate(&root); len(errs) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+// toErrorList splits a yaml error into its separate lines.
+func toErrorList(err error) ErrorList {
+	var msgs []string
+	if te, ok := err.(*yaml.TypeError); ok {
+		msgs = te.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+
+	var errs ErrorList
+	for _, msg := range msgs {
+		e := &Error{Msg: msg}
+		if m := lineError.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Msg = m[2]
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// validate checks the values that decode fine but don't make sense to mimic.
+func (c *Config) validate(root *yaml.Node) ErrorList {
+	var errs ErrorList
+	add := func(msg string, path ...string) {
+		errs = append(errs, &Error{Line: lineOf(root, path...), Msg: msg})
+	}
+
+	if !validDelete(c.Delete) {
+		add(fmt.Sprintf("unknown delete policy '%v'", c.Delete), "delete")
+	}
+	switch c.LogLevel {
+	case "", LevelQuiet, LevelNormal, LevelVerbose, LevelDev:
+	default:
+		add(fmt.Sprintf("unknown log level '%v'", c.LogLevel), "log_level")
+	}
+	switch c.Backend {
+	case "", filewatcher.BackendInotify, filewatcher.BackendPoll:
+	default:
+		add(fmt.Sprintf("unknown backend '%v'", c.Backend), "backend")
+	}
+	if _, err := filehandler.ParseCompare(string(c.Compare)); err != nil {
+		add(err.Error(), "compare")
+	}
+	if _, err := filewatcher.ParseConflict(string(c.Conflict)); err != nil {
+		add(err.Error(), "conflict")
+	}
+	if _, err := filewatcher.ParseSymlinks(string(c.Symlinks)); err != nil {
+		add(err.Error(), "symlinks")
+	}
+	if _, err := filehandler.ParsePreserve(c.Preserve...); err != nil {
+		add(err.Error(), "preserve")
+	}
+	if _, err := filehandler.ParseSize(c.ProgressSize); err != nil {
+		add(err.Error(), "progress_size")
+	}
+	if c.Prune.Threshold < 0 || c.Prune.Threshold > 100 {
+		add("prune threshold has to be a percentage between 0 and 100", "prune", "threshold")
+	}
+	if c.DrainTimeout < 0 {
+		add("drain timeout can't be negative", "drain_timeout")
+	}
+	if c.Interval < 0 {
+		add("interval can't be negative", "interval")
+	}
+
+	for i, p := range c.Pairs {
+		index := strconv.Itoa(i)
+		if p.Source == "" {
+			add("pair is missing a source", "pairs", index)
+		}
+		if p.Destination == "" && len(p.Destinations) == 0 {
+			add("pair is missing a destination", "pairs", index)
+		}
+		if p.Destination != "" {
+			if _, err := destination.Parse(p.Destination); err != nil {
+				add(err.Error(), "pairs", index, "destination")
+			}
+		}
+		for j, des := range p.Destinations {
+			if des == "" {
+				add("destination can't be empty", "pairs", index, "destinations", strconv.Itoa(j))
+			} else if _, err := destination.Parse(des); err != nil {
+				add(err.Error(), "pairs", index, "destinations", strconv.Itoa(j))
+			}
+		}
+		if !validDelete(p.Delete) {
+			add(fmt.Sprintf("unknown delete policy '%v'", p.Delete), "pairs", index, "delete")
+		}
+		if _, err := filehandler.ParseCompare(string(p.Compare)); err != nil {
+			add(err.Error(), "pairs", index, "compare")
+		}
+		if _, err := filewatcher.ParseConflict(string(p.Conflict)); err != nil {
+			add(err.Error(), "pairs", index, "conflict")
+		}
+		if _, err := filewatcher.ParseSymlinks(string(p.Symlinks)); err != nil {
+			add(err.Error(), "pairs", index, "symlinks")
+		}
+		if _, err := filehandler.ParsePreserve(p.Preserve...); err != nil {
+			add(err.Error(), "pairs", index, "preserve")
+		}
+		count := len(p.Destinations)
+		if p.Destination != "" {
+			count++
+		}
+		if (c.Bidirectional || p.Bidirectional) && count > 1 {
+			add("a bidirectional pair can only have one destination", "pairs", index)
+		}
+	}
+	return errs
+}
+
+func validDelete(d filewatcher.DeletePolicy) bool {
+	return d == "" || d == filewatcher.DeleteMirror || d == filewatcher.DeleteKeep
+}
+
+// lineOf finds the line of the value at the given path of mapping keys and sequence indexes.
+// If the path doesn't exist the line of the closest parent is used.
+func lineOf(n *yaml.Node, path ...string) int {
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	for _, key := range path {
+		var next *yaml.Node
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == key {
+					next = n.Content[i+1]
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i < len(n.Content) {
+				next = n.Content[i]
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n.Line
+}
+
+// WatchPairs returns one filewatcher pair for every source and destination in the config, with the
+// global settings applied.
+func (c *Config) WatchPairs() []filewatcher.Pair {
+	var pairs []filewatcher.Pair
+	progress, _ := filehandler.ParseSize(c.ProgressSize)
+	for _, p := range c.Pairs {
+		dess := p.Destinations
+		if p.Destination != "" {
+			dess = append([]string{p.Destination}, dess...)
+		}
+		policy := c.Delete
+		if p.Delete != "" {
+			policy = p.Delete
+		}
+		cmp := c.Compare
+		if p.Compare != "" {
+			cmp = p.Compare
+		}
+		conflict := c.Conflict
+		if p.Conflict != "" {
+			conflict = p.Conflict
+		}
+		links := c.Symlinks
+		if p.Symlinks != "" {
+			links = p.Symlinks
+		}
+		preserve := c.Preserve
+		if len(p.Preserve) != 0 {
+			preserve = p.Preserve
+		}
+		meta, _ := filehandler.ParsePreserve(preserve...)
+		for _, des := range dess {
+			pairs = append(pairs, filewatcher.Pair{
+				Source:        p.Source,
+				Destination:   des,
+				Ignore:        append(append([]string{}, c.Ignore...), p.Ignore...),
+				Include:       append(append([]string{}, c.Include...), p.Include...),
+				Backend:       c.Backend,
+				Interval:      c.Interval,
+				Debounce:      c.Debounce,
+				Delete:        policy,
+				Compare:       cmp,
+				InPlace:       c.InPlace,
+				Bidirectional: c.Bidirectional || p.Bidirectional,
+				Conflict:      conflict,
+				Symlinks:      links,
+				Preserve:      meta,
+				HardLinks:     c.HardLinks,
+				ProgressSize:  progress,
+				Delta:         c.Delta,
+				StateDir:      c.StateDir,
+				Retries:       c.Retries,
+				FailFast:      c.FailFast,
+				Prune: filewatcher.Prune{
+					Enabled:   c.Prune.Enabled,
+					DryRun:    c.Prune.DryRun,
+					Trash:     c.Prune.Trash,
+					Threshold: c.Prune.Threshold,
+				},
+				Hooks: filewatcher.Hooks{
+					AfterSync:   c.Hooks.AfterSync,
+					AfterChange: c.Hooks.AfterChange,
+				},
+			})
+		}
+	}
+	return pairs
+}
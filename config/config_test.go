@@ -0,0 +1,206 @@
+// Package config
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/filewatcher"
+)
+
+const testConfig = `pairs:
+  - source: assets
+    destinations: [public/assets, backup/assets]
+  - source: fonts
+    destination: public/fonts
+    ignore: ["*.tmp"]
+    delete: keep
+    compare: hash
+    bidirectional: true
+    conflict: keep-both
+    symlinks: skip
+    preserve: [xattrs, acls]
+ignore: ["*.swp", "build/"]
+include: ["build/keep.txt"]
+backend: poll
+interval: 250ms
+debounce: 50ms
+log_level: verbose
+color: true
+delete: mirror
+compare: always
+in_place: true
+conflict: source
+symlinks: rewrite
+preserve: [times, owner]
+hard_links: true
+progress_size: 100MB
+delta: true
+retries: 3
+drain_timeout: 5s
+fail_fast: true
+control: mimic.sock
+prune:
+  enabled: true
+  trash: .trash
+  threshold: 25
+hooks:
+  after_sync: echo synced
+`
+
+func TestLoad(t *testing.T) {
+	file := "test.yaml"
+	ioutil.WriteFile(file, []byte(testConfig), 0644)
+	defer os.Remove(file)
+
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	if cfg.Interval != 250*time.Millisecond {
+		t.Errorf("Expected interval of 250ms got %v", cfg.Interval)
+	}
+	if cfg.Backend != filewatcher.BackendPoll {
+		t.Errorf("Expected backend '%v' got '%v'", filewatcher.BackendPoll, cfg.Backend)
+	}
+	if cfg.Debounce != 50*time.Millisecond {
+		t.Errorf("Expected debounce of 50ms got %v", cfg.Debounce)
+	}
+	if cfg.LogLevel != LevelVerbose {
+		t.Errorf("Expected log level '%v' got '%v'", LevelVerbose, cfg.LogLevel)
+	}
+	if !cfg.Color {
+		t.Errorf("Expected color to be set.")
+	}
+	if cfg.DrainTimeout != 5*time.Second {
+		t.Errorf("Expected a drain timeout of 5s got %v", cfg.DrainTimeout)
+	}
+	if cfg.Control != "mimic.sock" {
+		t.Errorf("Expected the control socket 'mimic.sock' got '%v'", cfg.Control)
+	}
+	if !cfg.InPlace {
+		t.Errorf("Expected in place copies to be set.")
+	}
+
+	pairs := cfg.WatchPairs()
+	if len(pairs) != 3 {
+		t.Fatalf("Expected 3 pairs got %v", len(pairs))
+	}
+	if pairs[1].String() != "assets:backup/assets" {
+		t.Errorf("Expected 'assets:backup/assets' got '%v'", pairs[1])
+	}
+	if pairs[0].Delete != filewatcher.DeleteMirror || pairs[2].Delete != filewatcher.DeleteKeep {
+		t.Errorf("Delete policies were not applied, got '%v' and '%v'", pairs[0].Delete, pairs[2].Delete)
+	}
+	if pairs[0].Compare != filehandler.CompareAlways || pairs[2].Compare != filehandler.CompareHash {
+		t.Errorf("Comparisons were not applied, got '%v' and '%v'", pairs[0].Compare, pairs[2].Compare)
+	}
+	if len(pairs[2].Ignore) != 3 {
+		t.Errorf("Expected the global and pair ignore patterns got %v", pairs[2].Ignore)
+	}
+	if len(pairs[0].Include) != 1 {
+		t.Errorf("Expected the global include patterns got %v", pairs[0].Include)
+	}
+	if !pairs[1].Prune.Enabled || pairs[1].Prune.Trash != ".trash" || pairs[1].Prune.Threshold != 25 {
+		t.Errorf("Prune settings were not applied, got %+v", pairs[1].Prune)
+	}
+	if !pairs[0].InPlace {
+		t.Errorf("In place copies were not applied to the pairs.")
+	}
+	if pairs[0].Bidirectional || !pairs[2].Bidirectional {
+		t.Errorf("Expected only the fonts pair to be bidirectional.")
+	}
+	if pairs[0].Conflict != filewatcher.ConflictSource || pairs[2].Conflict != filewatcher.ConflictKeepBoth {
+		t.Errorf("Conflict policies were not applied, got '%v' and '%v'", pairs[0].Conflict, pairs[2].Conflict)
+	}
+	if pairs[0].Symlinks != filewatcher.SymlinkRewrite || pairs[2].Symlinks != filewatcher.SymlinkSkip {
+		t.Errorf("Symlink policies were not applied, got '%v' and '%v'", pairs[0].Symlinks, pairs[2].Symlinks)
+	}
+	if p := pairs[0].Preserve; !p.Times || !p.Owner || p.Xattrs {
+		t.Errorf("Expected times and owners to be preserved got '%v'", p)
+	}
+	if p := pairs[2].Preserve; p.Times || !p.Xattrs || !p.ACLs {
+		t.Errorf("Expected the pair's metadata to be preserved instead got '%v'", p)
+	}
+	if !pairs[0].HardLinks || !pairs[2].HardLinks {
+		t.Errorf("Hard links were not applied to the pairs.")
+	}
+	if !pairs[0].Delta || !pairs[2].Delta {
+		t.Errorf("Delta updates were not applied to the pairs.")
+	}
+	if pairs[0].ProgressSize != 100<<20 {
+		t.Errorf("Expected progress to be logged from 100MB got %v", pairs[0].ProgressSize)
+	}
+	if pairs[0].Retries != 3 || !pairs[0].FailFast {
+		t.Errorf("Retry settings were not applied, got %v and %v", pairs[0].Retries, pairs[0].FailFast)
+	}
+	if pairs[0].Hooks.AfterSync != "echo synced" {
+		t.Errorf("Hooks were not applied.")
+	}
+}
+
+func TestLoadUnsupported(t *testing.T) {
+	file := "test.toml"
+	ioutil.WriteFile(file, []byte("backend = \"poll\"\n"), 0644)
+	defer os.Remove(file)
+
+	if _, err := Load(file); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected '%v' loading a TOML file got '%v'", ErrUnsupportedFormat, err)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	cfg, err := Parse([]byte(`{"pairs": [{"source": "src", "destination": "des"}], "log_level": "quiet"}`))
+	if err != nil {
+		t.Fatalf("Error parsing JSON config: %v", err)
+	}
+	if len(cfg.WatchPairs()) != 1 || cfg.LogLevel != LevelQuiet {
+		t.Errorf("JSON config was not parsed correctly.")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]int{
+		"pairs:\n  - source: src\n    destination: des\nunknown: true\n":     4,
+		"pairs:\n  - source: src\n    destination: des\ninterval: often\n":   4,
+		"pairs:\n  - source: src\n  - destination: des\n":                    2,
+		"pairs:\n  - source: src\n    destination: des\n    delete: maybe\n": 4,
+		"pairs:\n  - source: src\n    destination: gopher://host/des\n":      3,
+		"backend: fanotify\n": 1,
+		"log_level: loud\n":   1,
+		"compare: vibes\n":    1,
+		"conflict: mine\n":    1,
+		"symlinks: dangle\n":  1,
+		"preserve: [uid]\n":   1,
+		"bidirectional: true\npairs:\n  - source: src\n    destinations: [a, b]\n": 3,
+		"drain_timeout: -1s\n":       1,
+		"progress_size: lots\n":      1,
+		"prune:\n  threshold: 150\n": 2,
+		"pairs:\n  - source: [\n":    2,
+	}
+
+	for config, line := range tests {
+		_, err := Parse([]byte(config))
+		if err == nil {
+			t.Errorf("Expected an error parsing:\n%v", config)
+			continue
+		}
+		errs, ok := err.(ErrorList)
+		if !ok || len(errs) == 0 {
+			t.Errorf("Expected an ErrorList got %T: %v", err, err)
+			continue
+		}
+		if errs[0].Line != line {
+			t.Errorf("Expected an error on line %v got '%v' parsing:\n%v", line, errs[0], config)
+		}
+	}
+}
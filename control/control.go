@@ -0,0 +1,130 @@
+// Package control
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package control
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeout is how long a client has to send its command and read the reply.
+const timeout = time.Minute
+
+// Handler answers a command, args are the words that followed the command.
+type Handler func(args []string) (string, error)
+
+// Server answers commands sent to a unix socket. Every connection sends a single line with a
+// command and its arguments, and gets back 'ok' or 'error' followed by the reply.
+type Server struct {
+	ln       net.Listener
+	handlers map[string]Handler
+	wg       sync.WaitGroup
+}
+
+// Listen creates the socket at the path. A socket left behind by a mimic that is no longer
+// running is replaced, but one that is still being listened on is an error.
+func Listen(path string, handlers map[string]Handler) (*Server, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("'%v' is already being listened on", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{ln: ln, handlers: handlers}, nil
+}
+
+// Serve answers commands until the server is closed.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(conn)
+		}()
+	}
+}
+
+// serve answers the command sent on the connection.
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		fmt.Fprintf(conn, "error\nno command\n")
+		return
+	}
+	handler, ok := s.handlers[words[0]]
+	if !ok {
+		fmt.Fprintf(conn, "error\nunknown command '%v'\n", words[0])
+		return
+	}
+	reply, err := handler(words[1:])
+	if err != nil {
+		fmt.Fprintf(conn, "error\n%v\n", err)
+		return
+	}
+	fmt.Fprintf(conn, "ok\n%v", reply)
+}
+
+// Close stops the server, waits for the commands being answered and removes the socket.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+// Send sends the command to the socket at the path and returns the reply.
+func Send(path string, command ...string) (string, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := fmt.Fprintf(conn, "%v\n", strings.Join(command, " ")); err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+
+	reply := string(b)
+	i := strings.Index(reply, "\n")
+	if i < 0 {
+		return "", fmt.Errorf("unexpected reply '%v'", reply)
+	}
+	status, reply := reply[:i], reply[i+1:]
+	if status != "ok" {
+		return "", errors.New(strings.TrimSpace(reply))
+	}
+	return reply, nil
+}
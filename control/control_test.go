@@ -0,0 +1,63 @@
+// Package control
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package control
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	path := "test.sock"
+	defer os.Remove(path)
+	s, err := Listen(path, map[string]Handler{
+		"echo": func(args []string) (string, error) {
+			return strings.Join(args, " ") + "\n", nil
+		},
+		"fail": func(args []string) (string, error) {
+			return "", errors.New("it failed")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error listening on '%v': %v", path, err)
+	}
+	go s.Serve()
+	defer s.Close()
+
+	if reply, err := Send(path, "echo", "hello", "there"); err != nil || reply != "hello there\n" {
+		t.Errorf("Expected 'hello there' got '%v': %v", reply, err)
+	}
+	if _, err := Send(path, "fail"); err == nil || err.Error() != "it failed" {
+		t.Errorf("Expected 'it failed' got %v", err)
+	}
+	if _, err := Send(path, "unknown"); err == nil {
+		t.Errorf("Expected an error sending an unknown command.")
+	}
+
+	if _, err := Listen(path, nil); err == nil {
+		t.Errorf("Expected an error listening on a socket that is in use.")
+	}
+}
+
+func TestListenStaleSocket(t *testing.T) {
+	path := "stale.sock"
+	defer os.Remove(path)
+	s, err := Listen(path, nil)
+	if err != nil {
+		t.Fatalf("Error listening on '%v': %v", path, err)
+	}
+	// leave the socket file behind as a crashed mimic would
+	s.ln.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	s.Close()
+
+	s, err = Listen(path, nil)
+	if err != nil {
+		t.Fatalf("Expected a stale socket to be replaced: %v", err)
+	}
+	s.Close()
+}
@@ -0,0 +1,870 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// defaultSettle is how long an archive waits for changes to stop before it's rebuilt.
+const defaultSettle = time.Second
+
+// archiveFormat is the kind of file an archive is written as.
+type archiveFormat string
+
+const (
+	formatTar   archiveFormat = "tar"
+	formatTarGz archiveFormat = "tar.gz"
+	formatZip   archiveFormat = "zip"
+)
+
+func init() {
+	registerPath("tar", func(u *url.URL, opts Options) (Destination, error) {
+		return OpenArchive(u, opts)
+	})
+	registerPath("zip", func(u *url.URL, opts Options) (Destination, error) {
+		return OpenArchive(u, opts)
+	})
+}
+
+// Archive mirrors into a single tar or zip file, which is rebuilt from the source once changes
+// have stopped for a while. Its URL is 'tar://out.tar', 'tar://out.tar.gz' or 'zip://out.zip',
+// where a tar archive whose name ends in '.gz' or '.tgz' is compressed, and the 'settle' query
+// parameter sets how long changes have to stop for.
+//
+// The archive keeps the modes, symlinks and modification times of the source, to the second, and
+// is written to a temporary file that is renamed over the old archive, so it's never read half
+// written. Files that haven't been copied since the archive was opened are carried over from the
+// old archive.
+type Archive struct {
+	path   string
+	format archiveFormat
+	settle time.Duration
+	log    logging.Logger
+	fs     vfs.FS
+	// owners keeps the owners of the source files in tar archives.
+	owners bool
+
+	mu      sync.Mutex
+	entries map[string]*archiveEntry
+	dirty   bool
+	closed  bool
+	timer   *time.Timer
+}
+
+// archiveEntry is a file, directory or symlink in an archive.
+type archiveEntry struct {
+	// src is the source path the entry is read from, it's empty for entries that are carried over
+	// from the old archive.
+	src string
+	// follow reads src through symlinks, for files that are copied rather than linked.
+	follow bool
+	// archived is the name of the entry in the old archive, which is where entries without a
+	// source are copied from.
+	archived string
+	// written is set once the archive holds the entry as it is described here.
+	written bool
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+	link    string
+	uid     int
+	gid     int
+	sum     []byte
+}
+
+// OpenArchive returns the archive at the URL's path as a destination, reading what's in it if it
+// already exists.
+func OpenArchive(u *url.URL, opts Options) (*Archive, error) {
+	a := &Archive{
+		path:    filepath.FromSlash(u.Path),
+		format:  formatZip,
+		settle:  defaultSettle,
+		log:     opts.Log,
+		fs:      opts.FS,
+		entries: make(map[string]*archiveEntry),
+	}
+	if u.Scheme == "tar" {
+		a.format = formatTar
+		if strings.HasSuffix(a.path, ".gz") || strings.HasSuffix(a.path, ".tgz") {
+			a.format = formatTarGz
+		}
+	}
+	// modification times are always kept, and tar archives can keep owners as well
+	can := filehandler.Preserve{Times: true, Owner: a.format != formatZip}
+	a.owners = preserved(opts, u.Scheme+"://"+u.Path, can).Owner
+	noDelta(opts, u.Scheme+"://"+u.Path)
+	if settle := u.Query().Get("settle"); settle != "" {
+		d, err := time.ParseDuration(settle)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("'%v' is not a valid settle duration", settle)
+		}
+		a.settle = d
+	}
+
+	a.log.Debug("Reading archive '%v'...", a.path)
+	err := a.read(func(name string, e *archiveEntry, r io.Reader) error {
+		if r != nil {
+			sum := sha256.New()
+			if _, err := io.Copy(sum, r); err != nil {
+				return err
+			}
+			e.sum = sum.Sum(nil)
+		}
+		e.written, e.archived = true, name
+		a.entries[name] = e
+		return nil
+	})
+	if os.IsNotExist(err) {
+		a.log.Debug("'%v' doesn't exist yet, it will be created.", a.path)
+		a.dirty = true
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive '%v': %v", a.path, err)
+	}
+	a.log.Debug("Done, %d entries read.", len(a.entries))
+	return a, nil
+}
+
+// Path returns where the archive is written.
+func (a *Archive) Path() string {
+	return a.path
+}
+
+// stat fills the entry in from the source path, only following symlinks if the entry does.
+func (a *Archive) stat(src string, e *archiveEntry) error {
+	lstat := a.fs.Lstat
+	if e.follow {
+		lstat = a.fs.Stat
+	}
+	info, err := lstat(src)
+	if err != nil {
+		return err
+	}
+	e.src = src
+	e.mode = info.Mode()
+	e.modTime = info.ModTime().Truncate(time.Second)
+	e.size, e.link = 0, ""
+	if a.owners {
+		e.uid, e.gid, _ = vfs.Owner(info)
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if e.link, err = a.fs.Readlink(src); err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		e.size = info.Size()
+	}
+	return nil
+}
+
+// add adds or replaces the entry at rel with what the source path points to.
+func (a *Archive) add(src, rel string, force bool) error {
+	return a.put(rel, &archiveEntry{src: src, follow: true}, force)
+}
+
+// put adds or replaces the entry at rel, filling it in from its source if it has one. The archive
+// only needs rebuilding when something about the entry changed, or force is set because its
+// contents did. The root has no entry of its own.
+func (a *Archive) put(rel string, e *archiveEntry, force bool) error {
+	if rel = path.Clean(rel); rel == "." {
+		return nil
+	}
+	if e.src != "" {
+		if err := a.stat(e.src, e); err != nil {
+			return err
+		}
+	}
+	// a link without a source is new every time, only what it points to tells if it changed
+	old, ok := a.entries[rel]
+	if ok && !force && old.written && old.mode == e.mode && old.link == e.link && old.uid == e.uid && old.gid == e.gid && (e.src == "" || old.modTime.Equal(e.modTime)) {
+		old.src, old.follow = e.src, e.follow
+		return nil
+	}
+	if e.src == "" {
+		a.log.Debug("Adding a link to '%v' to archive '%v' as '%v'.", e.link, a.path, rel)
+	} else {
+		a.log.Debug("Adding '%v' to archive '%v' as '%v'.", e.src, a.path, rel)
+	}
+	a.entries[rel] = e
+	a.schedule()
+	return nil
+}
+
+// addParents adds the directories above rel that aren't in the archive yet, with the modes of
+// the source directories above src.
+func (a *Archive) addParents(src, rel string) error {
+	for {
+		rel, src = path.Dir(rel), filepath.Dir(src)
+		if rel == "." || rel == "/" {
+			return nil
+		}
+		if _, ok := a.entries[rel]; ok {
+			continue
+		}
+		if err := a.add(src, rel, false); err != nil {
+			return err
+		}
+	}
+}
+
+// schedule marks the archive as out of date and (re)starts the wait for changes to settle.
+func (a *Archive) schedule() {
+	a.dirty = true
+	if a.closed {
+		return
+	}
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.settle, a.flush)
+		return
+	}
+	a.timer.Reset(a.settle)
+}
+
+// flush rebuilds the archive once changes have settled.
+func (a *Archive) flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	if err := a.rebuild(); err != nil {
+		a.log.Error("Error writing archive '%v': %v", a.path, err)
+	}
+}
+
+// CopyFile adds the source file to the archive at rel, what a symlink points to rather than the
+// link itself.
+func (a *Archive) CopyFile(src, rel string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.addParents(src, rel); err != nil {
+		return err
+	}
+	return a.add(src, rel, true)
+}
+
+// Symlink adds a symlink to target to the archive at rel.
+func (a *Archive) Symlink(target, rel string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e := &archiveEntry{mode: os.ModeSymlink | 0777, modTime: time.Now().Truncate(time.Second), link: target}
+	return a.put(rel, e, false)
+}
+
+// CopyDir adds the source directory, and the directories above it, to the archive at rel.
+func (a *Archive) CopyDir(src, rel string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.addParents(src, rel); err != nil {
+		return err
+	}
+	return a.add(src, rel, false)
+}
+
+// CopyTree adds the source directory and everything in it to the archive at rel, keeping any
+// symlinks in it as links.
+func (a *Archive) CopyTree(src, rel string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.addParents(src, rel); err != nil {
+		return err
+	}
+	return vfs.Walk(a.fs, src, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		sub, err := filepath.Rel(src, fp)
+		if err != nil {
+			return err
+		}
+		return a.put(path.Join(rel, filepath.ToSlash(sub)), &archiveEntry{src: fp}, !info.IsDir())
+	})
+}
+
+// children returns the entries under the directory rel.
+func (a *Archive) children(rel string) []string {
+	var names []string
+	for name := range a.entries {
+		if strings.HasPrefix(name, rel+"/") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Remove takes the file or empty directory at rel out of the archive.
+func (a *Archive) Remove(rel string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.entries[rel]; !ok {
+		return &os.PathError{Op: "remove", Path: rel, Err: os.ErrNotExist}
+	}
+	if len(a.children(rel)) > 0 {
+		return &os.PathError{Op: "remove", Path: rel, Err: errors.New("directory not empty")}
+	}
+	delete(a.entries, rel)
+	a.schedule()
+	return nil
+}
+
+// RemoveAll takes rel and everything in it out of the archive.
+func (a *Archive) RemoveAll(rel string) error {
+	if rel = path.Clean(rel); rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return filehandler.ErrOutsideRoot
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	names := a.children(rel)
+	if _, ok := a.entries[rel]; ok {
+		names = append(names, rel)
+	}
+	for _, name := range names {
+		delete(a.entries, name)
+	}
+	if len(names) > 0 {
+		a.schedule()
+	}
+	return nil
+}
+
+// Rename moves old, and everything in it, to new.
+func (a *Archive) Rename(old, new string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.entries[old]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: old, Err: os.ErrNotExist}
+	}
+	for _, name := range a.children(old) {
+		a.entries[new+strings.TrimPrefix(name, old)] = a.entries[name]
+		delete(a.entries, name)
+	}
+	delete(a.entries, old)
+	a.entries[new] = e
+	a.schedule()
+	return nil
+}
+
+// Chmod picks up the mode of the source file for the entry at rel.
+func (a *Archive) Chmod(src, rel string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.entries[rel]; !ok {
+		return &os.PathError{Op: "chmod", Path: rel, Err: os.ErrNotExist}
+	}
+	return a.add(src, rel, false)
+}
+
+// Differs checks if the entry at rel is out of date with the source file. Entries that haven't
+// been written yet always differ.
+func (a *Archive) Differs(src, rel string, cmp filehandler.Compare) (bool, error) {
+	if cmp == filehandler.CompareAlways {
+		return true, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old, ok := a.entries[rel]
+	if !ok || !old.written {
+		return true, nil
+	}
+	e := &archiveEntry{}
+	if err := a.stat(src, e); err != nil {
+		return false, err
+	}
+	if e.mode.IsDir() != old.mode.IsDir() || e.size != old.size || e.link != old.link {
+		return true, nil
+	}
+	if cmp != filehandler.CompareHash || !e.mode.IsRegular() {
+		return !e.modTime.Equal(old.modTime), nil
+	}
+	f, err := a.fs.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return false, err
+	}
+	return string(sum.Sum(nil)) != string(old.sum), nil
+}
+
+// Stat returns the info of the entry at rel.
+func (a *Archive) Stat(rel string) (os.FileInfo, error) {
+	if rel == "." || rel == "" {
+		return &fileInfo{name: ".", mode: os.ModeDir | 0755}, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.entries[rel]
+	if !ok {
+		return nil, &os.PathError{Op: "lstat", Path: rel, Err: os.ErrNotExist}
+	}
+	return &fileInfo{name: path.Base(rel), size: e.size, mode: e.mode, modTime: e.modTime}, nil
+}
+
+// Walk calls fn for every entry in the archive, in order.
+func (a *Archive) Walk(fn func(rel string, info os.FileInfo) error) error {
+	a.mu.Lock()
+	names := a.names()
+	infos := make([]os.FileInfo, len(names))
+	for i, name := range names {
+		e := a.entries[name]
+		infos[i] = &fileInfo{name: path.Base(name), size: e.size, mode: e.mode, modTime: e.modTime}
+	}
+	a.mu.Unlock()
+
+	for i, name := range names {
+		if err := fn(name, infos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// names returns the names of the entries sorted, which puts directories before the entries in
+// them.
+func (a *Archive) names() []string {
+	names := make([]string, 0, len(a.entries))
+	for name := range a.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close writes any changes that haven't been written yet.
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = true
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	return a.rebuild()
+}
+
+// rebuild writes every entry into a temporary file next to the archive and renames it over the
+// archive. Entries with a source are read from it, the others are copied out of the old archive.
+func (a *Archive) rebuild() (err error) {
+	if !a.dirty {
+		return nil
+	}
+	a.log.Debug("Rebuilding archive '%v'...", a.path)
+	old, err := a.source()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if old != nil {
+		defer old.Close()
+	}
+
+	if err := vfs.MkdirAll(a.fs, filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	f, err := vfs.TempFile(a.fs, filepath.Dir(a.path), "."+filepath.Base(a.path)+".mimic-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			a.fs.Remove(tmp)
+		}
+	}()
+
+	w := a.writer(f)
+	written := make(map[string]*archiveEntry)
+	for _, name := range a.names() {
+		e := a.entries[name]
+		if e.src != "" {
+			if err := a.stat(e.src, e); os.IsNotExist(err) {
+				a.log.Debug("'%v' is gone, leaving it out of the archive.", e.src)
+				delete(a.entries, name)
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		if err := a.write(w, old, name, e); os.IsNotExist(err) && e.src == "" {
+			a.log.Notice("'%v' is missing from the old archive, leaving it out.", name)
+			delete(a.entries, name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error adding '%v': %v", name, err)
+		}
+		written[name] = e
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = a.fs.Chmod(tmp, 0644); err != nil {
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+	a.log.Debug("Renaming '%v' to '%v'.", tmp, a.path)
+	if err = a.fs.Rename(tmp, a.path); err != nil {
+		return err
+	}
+
+	for name, e := range written {
+		e.written, e.archived = true, name
+	}
+	a.dirty = false
+	a.log.Info("Wrote archive '%v' with %d entries.", a.path, len(written))
+	return nil
+}
+
+// write adds a single entry to the new archive, hashing the contents of files on the way. Entries
+// without a source are copied from the old archive.
+func (a *Archive) write(w archiveWriter, old archiveSource, name string, e *archiveEntry) error {
+	if !e.mode.IsRegular() {
+		return w.add(name, e, nil)
+	}
+	var r io.ReadCloser
+	var err error
+	switch {
+	case e.src != "":
+		r, err = a.fs.Open(e.src)
+	case old != nil:
+		r, err = old.open(e.archived)
+	default:
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	sum := sha256.New()
+	if err := w.add(name, e, io.TeeReader(io.LimitReader(r, e.size), sum)); err != nil {
+		return err
+	}
+	e.sum = sum.Sum(nil)
+	return nil
+}
+
+// archiveWriter writes the entries of a new archive.
+type archiveWriter interface {
+	// add writes the entry, r holds the contents of files and is nil for everything else.
+	add(name string, e *archiveEntry, r io.Reader) error
+	Close() error
+}
+
+// writer returns a writer for the archive's format.
+func (a *Archive) writer(w io.Writer) archiveWriter {
+	if a.format == formatZip {
+		return &zipWriter{zip.NewWriter(w)}
+	}
+	t := &tarWriter{}
+	if a.format == formatTarGz {
+		t.gz = gzip.NewWriter(w)
+		w = t.gz
+	}
+	t.tw = tar.NewWriter(w)
+	return t
+}
+
+type tarWriter struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (t *tarWriter) add(name string, e *archiveEntry, r io.Reader) error {
+	hdr := &tar.Header{Name: name, Mode: int64(e.mode.Perm()), ModTime: e.modTime, Uid: e.uid, Gid: e.gid}
+	switch {
+	case e.mode.IsDir():
+		hdr.Typeflag, hdr.Name = tar.TypeDir, name+"/"
+	case e.mode&os.ModeSymlink != 0:
+		hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, e.link
+	default:
+		hdr.Typeflag, hdr.Size = tar.TypeReg, e.size
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+	// a file that shrank since it was looked at fails here instead of writing a broken archive
+	_, err := io.CopyN(t.tw, r, e.size)
+	return err
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if t.gz != nil {
+		return t.gz.Close()
+	}
+	return nil
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) add(name string, e *archiveEntry, r io.Reader) error {
+	hdr := &zip.FileHeader{Name: name, Method: zip.Store, Modified: e.modTime}
+	hdr.SetMode(e.mode)
+	switch {
+	case e.mode.IsDir():
+		hdr.Name = name + "/"
+	case e.mode&os.ModeSymlink != 0:
+		r = strings.NewReader(e.link)
+	default:
+		hdr.Method = zip.Deflate
+	}
+	w, err := z.zw.CreateHeader(hdr)
+	if err != nil || r == nil {
+		return err
+	}
+	n, err := io.Copy(w, r)
+	if err == nil && e.mode.IsRegular() && n != e.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+// archiveSource opens the contents of files in the old archive.
+type archiveSource interface {
+	open(name string) (io.ReadCloser, error)
+	Close() error
+}
+
+// source opens the old archive to copy entries out of.
+func (a *Archive) source() (archiveSource, error) {
+	f, err := a.fs.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	if a.format == formatZip {
+		zr, err := openZip(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		files := make(map[string]*zip.File)
+		for _, zf := range zr.File {
+			files[cleanName(zf.Name)] = zf
+		}
+		return &zipSource{f: f, files: files}, nil
+	}
+	return &tarSource{a: a, f: f}, nil
+}
+
+type zipSource struct {
+	f     vfs.File
+	files map[string]*zip.File
+}
+
+func (z *zipSource) open(name string) (io.ReadCloser, error) {
+	zf, ok := z.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return zf.Open()
+}
+
+func (z *zipSource) Close() error {
+	return z.f.Close()
+}
+
+// tarSource reads through the old tar archive as entries are asked for. Entries are asked for in
+// the order mimic writes them, so an archive written by mimic is only read once.
+type tarSource struct {
+	a  *Archive
+	f  vfs.File
+	tr *tar.Reader
+}
+
+func (t *tarSource) open(name string) (io.ReadCloser, error) {
+	for restarted := t.tr == nil; ; {
+		if t.tr == nil {
+			if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			tr, err := t.a.tarReader(t.f)
+			if err != nil {
+				return nil, err
+			}
+			t.tr = tr
+		}
+		hdr, err := t.tr.Next()
+		if err == io.EOF {
+			t.tr = nil
+			if restarted {
+				return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+			}
+			restarted = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cleanName(hdr.Name) == name {
+			return ioutil.NopCloser(t.tr), nil
+		}
+	}
+}
+
+func (t *tarSource) Close() error {
+	return t.f.Close()
+}
+
+// tarReader returns a reader for the tar archive, decompressing it if needed.
+func (a *Archive) tarReader(f io.Reader) (*tar.Reader, error) {
+	if a.format == formatTarGz {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		f = gz
+	}
+	return tar.NewReader(f), nil
+}
+
+// read calls fn for every entry in the archive, with the contents of files.
+func (a *Archive) read(fn func(name string, e *archiveEntry, r io.Reader) error) error {
+	f, err := a.fs.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if a.format == formatZip {
+		zr, err := openZip(f)
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			if err := readZip(zf, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tr, err := a.tarReader(f)
+	if err != nil {
+		return err
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := cleanName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		info := hdr.FileInfo()
+		e := &archiveEntry{mode: info.Mode(), modTime: hdr.ModTime.Truncate(time.Second), link: hdr.Linkname, uid: hdr.Uid, gid: hdr.Gid}
+		var r io.Reader
+		if info.Mode().IsRegular() {
+			e.size, r = hdr.Size, tr
+		}
+		if err := fn(name, e, r); err != nil {
+			return err
+		}
+	}
+}
+
+// readZip hands a single entry of a zip archive to fn.
+func readZip(zf *zip.File, fn func(name string, e *archiveEntry, r io.Reader) error) error {
+	name := cleanName(zf.Name)
+	if name == "" {
+		return nil
+	}
+	e := &archiveEntry{mode: zf.Mode(), modTime: zf.Modified.Truncate(time.Second)}
+	if e.mode.IsDir() {
+		return fn(name, e, nil)
+	}
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if e.mode&os.ModeSymlink != 0 {
+		link, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		e.link = string(link)
+		return fn(name, e, nil)
+	}
+	e.size = int64(zf.UncompressedSize64)
+	return fn(name, e, r)
+}
+
+// openZip reads the directory of the zip archive in the file.
+func openZip(f vfs.File) (*zip.Reader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(readerAt{f}, info.Size())
+}
+
+// readerAt reads at an offset by seeking, for files that can't do it themselves.
+type readerAt struct {
+	f vfs.File
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := r.f.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.f, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// cleanName turns the name of an entry into a path relative to the root of the archive.
+func cleanName(name string) string {
+	name = path.Clean("/" + strings.TrimPrefix(name, "./"))
+	return strings.TrimPrefix(name, "/")
+}
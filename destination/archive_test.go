@@ -0,0 +1,273 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// listArchive returns every entry of the archive as 'name mode size mtime link|contents'.
+func listArchive(t *testing.T, fp string) []string {
+	f, err := os.Open(fp)
+	if err != nil {
+		t.Fatalf("Error opening archive: %v", err)
+	}
+	defer f.Close()
+	var entries []string
+	add := func(name string, mode os.FileMode, modTime time.Time, extra string) {
+		entries = append(entries, fmt.Sprintf("%v %v %v %v", name, mode, modTime.Unix(), extra))
+	}
+
+	if strings.HasSuffix(fp, ".zip") {
+		info, _ := f.Stat()
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			t.Fatalf("Error reading zip: %v", err)
+		}
+		for _, zf := range zr.File {
+			r, _ := zf.Open()
+			b, _ := ioutil.ReadAll(r)
+			r.Close()
+			add(zf.Name, zf.Mode(), zf.Modified, string(b))
+		}
+		return entries
+	}
+
+	var r io.Reader = f
+	if strings.HasSuffix(fp, ".gz") {
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatalf("Error reading gzip: %v", err)
+		}
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("Error reading tar: %v", err)
+		}
+		b, _ := ioutil.ReadAll(tr)
+		add(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime, hdr.Linkname+string(b))
+	}
+}
+
+func TestArchive(t *testing.T) {
+	for _, name := range []string{"out.tar.gz", "out.zip"} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "archive")
+			if err != nil {
+				t.Fatalf("Error creating temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			src := filepath.Join(dir, "src")
+			mtime := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+			os.MkdirAll(filepath.Join(src, "sub"), 0750)
+			ioutil.WriteFile(filepath.Join(src, "sub", "test.txt"), []byte("test"), 0640)
+			ioutil.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh"), 0755)
+			os.Symlink("sub/test.txt", filepath.Join(src, "link"))
+			for _, fp := range []string{"sub/test.txt", "run.sh", "sub", "."} {
+				os.Chtimes(filepath.Join(src, fp), mtime, mtime)
+			}
+
+			scheme := strings.TrimPrefix(filepath.Ext(name), ".")
+			if scheme == "gz" {
+				scheme = "tar"
+			}
+			fp := filepath.Join(dir, "archives", name)
+			u := scheme + "://" + fp + "?settle=1h"
+			des, err := Open(u, Options{})
+			if err != nil {
+				t.Fatalf("Error opening destination: %v", err)
+			}
+			if err := des.CopyTree(src, "."); err != nil {
+				t.Fatalf("Error copying tree: %v", err)
+			}
+			if _, err := os.Stat(fp); !os.IsNotExist(err) {
+				t.Errorf("Expected the archive to wait for changes to settle got %v", err)
+			}
+			if differs, _ := des.Differs(filepath.Join(src, "run.sh"), "run.sh", filehandler.CompareSize); !differs {
+				t.Errorf("Expected a file that isn't written yet to differ.")
+			}
+			if err := des.Close(); err != nil {
+				t.Fatalf("Error closing destination: %v", err)
+			}
+
+			entries := listArchive(t, fp)
+			expected := []string{
+				fmt.Sprintf("link %v %v sub/test.txt", os.ModeSymlink|0777, lmtime(t, filepath.Join(src, "link"))),
+				fmt.Sprintf("run.sh -rwxr-xr-x %v #!/bin/sh", mtime.Unix()),
+				fmt.Sprintf("sub/ drwxr-x--- %v ", mtime.Unix()),
+				fmt.Sprintf("sub/test.txt -rw-r----- %v test", mtime.Unix()),
+			}
+			if strings.Join(entries, "\n") != strings.Join(expected, "\n") {
+				t.Fatalf("Expected the archive to hold\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(entries, "\n"))
+			}
+
+			// reopening reads the archive back, files that aren't copied again are carried over
+			des, err = Open(u, Options{})
+			if err != nil {
+				t.Fatalf("Error reopening destination: %v", err)
+			}
+			for _, cmp := range []filehandler.Compare{filehandler.CompareSize, filehandler.CompareHash} {
+				if differs, err := des.Differs(filepath.Join(src, "sub", "test.txt"), "sub/test.txt", cmp); differs || err != nil {
+					t.Errorf("Expected the archived file not to differ by %v (%v)", cmp, err)
+				}
+			}
+			if info, err := des.Stat("sub"); err != nil || !info.IsDir() || info.Mode().Perm() != 0750 {
+				t.Errorf("Expected the archived directory got %v (%v)", info, err)
+			}
+			ioutil.WriteFile(filepath.Join(src, "new.txt"), []byte("new"), 0600)
+			des.CopyFile(filepath.Join(src, "new.txt"), "deeper/new.txt")
+			if err := des.Rename("sub", "moved"); err != nil {
+				t.Fatalf("Error renaming: %v", err)
+			}
+			if err := des.Remove("run.sh"); err != nil {
+				t.Fatalf("Error removing: %v", err)
+			}
+			if err := des.RemoveAll("."); err != filehandler.ErrOutsideRoot {
+				t.Errorf("Expected '%v' removing the root got '%v'", filehandler.ErrOutsideRoot, err)
+			}
+			var walked []string
+			des.Walk(func(rel string, info os.FileInfo) error {
+				walked = append(walked, rel)
+				return nil
+			})
+			if strings.Join(walked, ",") != "deeper,deeper/new.txt,link,moved,moved/test.txt" {
+				t.Errorf("Expected to walk the changed entries got %v", walked)
+			}
+			if err := des.Close(); err != nil {
+				t.Fatalf("Error closing destination: %v", err)
+			}
+
+			entries = listArchive(t, fp)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, strings.Fields(entry)[0])
+			}
+			if strings.Join(names, ",") != "deeper/,deeper/new.txt,link,moved/,moved/test.txt" {
+				t.Fatalf("Expected the archive to be rebuilt got %v", names)
+			}
+			if !strings.HasSuffix(entries[4], " test") {
+				t.Errorf("Expected the renamed file to be carried over got '%v'", entries[4])
+			}
+			// the renamed file is carried over again from where the last rebuild put it
+			des, _ = Open(u, Options{})
+			des.Rename("moved", "sub")
+			if err := des.Close(); err != nil {
+				t.Fatalf("Error closing destination: %v", err)
+			}
+			des, _ = Open(u, Options{})
+			des.Rename("sub/test.txt", "test.txt")
+			des.(*Archive).mu.Lock()
+			des.(*Archive).dirty = true
+			des.(*Archive).rebuild()
+			des.(*Archive).mu.Unlock()
+			des.Remove("sub")
+			if err := des.Close(); err != nil {
+				t.Fatalf("Error closing destination: %v", err)
+			}
+			if entries = listArchive(t, fp); len(entries) != 4 || !strings.HasPrefix(entries[3], "test.txt") || !strings.HasSuffix(entries[3], " test") {
+				t.Errorf("Expected the file to be carried over twice got %v", entries)
+			}
+			if files, _ := ioutil.ReadDir(filepath.Dir(fp)); len(files) != 1 {
+				t.Errorf("Expected only the archive to be left got %v files", len(files))
+			}
+		})
+	}
+}
+
+// lmtime returns the modification time of the path, without following symlinks.
+func lmtime(t *testing.T, fp string) int64 {
+	info, err := os.Lstat(fp)
+	if err != nil {
+		t.Fatalf("Error reading '%v': %v", fp, err)
+	}
+	return info.ModTime().Unix()
+}
+
+func TestArchiveSettle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "test.txt"), []byte("test"), 0644)
+	fp := filepath.Join(dir, "out.tar")
+
+	des, err := Open("tar://"+fp+"?settle=10ms", Options{})
+	if err != nil {
+		t.Fatalf("Error opening destination: %v", err)
+	}
+	defer des.Close()
+	des.CopyFile(filepath.Join(dir, "test.txt"), "test.txt")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(fp); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the archive to be written once changes settled.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if entries := listArchive(t, fp); len(entries) != 1 || !strings.HasPrefix(entries[0], "test.txt -rw-r--r--") {
+		t.Errorf("Expected the file in the archive got %v", entries)
+	}
+
+	for _, bad := range []string{"tar://" + fp + "?settle=soon", "zip://"} {
+		if _, err := Open(bad, Options{}); err == nil {
+			t.Errorf("Expected an error opening '%v'", bad)
+		}
+	}
+	u, err := Parse("zip://out/site.zip?settle=5s")
+	if err != nil || u.Path != "out/site.zip" || u.Query().Get("settle") != "5s" {
+		t.Errorf("Expected the path and query of an archive URL got %v (%v)", u, err)
+	}
+}
+
+func TestArchiveOwners(t *testing.T) {
+	for _, scheme := range []string{"tar", "zip"} {
+		mem := vfs.NewMem()
+		vfs.WriteFile(mem, "test.txt", []byte("test"), 0644)
+		vfs.Lchown(mem, "test.txt", 1000, 100)
+		des, err := Open(scheme+"://out."+scheme, Options{FS: mem, Preserve: filehandler.Preserve{Owner: true, Xattrs: true}})
+		if err != nil {
+			t.Fatalf("Error opening destination: %v", err)
+		}
+		if err := des.CopyFile("test.txt", "test.txt"); err != nil {
+			t.Fatalf("Error copying file: %v", err)
+		}
+		if err := des.Close(); err != nil {
+			t.Fatalf("Error writing archive: %v", err)
+		}
+		if scheme == "zip" {
+			// zip archives have nowhere to keep owners, they are left out
+			continue
+		}
+
+		f, _ := mem.Open("out.tar")
+		hdr, err := tar.NewReader(f).Next()
+		f.Close()
+		if err != nil || hdr.Uid != 1000 || hdr.Gid != 100 {
+			t.Errorf("Expected the file to be owned by 1000:100 in the archive got %+v (%v)", hdr, err)
+		}
+	}
+}
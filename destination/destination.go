@@ -0,0 +1,221 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// ErrUnavailable is returned when a destination can't be reached, which is usually only for a
+// while.
+var ErrUnavailable = errors.New("destination is unavailable")
+
+// Destination is somewhere a source directory is mirrored into. Source paths are read from the
+// source file system, destination paths are slash separated and relative to the root of the
+// destination, with "." being the root itself.
+type Destination interface {
+	// CopyFile copies the source file to rel, creating any directories above it.
+	CopyFile(src, rel string) error
+	// CopyDir creates the directory rel, and any directories above it, with the modes of the
+	// source directories.
+	CopyDir(src, rel string) error
+	// CopyTree copies the source directory and everything in it to rel.
+	CopyTree(src, rel string) error
+	// Remove removes the file or empty directory at rel.
+	Remove(rel string) error
+	// RemoveAll removes rel and everything in it, a path that doesn't exist isn't an error. The
+	// root itself is never removed.
+	RemoveAll(rel string) error
+	// Rename renames old to new.
+	Rename(old, new string) error
+	// Chmod copies the mode of the source file over to rel.
+	Chmod(src, rel string) error
+	// Differs checks if rel is out of date with the source file, see filehandler.Differs.
+	Differs(src, rel string, cmp filehandler.Compare) (bool, error)
+	// Stat returns the info of rel, without following symlinks.
+	Stat(rel string) (os.FileInfo, error)
+	// Walk calls fn for everything in the destination, parents before their children.
+	Walk(fn func(rel string, info os.FileInfo) error) error
+	// Close releases anything the destination holds on to.
+	Close() error
+}
+
+// Linker is a destination that can hold symlinks.
+type Linker interface {
+	// Symlink makes rel a symlink to target, replacing whatever is there. The directories above
+	// rel have to exist already.
+	Symlink(target, rel string) error
+}
+
+// HardLinker is a destination that can hold hard links.
+type HardLinker interface {
+	// Link makes rel a hard link to the file at old, replacing whatever is there. The directories
+	// above rel have to exist already.
+	Link(old, rel string) error
+}
+
+// Options are handed to a backend when a destination is opened.
+type Options struct {
+	// Log is where the destination logs to, nothing is logged when it's nil.
+	Log logging.Logger
+	// FS is the file system the source is read from, it's the OS when nil.
+	FS vfs.FS
+	// InPlace writes straight into the destination files instead of replacing them, for backends
+	// that can.
+	InPlace bool
+	// Preserve is the metadata copied along with files and directories. Backends that can't hold
+	// some of it warn about it when they are opened and copy without it.
+	Preserve filehandler.Preserve
+	// ProgressSize is the size from which the progress of copying a file is logged, nothing is
+	// logged when it's 0.
+	ProgressSize int64
+	// Delta updates files by writing only the parts of them that changed, for backends that can.
+	Delta bool
+}
+
+// Opener opens a destination from its URL.
+type Opener func(u *url.URL, opts Options) (Destination, error)
+
+var (
+	mu       sync.RWMutex
+	backends = make(map[string]Opener)
+	// paths are the schemes whose URLs are a local path, like 'tar://out.tar'.
+	paths = make(map[string]bool)
+)
+
+// Register makes a backend available for destinations with the given URL scheme. Registering a
+// scheme twice replaces the first backend.
+func Register(scheme string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	backends[scheme] = open
+	delete(paths, scheme)
+}
+
+// registerPath registers a backend whose URLs are a path on the local file system rather than a
+// host and a path, so that 'tar://out.tar' is the relative path 'out.tar'.
+func registerPath(scheme string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	backends[scheme] = open
+	paths[scheme] = true
+}
+
+// Schemes returns the URL schemes that have a backend, sorted.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return schemes()
+}
+
+// schemes returns the sorted schemes, the caller holds mu.
+func schemes() []string {
+	var schemes []string
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Parse turns a destination into a URL and checks there's a backend for it. A destination without
+// a scheme is a local path, and so is everything after 'file://', so 'file://des' is the relative
+// path 'des' and 'file:///des' the absolute path '/des'. The other schemes whose URLs are local
+// paths take everything up to the query as the path.
+func Parse(des string) (*url.URL, error) {
+	if des == "" {
+		return nil, fmt.Errorf("destination is empty")
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var u *url.URL
+	i := strings.Index(des, "://")
+	switch {
+	case i < 0 || strings.HasPrefix(des, "file://"):
+		u = &url.URL{Scheme: "file", Path: strings.TrimPrefix(des, "file://")}
+	case paths[des[:i]]:
+		u = &url.URL{Scheme: des[:i], Path: des[i+3:]}
+		if q := strings.LastIndex(u.Path, "?"); q >= 0 {
+			u.Path, u.RawQuery = u.Path[:q], u.Path[q+1:]
+		}
+	default:
+		var err error
+		if u, err = url.Parse(des); err != nil {
+			return nil, fmt.Errorf("'%v' is not a valid destination: %v", des, err)
+		}
+	}
+	if u.Path == "" && (u.Scheme == "file" || paths[u.Scheme]) {
+		return nil, fmt.Errorf("'%v' is missing a path", des)
+	}
+
+	if _, ok := backends[u.Scheme]; !ok {
+		return nil, fmt.Errorf("no backend registered for '%v://' destinations, expected one of %v", u.Scheme, strings.Join(schemes(), ", "))
+	}
+	return u, nil
+}
+
+// Open opens the destination with the backend registered for its scheme.
+func Open(des string, opts Options) (Destination, error) {
+	u, err := Parse(des)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Log == nil {
+		opts.Log = logging.Discard
+	}
+	if opts.FS == nil {
+		opts.FS = vfs.OS
+	}
+
+	mu.RLock()
+	open := backends[u.Scheme]
+	mu.RUnlock()
+	return open(u, opts)
+}
+
+// preserved returns the metadata the backend can hold out of what it was asked to preserve,
+// warning about the rest.
+func preserved(opts Options, des string, can filehandler.Preserve) filehandler.Preserve {
+	lost := opts.Preserve.Without(can)
+	if lost != (filehandler.Preserve{}) {
+		opts.Log.Notice("'%v' can't hold %v, copying without them.", des, lost)
+	}
+	return opts.Preserve.Without(lost)
+}
+
+// noDelta warns that the backend copies whole files, if it was asked to update them with deltas.
+func noDelta(opts Options, des string) {
+	if opts.Delta {
+		opts.Log.Notice("'%v' can't be updated with deltas, copying whole files.", des)
+	}
+}
+
+// fileInfo is the info of a file kept by a backend that has no os.FileInfo of its own.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() os.FileMode  { return i.mode }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}   { return nil }
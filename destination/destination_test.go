@@ -0,0 +1,120 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"des":               "des",
+		"/abs/des":          "/abs/des",
+		"file://des":        "des",
+		"file:///abs/des":   "/abs/des",
+		"../des/with:colon": "../des/with:colon",
+	}
+	for des, path := range tests {
+		u, err := Parse(des)
+		if err != nil {
+			t.Errorf("Error parsing '%v': %v", des, err)
+			continue
+		}
+		if u.Scheme != "file" || u.Path != path {
+			t.Errorf("Expected '%v' to be the local path '%v' got %v", des, path, u)
+		}
+	}
+
+	for _, bad := range []string{"", "file://", "gopher://host/des", "sftp://%zz/des"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Expected an error parsing '%v'", bad)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var opened *url.URL
+	Register("test", func(u *url.URL, opts Options) (Destination, error) {
+		opened = u
+		return NewLocal("/"+u.Hostname()+u.Path, opts), nil
+	})
+	defer func() {
+		mu.Lock()
+		delete(backends, "test")
+		mu.Unlock()
+	}()
+
+	if schemes := Schemes(); !sort.StringsAreSorted(schemes) || !strings.Contains(","+strings.Join(schemes, ",")+",", ",test,") {
+		t.Errorf("Expected the test scheme in sorted schemes got %v", schemes)
+	}
+	des, err := Open("test://user@host:22/des", Options{})
+	if err != nil {
+		t.Fatalf("Error opening destination: %v", err)
+	}
+	if opened.User.Username() != "user" || opened.Port() != "22" {
+		t.Errorf("Expected the backend to be given the whole URL got %v", opened)
+	}
+	if l, ok := des.(*Local); !ok || l.Root() != "/host/des" || l.FS() != vfs.OS {
+		t.Errorf("Expected the destination the backend returned got %#v", des)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "/src/sub", 0750)
+	vfs.WriteFile(mem, "/src/sub/test.txt", []byte("test"), 0640)
+
+	des, err := Open("file:///des", Options{FS: mem})
+	if err != nil {
+		t.Fatalf("Error opening destination: %v", err)
+	}
+	defer des.Close()
+
+	if differs, _ := des.Differs("/src/sub/test.txt", "sub/test.txt", filehandler.CompareSize); !differs {
+		t.Errorf("Expected a missing file to differ.")
+	}
+	if err := des.CopyFile("/src/sub/test.txt", "sub/test.txt"); err != nil {
+		t.Fatalf("Error copying file: %v", err)
+	}
+	if b, _ := vfs.ReadFile(mem, "/des/sub/test.txt"); string(b) != "test" {
+		t.Errorf("Expected the file to be copied, got '%s'", b)
+	}
+	if info, err := des.Stat("sub"); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Expected the directory to have the source's mode got %v (%v)", info, err)
+	}
+	if differs, _ := des.Differs("/src/sub/test.txt", "sub/test.txt", filehandler.CompareHash); differs {
+		t.Errorf("Expected the copy not to differ.")
+	}
+
+	if err := des.Rename("sub", "moved"); err != nil {
+		t.Fatalf("Error renaming: %v", err)
+	}
+	var walked []string
+	des.Walk(func(rel string, info os.FileInfo) error {
+		walked = append(walked, rel)
+		return nil
+	})
+	if strings.Join(walked, ",") != "moved,moved/test.txt" {
+		t.Errorf("Expected to walk the renamed directory got %v", walked)
+	}
+
+	if err := des.RemoveAll("."); err != filehandler.ErrOutsideRoot {
+		t.Errorf("Expected '%v' removing the root got '%v'", filehandler.ErrOutsideRoot, err)
+	}
+	if err := des.RemoveAll("moved"); err != nil {
+		t.Errorf("Error removing directory: %v", err)
+	}
+	if _, err := des.Stat("moved"); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory to be removed got %v", err)
+	}
+}
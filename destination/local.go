@@ -0,0 +1,126 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+func init() {
+	Register("file", func(u *url.URL, opts Options) (Destination, error) {
+		return NewLocal(u.Path, opts), nil
+	})
+}
+
+// Local is a directory on the same file system as the source.
+type Local struct {
+	root  string
+	files *filehandler.Handler
+}
+
+// NewLocal returns the directory at root as a destination.
+func NewLocal(root string, opts Options) *Local {
+	files := filehandler.New(opts.Log, opts.FS)
+	files.InPlace = opts.InPlace
+	files.Preserve = opts.Preserve
+	files.ProgressSize = opts.ProgressSize
+	files.Delta = opts.Delta
+	return &Local{root: root, files: files}
+}
+
+// Root returns the directory the destination is in.
+func (l *Local) Root() string {
+	return l.root
+}
+
+// FS returns the file system the destination is on.
+func (l *Local) FS() vfs.FS {
+	return l.files.FS()
+}
+
+// Path returns where rel is on the file system.
+func (l *Local) Path(rel string) string {
+	return filepath.Join(l.root, filepath.FromSlash(rel))
+}
+
+// CopyFile copies the source file to rel.
+func (l *Local) CopyFile(src, rel string) error {
+	return l.files.CopyFile(src, l.Path(rel))
+}
+
+// CopyDir creates the directory rel with the modes of the source directories.
+func (l *Local) CopyDir(src, rel string) error {
+	return l.files.CopyDir(src, l.Path(rel))
+}
+
+// CopyTree copies the source directory and everything in it to rel.
+func (l *Local) CopyTree(src, rel string) error {
+	return l.files.CopyTree(src, l.Path(rel))
+}
+
+// Symlink makes rel a symlink to target.
+func (l *Local) Symlink(target, rel string) error {
+	return l.files.Symlink(target, l.Path(rel))
+}
+
+// Link makes rel a hard link to the file at old.
+func (l *Local) Link(old, rel string) error {
+	return l.files.Link(l.Path(old), l.Path(rel))
+}
+
+// Remove removes the file or empty directory at rel.
+func (l *Local) Remove(rel string) error {
+	return l.files.Remove(l.Path(rel))
+}
+
+// RemoveAll removes rel and everything in it, as long as it's inside the root.
+func (l *Local) RemoveAll(rel string) error {
+	return l.files.RemoveAll(l.root, l.Path(rel))
+}
+
+// Rename renames old to new.
+func (l *Local) Rename(old, new string) error {
+	return l.files.Rename(l.Path(old), l.Path(new))
+}
+
+// Chmod copies the mode of the source file over to rel.
+func (l *Local) Chmod(src, rel string) error {
+	return l.files.Chmod(src, l.Path(rel))
+}
+
+// Differs checks if rel is out of date with the source file.
+func (l *Local) Differs(src, rel string, cmp filehandler.Compare) (bool, error) {
+	return l.files.Differs(src, l.Path(rel), cmp)
+}
+
+// Stat returns the info of rel without following symlinks.
+func (l *Local) Stat(rel string) (os.FileInfo, error) {
+	return l.files.FS().Lstat(l.Path(rel))
+}
+
+// Walk calls fn for everything under the root.
+func (l *Local) Walk(fn func(rel string, info os.FileInfo) error) error {
+	return vfs.Walk(l.files.FS(), l.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), info)
+	})
+}
+
+// Close does nothing, there's nothing to release.
+func (l *Local) Close() error {
+	return nil
+}
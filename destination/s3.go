@@ -0,0 +1,481 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+var (
+	// s3PartSize is the size of the parts of a multipart upload.
+	s3PartSize int64 = 8 << 20
+	// s3MultipartSize is the size above which files are uploaded in parts.
+	s3MultipartSize int64 = 16 << 20
+)
+
+const (
+	// s3Timeout is how long a single request may take.
+	s3Timeout = 5 * time.Minute
+	// s3DirMode is the mode of the directories in a bucket, which only exist as key prefixes.
+	s3DirMode = os.ModeDir | 0755
+)
+
+func init() {
+	Register("s3", func(u *url.URL, opts Options) (Destination, error) {
+		return OpenS3(u, opts)
+	})
+}
+
+// S3 is a prefix in a bucket of Amazon S3 or any service compatible with it. Its URL has the form
+// 's3://bucket/prefix'. The credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_SESSION_TOKEN, and the region from the 'region' query parameter, AWS_REGION or
+// AWS_DEFAULT_REGION. The 'endpoint' query parameter, or AWS_ENDPOINT_URL_S3, points it at a
+// service other than Amazon's, which is addressed with path style URLs.
+//
+// Objects keep the mode, modification time and SHA-256 hash of their source file in their
+// metadata. Renames are copies followed by deletes, and directories only exist as the prefixes of
+// the objects in them, so empty directories aren't mirrored.
+type S3 struct {
+	prefix string
+	log    logging.Logger
+	fs     vfs.FS
+	client *s3Client
+	// progress is the size from which the progress of an upload is logged.
+	progress int64
+}
+
+// OpenS3 returns the prefix of the bucket in the URL as a destination, after checking the bucket
+// can be listed with the credentials.
+func OpenS3(u *url.URL, opts Options) (*S3, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("'%v' is missing a bucket", u)
+	}
+	query := u.Query()
+	region := firstOf(query.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	key, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if key == "" || secret == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY have to be set to use '%v'", u)
+	}
+
+	endpoint := firstOf(query.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"))
+	pathStyle := endpoint != ""
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	e, err := url.Parse(endpoint)
+	if err != nil || e.Host == "" {
+		return nil, fmt.Errorf("'%v' is not a valid endpoint", endpoint)
+	}
+
+	s := &S3{
+		prefix:   strings.Trim(u.Path, "/"),
+		log:      opts.Log,
+		fs:       opts.FS,
+		progress: opts.ProgressSize,
+		client: &s3Client{
+			endpoint:  e,
+			bucket:    u.Host,
+			region:    region,
+			pathStyle: pathStyle,
+			key:       key,
+			secret:    secret,
+			token:     os.Getenv("AWS_SESSION_TOKEN"),
+			http:      &http.Client{Timeout: s3Timeout},
+		},
+	}
+	// modification times are kept in the metadata of the objects, nothing else is
+	preserved(opts, u.Redacted(), filehandler.Preserve{Times: true})
+	noDelta(opts, u.Redacted())
+	s.log.Debug("Checking bucket '%v' at '%v'...", u.Host, e)
+	if _, err := s.client.list(s.dirKey("."), 1); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// firstOf returns the first of the values that isn't empty.
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// key returns the key of the object at rel.
+func (s *S3) key(rel string) string {
+	return strings.TrimPrefix(path.Join(s.prefix, rel), "/")
+}
+
+// dirKey returns the prefix of the objects in the directory at rel.
+func (s *S3) dirKey(rel string) string {
+	if key := s.key(rel); key != "" && key != "." {
+		return key + "/"
+	}
+	return ""
+}
+
+// s3Sums are the hashes of a file, with the ETag it gets when it's uploaded by mimic.
+type s3Sums struct {
+	etag   string
+	sha256 string
+}
+
+// sums hashes the source file, splitting it into parts the same way an upload does so that the
+// ETag of a multipart upload can be worked out as well.
+func (s *S3) sums(src string, size int64) (s3Sums, error) {
+	f, err := s.fs.Open(src)
+	if err != nil {
+		return s3Sums{}, err
+	}
+	defer f.Close()
+
+	all := sha256.New()
+	if size <= s3MultipartSize {
+		sum := md5.New()
+		if _, err := io.Copy(io.MultiWriter(all, sum), f); err != nil {
+			return s3Sums{}, err
+		}
+		return s3Sums{etag: hex.EncodeToString(sum.Sum(nil)), sha256: hex.EncodeToString(all.Sum(nil))}, nil
+	}
+
+	var parts []byte
+	var count int
+	for {
+		sum := md5.New()
+		n, err := io.CopyN(io.MultiWriter(all, sum), f, s3PartSize)
+		if n > 0 {
+			parts = append(parts, sum.Sum(nil)...)
+			count++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return s3Sums{}, err
+		}
+	}
+	etag := md5.Sum(parts)
+	return s3Sums{etag: hex.EncodeToString(etag[:]) + "-" + strconv.Itoa(count), sha256: hex.EncodeToString(all.Sum(nil))}, nil
+}
+
+// metadata returns the headers that keep the mode, modification time and hash of the source
+// file on its object.
+func metadata(info os.FileInfo, sha string) http.Header {
+	h := http.Header{}
+	h.Set("X-Amz-Meta-Mode", strconv.FormatUint(uint64(info.Mode().Perm()), 8))
+	h.Set("X-Amz-Meta-Mtime", strconv.FormatInt(info.ModTime().UnixNano(), 10))
+	if sha != "" {
+		h.Set("X-Amz-Meta-Sha256", sha)
+	}
+	return h
+}
+
+// matches checks if the object has the contents of the source file, by its ETag or the hash in
+// its metadata.
+func (sums s3Sums) matches(h http.Header) bool {
+	return strings.Trim(h.Get("ETag"), `"`) == sums.etag || h.Get("X-Amz-Meta-Sha256") == sums.sha256
+}
+
+// CopyFile uploads the source file to rel, in parts when it's large. Nothing is uploaded when the
+// object already has the same contents, and only the metadata is updated if that's all that
+// changed.
+func (s *S3) CopyFile(src, rel string) error {
+	info, err := s.fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	sums, err := s.sums(src, info.Size())
+	if err != nil {
+		return err
+	}
+	key := s.key(rel)
+	meta := metadata(info, sums.sha256)
+
+	if h, err := s.client.head(key); err == nil && sums.matches(h) {
+		if h.Get("X-Amz-Meta-Mode") == meta.Get("X-Amz-Meta-Mode") && h.Get("X-Amz-Meta-Mtime") == meta.Get("X-Amz-Meta-Mtime") {
+			s.log.Debug("'%v' already has the contents of '%v', skipping the upload.", key, src)
+			return nil
+		}
+		s.log.Debug("Only the metadata of '%v' changed, updating it.", src)
+		return s.client.copy(key, key, meta)
+	}
+
+	f, err := s.fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info.Size() <= s3MultipartSize {
+		s.log.Debug("Uploading '%v' to '%v'.", src, key)
+		b := make([]byte, info.Size())
+		if _, err := io.ReadFull(f, b); err != nil {
+			return err
+		}
+		_, err = s.client.put(key, meta, b)
+		return err
+	}
+	progress := filehandler.NewProgress(s.log, src, info.Size(), s.progress)
+	if err := s.upload(progress.Reader(f), key, meta); err != nil {
+		return err
+	}
+	progress.Done()
+	return nil
+}
+
+// upload uploads the file in parts, throwing the parts away when it fails.
+func (s *S3) upload(f io.Reader, key string, meta http.Header) (err error) {
+	id, err := s.client.startUpload(key, meta)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.client.abortUpload(key, id)
+		}
+	}()
+
+	var parts []s3Part
+	buf := make([]byte, s3PartSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			s.log.Debug("Uploading part %d of '%v'.", number, key)
+			etag, err := s.client.uploadPart(key, id, number, buf[:n])
+			if err != nil {
+				return err
+			}
+			parts = append(parts, s3Part{PartNumber: number, ETag: etag})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return s.client.completeUpload(key, id, parts)
+}
+
+// CopyDir does nothing, directories only exist as the prefixes of the objects in them.
+func (s *S3) CopyDir(src, rel string) error {
+	return nil
+}
+
+// CopyTree uploads every file in the source directory to rel.
+func (s *S3) CopyTree(src, rel string) error {
+	return vfs.Walk(s.fs, src, func(fp string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		sub, err := filepath.Rel(src, fp)
+		if err != nil {
+			return err
+		}
+		return s.CopyFile(fp, path.Join(rel, filepath.ToSlash(sub)))
+	})
+}
+
+// Remove deletes the object at rel. Directories go away by themselves once they are empty.
+func (s *S3) Remove(rel string) error {
+	return s.client.delete(s.key(rel))
+}
+
+// RemoveAll deletes the object at rel and every object under it.
+func (s *S3) RemoveAll(rel string) error {
+	if rel = path.Clean(rel); rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return filehandler.ErrOutsideRoot
+	}
+	objects, err := s.client.list(s.dirKey(rel), 0)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := s.client.delete(object.Key); err != nil {
+			return err
+		}
+	}
+	return s.client.delete(s.key(rel))
+}
+
+// Rename copies the object, or every object under the directory, at old to new and then deletes
+// the original.
+func (s *S3) Rename(old, new string) error {
+	from, to := s.key(old), s.key(new)
+	if _, err := s.client.head(from); err == nil {
+		s.log.Debug("Copying '%v' to '%v'.", from, to)
+		if err := s.client.copy(from, to, nil); err != nil {
+			return err
+		}
+		return s.client.delete(from)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	objects, err := s.client.list(s.dirKey(old), 0)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return &os.PathError{Op: "rename", Path: from, Err: os.ErrNotExist}
+	}
+	for _, object := range objects {
+		key := to + "/" + strings.TrimPrefix(object.Key, s.dirKey(old))
+		s.log.Debug("Copying '%v' to '%v'.", object.Key, key)
+		if err := s.client.copy(object.Key, key, nil); err != nil {
+			return err
+		}
+		if err := s.client.delete(object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chmod copies the mode of the source file into the metadata of the object at rel.
+func (s *S3) Chmod(src, rel string) error {
+	info, err := s.fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	key := s.key(rel)
+	h, err := s.client.head(key)
+	if err != nil {
+		return err
+	}
+	return s.client.copy(key, key, metadata(info, h.Get("X-Amz-Meta-Sha256")))
+}
+
+// Differs checks if the object at rel is out of date with the source file, by the modification
+// time in its metadata or by its hashes.
+func (s *S3) Differs(src, rel string, cmp filehandler.Compare) (bool, error) {
+	if cmp == filehandler.CompareAlways {
+		return true, nil
+	}
+	info, err := s.fs.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	h, err := s.client.head(s.key(rel))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if size, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64); info.IsDir() || size != info.Size() {
+		return true, nil
+	}
+	if cmp != filehandler.CompareHash {
+		return h.Get("X-Amz-Meta-Mtime") != strconv.FormatInt(info.ModTime().UnixNano(), 10), nil
+	}
+	sums, err := s.sums(src, info.Size())
+	if err != nil {
+		return false, err
+	}
+	return !sums.matches(h), nil
+}
+
+// Stat returns the info of the object at rel, or of the directory when there are objects under
+// it.
+func (s *S3) Stat(rel string) (os.FileInfo, error) {
+	name := path.Base(rel)
+	if rel == "." || rel == "" {
+		return &fileInfo{name: ".", mode: s3DirMode}, nil
+	}
+	h, err := s.client.head(s.key(rel))
+	if err == nil {
+		size, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+		info := &fileInfo{name: name, size: size, mode: 0644}
+		if mode, err := strconv.ParseUint(h.Get("X-Amz-Meta-Mode"), 8, 32); err == nil {
+			info.mode = os.FileMode(mode)
+		}
+		if mtime, err := strconv.ParseInt(h.Get("X-Amz-Meta-Mtime"), 10, 64); err == nil {
+			info.modTime = time.Unix(0, mtime)
+		} else {
+			info.modTime, _ = http.ParseTime(h.Get("Last-Modified"))
+		}
+		return info, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	objects, err := s.client.list(s.dirKey(rel), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, &os.PathError{Op: "stat", Path: s.key(rel), Err: os.ErrNotExist}
+	}
+	return &fileInfo{name: name, mode: s3DirMode}, nil
+}
+
+// Walk calls fn for every object under the prefix, and for every directory above them before
+// the objects in it.
+func (s *S3) Walk(fn func(rel string, info os.FileInfo) error) error {
+	base := s.dirKey(".")
+	objects, err := s.client.list(base, 0)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, object := range objects {
+		rel := strings.TrimSuffix(strings.TrimPrefix(object.Key, base), "/")
+		if rel == "" {
+			continue
+		}
+		parts := strings.Split(rel, "/")
+		for i := 1; i < len(parts); i++ {
+			dir := strings.Join(parts[:i], "/")
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			if err := fn(dir, &fileInfo{name: parts[i-1], mode: s3DirMode}); err != nil {
+				return err
+			}
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			if !seen[rel] {
+				seen[rel] = true
+				if err := fn(rel, &fileInfo{name: path.Base(rel), mode: s3DirMode}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		info := &fileInfo{name: path.Base(rel), size: object.Size, mode: 0644, modTime: object.LastModified}
+		if err := fn(rel, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close does nothing, every request is made on its own.
+func (s *S3) Close() error {
+	return nil
+}
@@ -0,0 +1,371 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the SHA-256 hash of an empty payload.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Client makes signed requests to a single bucket of an S3 compatible service.
+type s3Client struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	pathStyle bool
+	key       string
+	secret    string
+	token     string
+	http      *http.Client
+}
+
+// s3Error is an error response from the service.
+type s3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("s3: %v %v: %v", e.Status, e.Code, e.Message)
+}
+
+// s3Object is an object in a bucket listing.
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	ETag         string    `xml:"ETag"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// s3Part is an uploaded part of a multipart upload.
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// url returns the URL of the object, or of the bucket when key is empty.
+func (c *s3Client) url(key string) *url.URL {
+	u := *c.endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if c.pathStyle {
+		p += "/" + c.bucket
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	if key != "" {
+		p += "/" + key
+	}
+	u.Path = p
+	u.RawPath = s3Escape(p, false)
+	return &u
+}
+
+// do signs and sends the request and returns the response of a successful one. Responses that
+// aren't successful are turned into errors, with a missing object being os.ErrNotExist, and the
+// service not being reachable or overloaded being ErrUnavailable.
+func (c *s3Client) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := c.url(key)
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	payload := emptySHA256
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payload = hex.EncodeToString(sum[:])
+	}
+	c.sign(req, payload, time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	e := &s3Error{Status: resp.StatusCode}
+	b, _ := ioutil.ReadAll(resp.Body)
+	xml.Unmarshal(b, e)
+	switch {
+	case resp.StatusCode == http.StatusNotFound && e.Code != "NoSuchBucket" && e.Code != "NoSuchUpload":
+		return nil, &os.PathError{Op: strings.ToLower(method), Path: key, Err: os.ErrNotExist}
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, e)
+	}
+	return nil, e
+}
+
+// sign signs the request with AWS signature version 4, covering the host and every header set on
+// the request.
+func (c *s3Client) sign(req *http.Request, payload string, now time.Time) {
+	date := now.UTC().Format("20060102T150405Z")
+	day := date[:8]
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if c.token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.token)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	names := []string{"host"}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if name == "authorization" {
+			continue
+		}
+		trimmed := make([]string, len(v))
+		for i := range v {
+			trimmed[i] = strings.Join(strings.Fields(v[i]), " ")
+		}
+		values[name] = strings.Join(trimmed, ",")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), s3Query(req.URL.Query()), headers.String(), signed, payload}, "\n")
+	scope := day + "/" + c.region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secret), day)
+	for _, part := range []string{c.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", c.key, scope, signed, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data with the key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape escapes everything but the unreserved characters, and slashes unless all is set.
+func s3Escape(s string, all bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !all:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query returns the query in its canonical form, sorted and escaped.
+func s3Query(query url.Values) string {
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// head returns the headers of the object.
+func (c *s3Client) head(key string) (http.Header, error) {
+	resp, err := c.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Header, nil
+}
+
+// get returns the contents of the object, the caller has to close it.
+func (c *s3Client) get(key string) (io.ReadCloser, error) {
+	resp, err := c.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// put uploads the object in a single request and returns its ETag.
+func (c *s3Client) put(key string, header http.Header, body []byte) (string, error) {
+	resp, err := c.do(http.MethodPut, key, nil, header, body)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// copy copies the object at from to key. The metadata of from is kept unless header has
+// metadata of its own, which replaces it.
+func (c *s3Client) copy(from, key string, header http.Header) error {
+	h := http.Header{}
+	for k, v := range header {
+		h[k] = v
+	}
+	h.Set("X-Amz-Copy-Source", s3Escape("/"+c.bucket+"/"+from, false))
+	if len(header) > 0 {
+		h.Set("X-Amz-Metadata-Directive", "REPLACE")
+	}
+	resp, err := c.do(http.MethodPut, key, nil, h, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// a copy can fail after the response has started, in which case the body holds the error
+	b, _ := ioutil.ReadAll(resp.Body)
+	e := &s3Error{Status: resp.StatusCode}
+	if xml.Unmarshal(b, e) == nil && e.Code != "" {
+		return e
+	}
+	return nil
+}
+
+// delete removes the object, removing one that doesn't exist isn't an error.
+func (c *s3Client) delete(key string) error {
+	resp, err := c.do(http.MethodDelete, key, nil, nil, nil)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// list returns every object whose key starts with the prefix, in order, following the pages of
+// the listing. A limit above 0 stops after that many objects.
+func (c *s3Client) list(prefix string, limit int) ([]s3Object, error) {
+	var objects []s3Object
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if limit > 0 {
+		query.Set("max-keys", strconv.Itoa(limit))
+	}
+	for {
+		resp, err := c.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || (limit > 0 && len(objects) >= limit) {
+			return objects, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// startUpload starts a multipart upload of the object and returns its id.
+func (c *s3Client) startUpload(key string, header http.Header) (string, error) {
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+// uploadPart uploads a part of a multipart upload and returns its ETag.
+func (c *s3Client) uploadPart(key, id string, number int, body []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {id}}
+	resp, err := c.do(http.MethodPut, key, query, nil, body)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// completeUpload puts the parts of a multipart upload together into the object.
+func (c *s3Client) completeUpload(key, id string, parts []s3Part) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploadId": {id}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	e := &s3Error{Status: resp.StatusCode}
+	if xml.Unmarshal(b, e) == nil && e.Code != "" {
+		return e
+	}
+	return nil
+}
+
+// abortUpload throws away the parts of a multipart upload that failed.
+func (c *s3Client) abortUpload(key, id string) error {
+	resp, err := c.do(http.MethodDelete, key, url.Values{"uploadId": {id}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
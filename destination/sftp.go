@@ -0,0 +1,712 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// sftpPort is the port used when an sftp:// destination doesn't give one.
+	sftpPort = "22"
+	// sftpTimeout is how long connecting to the server may take.
+	sftpTimeout = 10 * time.Second
+	// sftpIdle is how many idle connections are kept to each server.
+	sftpIdle = 2
+)
+
+// defaultKeys are the private keys in ~/.ssh that are tried when a destination doesn't name one.
+var defaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+func init() {
+	Register("sftp", func(u *url.URL, opts Options) (Destination, error) {
+		return OpenSFTP(u, opts)
+	})
+}
+
+// SFTP is a directory on another machine, written to over SSH. Its URL has the form
+// 'sftp://user@host:port/path', where the path is absolute and a path starting with '/~/' is
+// relative to the user's home directory. The 'key' query parameter names the private key to log
+// in with and 'known_hosts' the file the server's host key is checked against, they default to
+// the keys in ~/.ssh, along with any keys in the SSH agent, and ~/.ssh/known_hosts.
+//
+// Connections to the same server are shared by every destination on it, and a connection that is
+// lost is made again the next time it's needed.
+type SFTP struct {
+	root     string
+	log      logging.Logger
+	fs       vfs.FS
+	inPlace  bool
+	preserve filehandler.Preserve
+	progress int64
+	pool     *sftpPool
+	// noOwner is set once the server refused to change an owner.
+	noOwner int32
+}
+
+// OpenSFTP connects to the server in the URL and returns the directory on it as a destination.
+// The directory is created if it doesn't exist.
+func OpenSFTP(u *url.URL, opts Options) (*SFTP, error) {
+	if _, ok := u.User.Password(); ok {
+		return nil, fmt.Errorf("'%v' has a password, log in with a key or the SSH agent instead", u.Redacted())
+	}
+	root := u.Path
+	if strings.HasPrefix(root, "/~/") {
+		root = strings.TrimPrefix(root, "/~/")
+	}
+	if root == "" || root == "/~" {
+		root = "."
+	}
+
+	pool, err := getPool(u)
+	if err != nil {
+		return nil, err
+	}
+	s := &SFTP{root: root, log: opts.Log, fs: opts.FS, inPlace: opts.InPlace, progress: opts.ProgressSize, pool: pool}
+	// SFTP has no extended attributes, so it has no ACLs either
+	s.preserve = preserved(opts, u.Redacted(), filehandler.Preserve{Times: true, Owner: true})
+	// finding the changes would mean downloading the whole of every remote file, since the server
+	// can't be asked for the checksums of its blocks
+	noDelta(opts, u.Redacted())
+	s.log.Debug("Creating '%v' on '%v' if it doesn't exist...", root, pool.addr)
+	if err := s.do(func(c *sftp.Client) error { return c.MkdirAll(root) }); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// remote returns where rel is on the server.
+func (s *SFTP) remote(rel string) string {
+	return path.Join(s.root, rel)
+}
+
+// do runs the operation with a connection from the pool. When the connection turns out to have
+// been lost the operation is run once more on a new one.
+func (s *SFTP) do(op func(c *sftp.Client) error) error {
+	for attempt := 0; ; attempt++ {
+		conn, err := s.pool.get()
+		if err != nil {
+			return err
+		}
+		err = op(conn.client)
+		if err != nil && conn.lost(err) {
+			conn.close()
+			if attempt == 0 {
+				s.log.Notice("Lost the connection to '%v', reconnecting...", s.pool.addr)
+				continue
+			}
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		s.pool.put(conn)
+		return err
+	}
+}
+
+// CopyFile copies the source file to rel. The file is written to a temporary file next to rel and
+// renamed over it, unless the destination was opened to write in place.
+func (s *SFTP) CopyFile(src, rel string) error {
+	if err := s.CopyDir(filepath.Dir(src), path.Dir(rel)); err != nil {
+		return err
+	}
+	info, err := s.fs.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	return s.do(func(c *sftp.Client) error {
+		from, err := s.fs.Open(src)
+		if err != nil {
+			return err
+		}
+		defer from.Close()
+
+		des := s.remote(rel)
+		to := des
+		if !s.inPlace {
+			to = path.Join(path.Dir(des), "."+path.Base(des)+".mimic-"+randomSuffix())
+		}
+		s.log.Debug("Copying '%v' to '%v' on '%v'.", src, to, s.pool.addr)
+		if err := s.write(c, from, to, info); err != nil {
+			if to != des {
+				c.Remove(to)
+			}
+			return err
+		}
+		if to != des {
+			s.log.Debug("Renaming '%v' to '%v'.", to, des)
+			if err := rename(c, to, des); err != nil {
+				return err
+			}
+		}
+		return s.dirTimes(c, filepath.Dir(src), path.Dir(des))
+	})
+}
+
+// write copies the contents of from into the file at to and gives it the mode and modification
+// time of the source.
+func (s *SFTP) write(c *sftp.Client, from vfs.File, to string, info os.FileInfo) error {
+	f, err := c.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	progress := filehandler.NewProgress(s.log, from.Name(), info.Size(), s.progress)
+	if _, err := f.ReadFrom(progress.Reader(from)); err != nil {
+		f.Close()
+		return err
+	}
+	progress.Done()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.chown(c, to, info)
+	if err := c.Chmod(to, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return c.Chtimes(to, info.ModTime(), info.ModTime())
+}
+
+// chown gives the remote path the owner of the source, if owners are preserved. The ids are
+// used as they are, and the first time the server refuses owners are given up on with a warning.
+func (s *SFTP) chown(c *sftp.Client, des string, info os.FileInfo) {
+	if !s.preserve.Owner || atomic.LoadInt32(&s.noOwner) != 0 {
+		return
+	}
+	uid, gid, ok := vfs.Owner(info)
+	if !ok {
+		return
+	}
+	s.log.Debug("Changing the owner of '%v' on '%v' to %v:%v.", des, s.pool.addr, uid, gid)
+	if err := c.Chown(des, uid, gid); err != nil && atomic.CompareAndSwapInt32(&s.noOwner, 0, 1) {
+		s.log.Notice("Can't preserve owners on '%v', copying without them from now on: %v", s.pool.addr, err)
+	}
+}
+
+// dirTimes gives the remote directory the modification time of the source directory, if times
+// are preserved.
+func (s *SFTP) dirTimes(c *sftp.Client, src, des string) error {
+	if !s.preserve.Times {
+		return nil
+	}
+	info, err := s.fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	return c.Chtimes(des, info.ModTime(), info.ModTime())
+}
+
+// CopyDir creates the directory rel, and any directories above it that don't exist, with the
+// modes of the matching source directories.
+func (s *SFTP) CopyDir(src, rel string) error {
+	if rel == "." || rel == "" {
+		return nil
+	}
+	return s.do(func(c *sftp.Client) error {
+		if info, err := c.Stat(s.remote(rel)); err == nil && info.IsDir() {
+			return nil
+		}
+		parts := strings.Split(rel, "/")
+		for i := range parts {
+			des := s.remote(strings.Join(parts[:i+1], "/"))
+			if _, err := c.Stat(des); err == nil {
+				continue
+			}
+			// the source directory is as many levels above src as des is above rel
+			dir := src
+			for j := i + 1; j < len(parts); j++ {
+				dir = filepath.Dir(dir)
+			}
+			info, err := s.fs.Stat(dir)
+			if err != nil {
+				return err
+			}
+			s.log.Notice("Directory '%v' doesn't exist on '%v', creating it now...", des, s.pool.addr)
+			if err := c.Mkdir(des); err != nil {
+				return err
+			}
+			s.chown(c, des, info)
+			if err := c.Chmod(des, info.Mode().Perm()); err != nil {
+				return err
+			}
+			if err := s.dirTimes(c, dir, des); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CopyTree copies the source directory and everything in it to rel.
+func (s *SFTP) CopyTree(src, rel string) error {
+	return vfs.Walk(s.fs, src, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		sub, err := filepath.Rel(src, fp)
+		if err != nil {
+			return err
+		}
+		des := path.Join(rel, filepath.ToSlash(sub))
+		if info.IsDir() {
+			return s.CopyDir(fp, des)
+		}
+		return s.CopyFile(fp, des)
+	})
+}
+
+// Symlink makes rel a symlink to target. The link is created under a temporary name next to rel
+// and renamed over it.
+func (s *SFTP) Symlink(target, rel string) error {
+	return s.do(func(c *sftp.Client) error {
+		des := s.remote(rel)
+		tmp := path.Join(path.Dir(des), "."+path.Base(des)+".mimic-"+randomSuffix())
+		s.log.Debug("Linking '%v' to '%v' on '%v'.", tmp, target, s.pool.addr)
+		if err := c.Symlink(target, tmp); err != nil {
+			return err
+		}
+		s.log.Debug("Renaming '%v' to '%v'.", tmp, des)
+		if err := rename(c, tmp, des); err != nil {
+			c.Remove(tmp)
+			return err
+		}
+		return nil
+	})
+}
+
+// Link makes rel a hard link to the file at old, which needs the server to support the
+// hardlink@openssh.com extension.
+func (s *SFTP) Link(old, rel string) error {
+	return s.do(func(c *sftp.Client) error {
+		des := s.remote(rel)
+		tmp := path.Join(path.Dir(des), "."+path.Base(des)+".mimic-"+randomSuffix())
+		s.log.Debug("Linking '%v' to '%v' on '%v'.", tmp, s.remote(old), s.pool.addr)
+		if err := c.Link(s.remote(old), tmp); err != nil {
+			var status *sftp.StatusError
+			if errors.As(err, &status) && status.FxCode() == sftp.ErrSSHFxOpUnsupported {
+				return &os.LinkError{Op: "link", Old: s.remote(old), New: tmp, Err: vfs.ErrUnsupported}
+			}
+			return err
+		}
+		s.log.Debug("Renaming '%v' to '%v'.", tmp, des)
+		err := rename(c, tmp, des)
+		// renaming over a link to the same file leaves both in place
+		c.Remove(tmp)
+		return err
+	})
+}
+
+// Remove removes the file or empty directory at rel.
+func (s *SFTP) Remove(rel string) error {
+	return s.do(func(c *sftp.Client) error {
+		return c.Remove(s.remote(rel))
+	})
+}
+
+// RemoveAll removes rel and everything in it.
+func (s *SFTP) RemoveAll(rel string) error {
+	if rel = path.Clean(rel); rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return filehandler.ErrOutsideRoot
+	}
+	return s.do(func(c *sftp.Client) error {
+		return removeAll(c, s.remote(rel))
+	})
+}
+
+// removeAll removes the path and everything in it, children first.
+func removeAll(c *sftp.Client, fp string) error {
+	info, err := c.Lstat(fp)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		infos, err := c.ReadDir(fp)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if err := removeAll(c, path.Join(fp, info.Name())); err != nil {
+				return err
+			}
+		}
+		return c.RemoveDirectory(fp)
+	}
+	return c.Remove(fp)
+}
+
+// Rename renames old to new, replacing anything at new.
+func (s *SFTP) Rename(old, new string) error {
+	return s.do(func(c *sftp.Client) error {
+		return rename(c, s.remote(old), s.remote(new))
+	})
+}
+
+// rename renames old over new. Servers without the posix-rename extension can't rename over an
+// existing file, so new is removed first on those.
+func rename(c *sftp.Client, old, new string) error {
+	if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+		return c.PosixRename(old, new)
+	}
+	if err := c.Remove(new); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return c.Rename(old, new)
+}
+
+// Chmod copies the mode of the source file over to rel, along with its owner and modification
+// time if they are preserved.
+func (s *SFTP) Chmod(src, rel string) error {
+	info, err := s.fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	return s.do(func(c *sftp.Client) error {
+		s.chown(c, s.remote(rel), info)
+		if err := c.Chmod(s.remote(rel), info.Mode().Perm()); err != nil {
+			return err
+		}
+		if !s.preserve.Times {
+			return nil
+		}
+		return c.Chtimes(s.remote(rel), info.ModTime(), info.ModTime())
+	})
+}
+
+// Differs checks if rel is out of date with the source file. Modification times only go down to
+// the second over SFTP, so that's all they are compared to.
+func (s *SFTP) Differs(src, rel string, cmp filehandler.Compare) (bool, error) {
+	if cmp == filehandler.CompareAlways {
+		return true, nil
+	}
+	srcinfo, err := s.fs.Stat(src)
+	if err != nil {
+		return false, err
+	}
+
+	differs := false
+	err = s.do(func(c *sftp.Client) error {
+		desinfo, err := c.Stat(s.remote(rel))
+		if os.IsNotExist(err) {
+			differs = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if srcinfo.IsDir() != desinfo.IsDir() || srcinfo.Size() != desinfo.Size() {
+			differs = true
+			return nil
+		}
+		if cmp != filehandler.CompareHash {
+			differs = !srcinfo.ModTime().Truncate(time.Second).Equal(desinfo.ModTime().Truncate(time.Second))
+			return nil
+		}
+
+		f, err := c.Open(s.remote(rel))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dessum := sha256.New()
+		if _, err := f.WriteTo(dessum); err != nil {
+			return err
+		}
+		srcsum, err := filehandler.New(s.log, s.fs).HashFile(src)
+		if err != nil {
+			return err
+		}
+		differs = !bytes.Equal(srcsum, dessum.Sum(nil))
+		return nil
+	})
+	return differs, err
+}
+
+// Stat returns the info of rel without following symlinks.
+func (s *SFTP) Stat(rel string) (os.FileInfo, error) {
+	var info os.FileInfo
+	err := s.do(func(c *sftp.Client) error {
+		var err error
+		info, err = c.Lstat(s.remote(rel))
+		return err
+	})
+	return info, err
+}
+
+// Walk calls fn for everything under the root.
+func (s *SFTP) Walk(fn func(rel string, info os.FileInfo) error) error {
+	return s.do(func(c *sftp.Client) error {
+		return walk(c, s.root, "", fn)
+	})
+}
+
+// walk calls fn for everything in the directory, parents before their children.
+func walk(c *sftp.Client, root, rel string, fn func(rel string, info os.FileInfo) error) error {
+	infos, err := c.ReadDir(path.Join(root, rel))
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		sub := path.Join(rel, info.Name())
+		if err := fn(sub, info); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if err := walk(c, root, sub, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close gives the destination's connections back, they are closed once no destination on the
+// server uses them.
+func (s *SFTP) Close() error {
+	s.pool.release()
+	return nil
+}
+
+// sftpConn is an SFTP session over its own SSH connection.
+type sftpConn struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+	closed chan struct{}
+}
+
+// lost checks if the operation failed because the connection went away.
+func (c *sftpConn) lost(err error) bool {
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+		return true
+	}
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// alive checks if the connection is still open.
+func (c *sftpConn) alive() bool {
+	select {
+	case <-c.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+// close closes the session and the connection under it.
+func (c *sftpConn) close() {
+	c.client.Close()
+	c.ssh.Close()
+}
+
+// sftpPool holds the idle connections to a single server.
+type sftpPool struct {
+	key    string
+	addr   string
+	config *ssh.ClientConfig
+
+	mu   sync.Mutex
+	idle []*sftpConn
+	refs int
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = make(map[string]*sftpPool)
+)
+
+// getPool returns the pool for the server in the URL, making it if it's the first destination on
+// the server.
+func getPool(u *url.URL) (*sftpPool, error) {
+	port := u.Port()
+	if port == "" {
+		port = sftpPort
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+	key := u.User.Username() + "@" + addr + "?" + u.RawQuery
+
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	p, ok := pools[key]
+	if !ok {
+		config, err := sshConfig(u)
+		if err != nil {
+			return nil, err
+		}
+		p = &sftpPool{key: key, addr: addr, config: config}
+		pools[key] = p
+	}
+	p.mu.Lock()
+	p.refs++
+	p.mu.Unlock()
+	return p, nil
+}
+
+// get returns an idle connection, or a new one when there aren't any.
+func (p *sftpPool) get() (*sftpConn, error) {
+	p.mu.Lock()
+	for len(p.idle) > 0 {
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if c.alive() {
+			p.mu.Unlock()
+			return c, nil
+		}
+		c.close()
+	}
+	p.mu.Unlock()
+	return p.dial()
+}
+
+// put hands the connection back to the pool.
+func (p *sftpPool) put(c *sftpConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !c.alive() || len(p.idle) >= sftpIdle || p.refs == 0 {
+		c.close()
+		return
+	}
+	p.idle = append(p.idle, c)
+}
+
+// release drops a destination's hold on the pool and closes the connections when it was the last.
+func (p *sftpPool) release() {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refs--; p.refs > 0 {
+		return
+	}
+	for _, c := range p.idle {
+		c.close()
+	}
+	p.idle = nil
+	delete(pools, p.key)
+}
+
+// dial opens a new connection to the server and starts an SFTP session on it.
+func (p *sftpPool) dial() (*sftpConn, error) {
+	conn, err := ssh.Dial("tcp", p.addr, p.config)
+	if err != nil {
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			return nil, fmt.Errorf("host key of '%v' can't be verified: %v", p.addr, err)
+		}
+		return nil, fmt.Errorf("%w: connecting to '%v': %v", ErrUnavailable, p.addr, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("starting SFTP on '%v': %v", p.addr, err)
+	}
+	c := &sftpConn{ssh: conn, client: client, closed: make(chan struct{})}
+	go func() {
+		conn.Wait()
+		close(c.closed)
+	}()
+	return c, nil
+}
+
+// sshConfig builds the client configuration for the URL, with the keys it can log in with and the
+// known hosts the server is checked against.
+func sshConfig(u *url.URL) (*ssh.ClientConfig, error) {
+	name := u.User.Username()
+	if name == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		name = current.Username
+	}
+	home, _ := os.UserHomeDir()
+	query := u.Query()
+
+	hostsFile := query.Get("known_hosts")
+	if hostsFile == "" {
+		hostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(hostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %v", err)
+	}
+
+	var signers []ssh.Signer
+	keys := []string{query.Get("key")}
+	if keys[0] == "" {
+		keys = nil
+		for _, key := range defaultKeys {
+			keys = append(keys, filepath.Join(home, ".ssh", key))
+		}
+	}
+	for _, key := range keys {
+		b, err := ioutil.ReadFile(key)
+		if os.IsNotExist(err) && query.Get("key") == "" {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading private key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("reading private key '%v': %v, keys with a passphrase have to be added to the SSH agent", key, err)
+		}
+		signers = append(signers, signer)
+	}
+	auth := []ssh.AuthMethod{ssh.PublicKeys(signers...)}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if len(signers) == 0 && len(auth) == 1 {
+		return nil, fmt.Errorf("no private key or SSH agent to log into '%v' with", u.Host)
+	}
+
+	return &ssh.ClientConfig{
+		User:            name,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         sftpTimeout,
+	}, nil
+}
+
+// randomSuffix returns a random name for a temporary file.
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,286 @@
+// Package destination
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package destination
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshServer is an SSH server with the SFTP subsystem that serves the local file system.
+type sshServer struct {
+	ln     net.Listener
+	config *ssh.ServerConfig
+
+	mu    sync.Mutex
+	conns []net.Conn
+	dials int
+}
+
+// newSSHServer starts a server on a random port that only lets the given key in.
+func newSSHServer(t *testing.T, host ssh.Signer, client ssh.PublicKey) *sshServer {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), client.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(host)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	srv := &sshServer{ln: ln, config: config}
+	go srv.serve()
+	return srv
+}
+
+// serve accepts connections until the listener is closed.
+func (srv *sshServer) serve() {
+	for {
+		nc, err := srv.ln.Accept()
+		if err != nil {
+			return
+		}
+		srv.mu.Lock()
+		srv.conns = append(srv.conns, nc)
+		srv.dials++
+		srv.mu.Unlock()
+		go srv.handle(nc)
+	}
+}
+
+// handle starts an SFTP server for every session on the connection that asks for one.
+func (srv *sshServer) handle(nc net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(nc, srv.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, reqs, err := nch.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range reqs {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(ch)
+				if err != nil {
+					ch.Close()
+					return
+				}
+				go func() {
+					server.Serve()
+					ch.Close()
+				}()
+			}
+		}()
+	}
+}
+
+// drop closes every connection, as if the network went away.
+func (srv *sshServer) drop() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, nc := range srv.conns {
+		nc.Close()
+	}
+	srv.conns = nil
+}
+
+// count returns how many connections were made.
+func (srv *sshServer) count() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.dials
+}
+
+// sftpFixture starts a server and returns it along with a temporary directory holding a source
+// directory, the client's key and its known hosts, and the URL of 'des' in the directory.
+func sftpFixture(t *testing.T) (*sshServer, string, string) {
+	os.Unsetenv("SSH_AUTH_SOCK")
+	dir, err := ioutil.TempDir("", "sftp")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	host, _ := ssh.NewSignerFromKey(hostKey)
+	clientPub, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+	client, _ := ssh.NewPublicKey(clientPub)
+	srv := newSSHServer(t, host, client)
+
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatalf("Error marshalling key: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "id_ed25519"), pem.EncodeToMemory(block), 0600)
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.ln.Addr().String())}, host.PublicKey())
+	ioutil.WriteFile(filepath.Join(dir, "known_hosts"), []byte(line+"\n"), 0600)
+
+	os.MkdirAll(filepath.Join(dir, "src", "sub"), 0750)
+	ioutil.WriteFile(filepath.Join(dir, "src", "sub", "test.txt"), []byte("test"), 0640)
+
+	query := url.Values{"key": {filepath.Join(dir, "id_ed25519")}, "known_hosts": {filepath.Join(dir, "known_hosts")}}
+	u := url.URL{Scheme: "sftp", User: url.User("tester"), Host: srv.ln.Addr().String(), Path: filepath.Join(dir, "des"), RawQuery: query.Encode()}
+	return srv, dir, u.String()
+}
+
+func TestSFTP(t *testing.T) {
+	srv, dir, u := sftpFixture(t)
+	defer os.RemoveAll(dir)
+	defer srv.ln.Close()
+	src := filepath.Join(dir, "src", "sub", "test.txt")
+
+	des, err := Open(u, Options{})
+	if err != nil {
+		t.Fatalf("Error opening destination: %v", err)
+	}
+	defer des.Close()
+	if _, err := os.Stat(filepath.Join(dir, "des")); err != nil {
+		t.Errorf("Expected the destination to be created: %v", err)
+	}
+
+	if differs, _ := des.Differs(src, "sub/test.txt", filehandler.CompareSize); !differs {
+		t.Errorf("Expected a missing file to differ.")
+	}
+	if err := des.CopyFile(src, "sub/test.txt"); err != nil {
+		t.Fatalf("Error copying file: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "des", "sub", "test.txt")); string(b) != "test" {
+		t.Errorf("Expected the file to be copied, got '%s'", b)
+	}
+	if info, err := des.Stat("sub"); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Expected the directory to have the source's mode got %v (%v)", info, err)
+	}
+	for _, cmp := range []filehandler.Compare{filehandler.CompareSize, filehandler.CompareHash} {
+		if differs, err := des.Differs(src, "sub/test.txt", cmp); differs || err != nil {
+			t.Errorf("Expected the copy not to differ by %v (%v)", cmp, err)
+		}
+	}
+
+	// writing over the file replaces it
+	ioutil.WriteFile(src, []byte("changed"), 0600)
+	os.Chmod(src, 0600)
+	os.Chtimes(src, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	if err := des.CopyFile(src, "sub/test.txt"); err != nil {
+		t.Fatalf("Error copying file again: %v", err)
+	}
+	if info, _ := des.Stat("sub/test.txt"); info.Mode().Perm() != 0600 || info.Size() != 7 {
+		t.Errorf("Expected the file to be replaced got %v", info)
+	}
+
+	if err := des.Rename("sub", "moved"); err != nil {
+		t.Fatalf("Error renaming: %v", err)
+	}
+	var walked []string
+	des.Walk(func(rel string, info os.FileInfo) error {
+		walked = append(walked, rel)
+		return nil
+	})
+	if strings.Join(walked, ",") != "moved,moved/test.txt" {
+		t.Errorf("Expected to walk the renamed directory got %v", walked)
+	}
+
+	if err := des.RemoveAll("."); err != filehandler.ErrOutsideRoot {
+		t.Errorf("Expected '%v' removing the root got '%v'", filehandler.ErrOutsideRoot, err)
+	}
+	if err := des.RemoveAll("moved"); err != nil {
+		t.Errorf("Error removing directory: %v", err)
+	}
+	if _, err := des.Stat("moved"); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory to be removed got %v", err)
+	}
+	if srv.count() != 1 {
+		t.Errorf("Expected a single connection to be reused, got %v", srv.count())
+	}
+}
+
+func TestSFTPReconnect(t *testing.T) {
+	srv, dir, u := sftpFixture(t)
+	defer os.RemoveAll(dir)
+	defer srv.ln.Close()
+	src := filepath.Join(dir, "src", "sub", "test.txt")
+
+	des, err := Open(u, Options{})
+	if err != nil {
+		t.Fatalf("Error opening destination: %v", err)
+	}
+	// a second destination on the same server shares the connection
+	other, err := Open(strings.Replace(u, "/des?", "/other?", 1), Options{})
+	if err != nil {
+		t.Fatalf("Error opening second destination: %v", err)
+	}
+	if srv.count() != 1 {
+		t.Errorf("Expected the destinations to share a connection, got %v", srv.count())
+	}
+	other.Close()
+
+	srv.drop()
+	if err := des.CopyFile(src, "sub/test.txt"); err != nil {
+		t.Fatalf("Expected the copy to reconnect, got %v", err)
+	}
+	if srv.count() != 2 {
+		t.Errorf("Expected a new connection, got %v", srv.count())
+	}
+
+	des.Close()
+	srv.ln.Close()
+	if _, err := Open(u, Options{}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected '%v' opening a destination on a server that is down, got %v", ErrUnavailable, err)
+	}
+}
+
+func TestSFTPHostKey(t *testing.T) {
+	srv, dir, u := sftpFixture(t)
+	defer os.RemoveAll(dir)
+	defer srv.ln.Close()
+
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(other)
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.ln.Addr().String())}, signer.PublicKey())
+	ioutil.WriteFile(filepath.Join(dir, "known_hosts"), []byte(line+"\n"), 0600)
+
+	if _, err := Open(u, Options{}); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected an error opening a destination with the wrong host key, got %v", err)
+	}
+	if srv.count() != 1 {
+		t.Errorf("Expected a single connection attempt, got %v", srv.count())
+	}
+	if _, err := Parse(strings.Replace(u, "tester@", "tester:secret@", 1)); err != nil {
+		t.Fatalf("Error parsing URL with a password: %v", err)
+	}
+	if _, err := Open(strings.Replace(u, "tester@", "tester:secret@", 1), Options{}); err == nil {
+		t.Errorf("Expected an error opening a destination with a password.")
+	}
+}
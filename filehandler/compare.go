@@ -0,0 +1,90 @@
+// Package filehandler
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filehandler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Compare is the strategy used to decide if a file needs to be copied.
+type Compare string
+
+const (
+	// CompareSize copies files when their size or modification time differ.
+	CompareSize Compare = "size"
+	// CompareHash copies files when the SHA-256 hashes of their contents differ.
+	CompareHash Compare = "hash"
+	// CompareAlways always copies files.
+	CompareAlways Compare = "always"
+)
+
+// ParseCompare checks the name of a comparison strategy, an empty name is CompareSize.
+func ParseCompare(name string) (Compare, error) {
+	switch c := Compare(name); c {
+	case "":
+		return CompareSize, nil
+	case CompareSize, CompareHash, CompareAlways:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown comparison '%v'", name)
+}
+
+// Differs checks if the destination file is out of date with the source file using the given
+// strategy. A destination that doesn't exist always differs.
+func (h *Handler) Differs(srcfp, desfp string, cmp Compare) (bool, error) {
+	if cmp == CompareAlways {
+		return true, nil
+	}
+
+	h.log.Debug("Comparing '%v' and '%v' by %v.", srcfp, desfp, cmp)
+	src, err := h.fs.Stat(srcfp)
+	if err != nil {
+		return false, err
+	}
+	des, err := h.fs.Stat(desfp)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if src.IsDir() != des.IsDir() || src.Size() != des.Size() {
+		return true, nil
+	}
+	if cmp != CompareHash {
+		return !src.ModTime().Equal(des.ModTime()), nil
+	}
+
+	srcsum, err := h.HashFile(srcfp)
+	if err != nil {
+		return false, err
+	}
+	dessum, err := h.HashFile(desfp)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(srcsum, dessum), nil
+}
+
+// HashFile returns the SHA-256 hash of the contents of the file.
+func (h *Handler) HashFile(fp string) ([]byte, error) {
+	f, err := h.fs.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return nil, err
+	}
+	return sum.Sum(nil), nil
+}
@@ -0,0 +1,68 @@
+// Package filehandler
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filehandler
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDiffers(t *testing.T) {
+	src := "testdir/testsrc/compare.txt"
+	des := "testdir/testdes/compare.txt"
+	defer os.Remove(src)
+	defer os.Remove(des)
+	ioutil.WriteFile(src, []byte("Some content"), 0644)
+
+	for _, cmp := range []Compare{CompareSize, CompareHash, CompareAlways} {
+		if differs, err := fh.Differs(src, des, cmp); err != nil || !differs {
+			t.Errorf("Expected a missing destination to differ by %v, got %v: %v", cmp, differs, err)
+		}
+	}
+
+	fh.CopyFile(src, des)
+	tests := map[Compare]bool{CompareSize: false, CompareHash: false, CompareAlways: true}
+	for cmp, expected := range tests {
+		if differs, err := fh.Differs(src, des, cmp); err != nil || differs != expected {
+			t.Errorf("Expected a copied file to differ by %v to be %v, got %v: %v", cmp, expected, differs, err)
+		}
+	}
+
+	// same size and contents but a different modification time
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(des, later, later)
+	tests = map[Compare]bool{CompareSize: true, CompareHash: false}
+	for cmp, expected := range tests {
+		if differs, _ := fh.Differs(src, des, cmp); differs != expected {
+			t.Errorf("Expected a touched file to differ by %v to be %v, got %v", cmp, expected, differs)
+		}
+	}
+
+	// same size and modification time but different contents
+	info, _ := os.Stat(src)
+	ioutil.WriteFile(des, []byte("Some CONTENT"), 0644)
+	os.Chtimes(des, info.ModTime(), info.ModTime())
+	tests = map[Compare]bool{CompareSize: false, CompareHash: true}
+	for cmp, expected := range tests {
+		if differs, _ := fh.Differs(src, des, cmp); differs != expected {
+			t.Errorf("Expected a changed file to differ by %v to be %v, got %v", cmp, expected, differs)
+		}
+	}
+}
+
+func TestParseCompare(t *testing.T) {
+	if cmp, err := ParseCompare(""); err != nil || cmp != CompareSize {
+		t.Errorf("Expected the default comparison to be %v got %v: %v", CompareSize, cmp, err)
+	}
+	if cmp, err := ParseCompare("hash"); err != nil || cmp != CompareHash {
+		t.Errorf("Expected %v got %v: %v", CompareHash, cmp, err)
+	}
+	if _, err := ParseCompare("vibes"); err == nil {
+		t.Errorf("Expected an error parsing an unknown comparison.")
+	}
+}
@@ -0,0 +1,307 @@
+// Package filehandler
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filehandler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// DeltaMinSize is the size from which files are updated with a delta, smaller ones are
+	// copied whole since it isn't worth it.
+	DeltaMinSize = 1 << 20
+	// minBlock and maxBlock bound the size of the blocks files are compared in.
+	minBlock = 2 << 10
+	maxBlock = 128 << 10
+	// rollMod is the modulus of the halves of the rolling checksum.
+	rollMod = 1 << 16
+)
+
+// ErrDeltaMismatch is returned when a file updated with a delta doesn't have the contents of the
+// source afterwards, which takes two blocks with the same checksums and different data.
+var ErrDeltaMismatch = errors.New("the file doesn't match the source after applying the delta")
+
+// blockSize returns the size of the blocks a file is compared in, which grows with the square
+// root of its size like rsync's.
+func blockSize(size int64) int {
+	bs := int(math.Sqrt(float64(size))) &^ 7
+	if bs < minBlock {
+		return minBlock
+	}
+	if bs > maxBlock {
+		return maxBlock
+	}
+	return bs
+}
+
+// weakSum is rsync's rolling checksum of a block, which can be moved along by a byte at a time.
+// The halves are kept modulo 1<<16, which overflowing a uint32 doesn't change.
+type weakSum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newWeakSum(block []byte) weakSum {
+	var a, b uint64
+	for i, c := range block {
+		a += uint64(c)
+		b += uint64(len(block)-i) * uint64(c)
+	}
+	return weakSum{a: uint32(a % rollMod), b: uint32(b % rollMod), n: uint32(len(block))}
+}
+
+// roll moves the block along by a byte, dropping out and taking in.
+func (w *weakSum) roll(out, in byte) {
+	w.a = (w.a - uint32(out) + uint32(in)) % rollMod
+	w.b = (w.b - w.n*uint32(out) + w.a) % rollMod
+}
+
+func (w weakSum) sum() uint32 {
+	return w.a | w.b<<16
+}
+
+// block is the checksums of a block of the destination file.
+type block struct {
+	off    int64
+	size   int
+	strong [sha256.Size]byte
+}
+
+// Signature holds the checksums of the blocks of a destination file, which is all a delta needs
+// to know about it.
+type Signature struct {
+	blockSize int
+	size      int64
+	blocks    map[uint32][]block
+	// tags has a bit set for the weak checksums of the blocks, which is much quicker to check on
+	// every byte of the source than the map, like rsync's tag table.
+	tags []uint64
+}
+
+// tag returns the bit in the tags for the weak checksum.
+func tag(weak uint32) uint32 {
+	return (weak * 0x9e3779b1) >> 12
+}
+
+// Sign reads the destination file, which is size bytes long, and returns its Signature.
+func Sign(r io.Reader, size int64) (*Signature, error) {
+	sig := &Signature{blockSize: blockSize(size), blocks: make(map[uint32][]block), tags: make([]uint64, 1<<20/64)}
+	br := bufio.NewReaderSize(r, maxBlock)
+	buf := make([]byte, sig.blockSize)
+	for {
+		n, err := io.ReadFull(br, buf)
+		if n > 0 {
+			b := block{off: sig.size, size: n, strong: sha256.Sum256(buf[:n])}
+			weak := newWeakSum(buf[:n]).sum()
+			sig.blocks[weak] = append(sig.blocks[weak], b)
+			sig.tags[tag(weak)/64] |= 1 << (tag(weak) % 64)
+			sig.size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// find returns the block of the destination with the data, trying the one at the offset first
+// since that one doesn't have to be written at all.
+func (sig *Signature) find(weak uint32, data []byte, off int64) (block, bool) {
+	candidates := sig.blocks[weak]
+	if len(candidates) == 0 {
+		return block{}, false
+	}
+	strong := sha256.Sum256(data)
+	found, ok := block{}, false
+	for _, b := range candidates {
+		if b.size == len(data) && b.strong == strong {
+			if b.off == off {
+				return b, true
+			}
+			found, ok = b, true
+		}
+	}
+	return found, ok
+}
+
+// DeltaOp is a range of the source. Basis is where the same data is in the destination, or -1
+// when it isn't anywhere in it.
+type DeltaOp struct {
+	Off   int64
+	Len   int64
+	Basis int64
+}
+
+// Delta is how the destination file a Signature is of differs from the source.
+type Delta struct {
+	Ops []DeltaOp
+	// Size is the size of the source, and Sum its SHA-256 hash.
+	Size int64
+	Sum  []byte
+}
+
+// ComputeDelta reads the source and finds the blocks of the destination in it with a rolling
+// checksum, wherever they are.
+func ComputeDelta(sig *Signature, src io.Reader) (*Delta, error) {
+	h := sha256.New()
+	r := bufio.NewReaderSize(io.TeeReader(src, h), maxBlock)
+	d := &Delta{}
+	bs := sig.blockSize
+
+	// data holds the source from base on, the window being checked starts at pos and the data
+	// that isn't in the destination starts at lit
+	var data []byte
+	var base, pos, lit int64
+	eof := false
+	chunk := make([]byte, 64<<10)
+	fill := func(n int) error {
+		// what's behind the window is only dropped now and then, not on every byte
+		if drop := int(pos - base); drop >= 1<<20 {
+			data = append(data[:0], data[drop:]...)
+			base = pos
+		}
+		for !eof && len(data)-int(pos-base) < n {
+			read, err := r.Read(chunk)
+			data = append(data, chunk[:read]...)
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	literal := func() {
+		if pos > lit {
+			d.add(DeltaOp{Off: lit, Len: pos - lit, Basis: -1})
+		}
+	}
+
+	var weak weakSum
+	fresh := true
+	for {
+		if i := int(pos - base); i+bs >= len(data) {
+			if err := fill(bs + 1); err != nil {
+				return nil, err
+			}
+		}
+		i := int(pos - base)
+		end := i + bs
+		if end > len(data) {
+			end = len(data)
+		}
+		window := data[i:end]
+		if len(window) == 0 {
+			break
+		}
+		if fresh {
+			weak, fresh = newWeakSum(window), false
+		}
+		if t := tag(weak.sum()); sig.tags[t/64]&(1<<(t%64)) != 0 {
+			if b, ok := sig.find(weak.sum(), window, pos); ok {
+				literal()
+				d.add(DeltaOp{Off: pos, Len: int64(len(window)), Basis: b.off})
+				pos += int64(len(window))
+				lit, fresh = pos, true
+				continue
+			}
+		}
+		if len(window) < bs {
+			// the tail is shorter than a block, nothing further on can match
+			pos += int64(len(window))
+			break
+		}
+		if end < len(data) {
+			weak.roll(window[0], data[end])
+		} else {
+			weak = newWeakSum(data[i+1 : end])
+		}
+		pos++
+	}
+	literal()
+	d.Size = pos
+	d.Sum = h.Sum(nil)
+	return d, nil
+}
+
+// add appends the op, merging it into the last one when they follow on from each other.
+func (d *Delta) add(op DeltaOp) {
+	if n := len(d.Ops); n > 0 {
+		last := &d.Ops[n-1]
+		if last.Off+last.Len == op.Off && (last.Basis < 0 && op.Basis < 0 || last.Basis >= 0 && last.Basis+last.Len == op.Basis) {
+			last.Len += op.Len
+			return
+		}
+	}
+	d.Ops = append(d.Ops, op)
+}
+
+// Written returns how much of the source has to be written when the destination is patched in
+// place, which is everything that isn't where it is in the destination already.
+func (d *Delta) Written() int64 {
+	var n int64
+	for _, op := range d.Ops {
+		if op.Basis != op.Off {
+			n += op.Len
+		}
+	}
+	return n
+}
+
+// PatchTarget is a destination file a delta is applied to.
+type PatchTarget interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+}
+
+// Patch applies the delta to the destination file in place. Only the ranges that aren't in the
+// same place in it already are written, from the source, and the file is cut to the size of the
+// source. Blocks that moved are written again too, since the ones they'd be copied from in the
+// file may already have been written over, like rsync does with --inplace.
+func (d *Delta) Patch(to PatchTarget, from io.ReadSeeker, progress *Progress) error {
+	for _, op := range d.Ops {
+		if op.Basis == op.Off {
+			continue
+		}
+		if _, err := from.Seek(op.Off, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := to.Seek(op.Off, io.SeekStart); err != nil {
+			return err
+		}
+		n, err := io.CopyN(to, from, op.Len)
+		progress.Add(n)
+		if err != nil {
+			return err
+		}
+	}
+	return to.Truncate(d.Size)
+}
+
+// Verify reads the patched file and checks it has the contents of the source.
+func (d *Delta) Verify(r io.Reader) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), d.Sum) {
+		return ErrDeltaMismatch
+	}
+	return nil
+}
+
+// String sums up the delta for the logs.
+func (d *Delta) String() string {
+	return fmt.Sprintf("%v of %v to write in %d ranges", FormatSize(d.Written()), FormatSize(d.Size), len(d.Ops))
+}
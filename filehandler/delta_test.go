@@ -0,0 +1,180 @@
+// Package filehandler
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filehandler
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// randomData returns n bytes that don't repeat, seeded so the tests are the same every time.
+func randomData(n int, seed int64) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestWeakSumRoll(t *testing.T) {
+	data := randomData(4096, 1)
+	w := newWeakSum(data[:1024])
+	for i := 0; i+1024 < len(data); i++ {
+		w.roll(data[i], data[i+1024])
+		if expected := newWeakSum(data[i+1 : i+1025]); w.sum() != expected.sum() {
+			t.Fatalf("Expected the rolled checksum at %d to be %x got %x", i+1, expected.sum(), w.sum())
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	basis := randomData(1<<20, 2)
+	bs := int64(blockSize(int64(len(basis))))
+
+	changed := append([]byte{}, basis...)
+	changed[300000] ^= 0xff
+	inserted := append(append(append([]byte{}, basis[:500000]...), []byte("inserted")...), basis[500000:]...)
+	tests := map[string]struct {
+		src     []byte
+		written int64
+	}{
+		"same":      {basis, 0},
+		"changed":   {changed, bs},
+		"appended":  {append(append([]byte{}, basis...), []byte("more")...), bs},
+		"truncated": {basis[:700000], bs},
+		"inserted":  {inserted, int64(len(inserted)) - 500000/bs*bs},
+		"new":       {randomData(1<<20, 3), 1 << 20},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sig, err := Sign(bytes.NewReader(basis), int64(len(basis)))
+			if err != nil {
+				t.Fatalf("Error signing: %v", err)
+			}
+			delta, err := ComputeDelta(sig, bytes.NewReader(test.src))
+			if err != nil {
+				t.Fatalf("Error computing delta: %v", err)
+			}
+			if delta.Size != int64(len(test.src)) {
+				t.Errorf("Expected the source to be %d bytes got %d", len(test.src), delta.Size)
+			}
+			if written := delta.Written(); written > test.written {
+				t.Errorf("Expected at most %d bytes to be written got %d (%v)", test.written, written, delta)
+			}
+
+			mem := vfs.NewMem()
+			vfs.WriteFile(mem, "des", basis, 0644)
+			vfs.WriteFile(mem, "src", test.src, 0644)
+			to, _ := mem.OpenFile("des", os.O_RDWR, 0)
+			from, _ := mem.Open("src")
+			defer from.Close()
+			if err := delta.Patch(to, from, nil); err != nil {
+				t.Fatalf("Error patching: %v", err)
+			}
+			to.Close()
+			if b, _ := vfs.ReadFile(mem, "des"); !bytes.Equal(b, test.src) {
+				t.Errorf("Expected the patched file to match the source.")
+			}
+			f, _ := mem.Open("des")
+			defer f.Close()
+			if err := delta.Verify(f); err != nil {
+				t.Errorf("Error verifying: %v", err)
+			}
+			if err := delta.Verify(bytes.NewReader(basis[:10])); err != ErrDeltaMismatch {
+				t.Errorf("Expected '%v' verifying other contents got '%v'", ErrDeltaMismatch, err)
+			}
+		})
+	}
+}
+
+func TestCopyDelta(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src", 0755)
+	data := randomData(2<<20, 4)
+	vfs.WriteFile(mem, "src/large", data, 0644)
+
+	l := &lines{Logger: logging.Discard}
+	h := New(l, mem)
+	h.Delta = true
+	if err := h.CopyFile("src/large", "des/large"); err != nil {
+		t.Fatalf("Error copying: %v", err)
+	}
+	if len(l.logged) != 0 {
+		t.Errorf("Expected a new file to be copied whole got %q", l.logged)
+	}
+
+	data[1<<20] ^= 0xff
+	vfs.WriteFile(mem, "src/large", data, 0644)
+	mem.Chmod("src/large", 0600)
+	if err := h.CopyFile("src/large", "des/large"); err != nil {
+		t.Fatalf("Error updating: %v", err)
+	}
+	if len(l.logged) != 1 || !strings.Contains(l.logged[0], "with a delta") {
+		t.Errorf("Expected the file to be updated with a delta got %q", l.logged)
+	}
+	if b, _ := vfs.ReadFile(mem, "des/large"); !bytes.Equal(b, data) {
+		t.Errorf("Expected the destination to match the source.")
+	}
+	src, _ := mem.Stat("src/large")
+	des, _ := mem.Stat("des/large")
+	if des.Mode() != 0600 || !des.ModTime().Equal(src.ModTime()) {
+		t.Errorf("Expected the mode and modification time to be copied got %v and %v", des.Mode(), des.ModTime())
+	}
+	files, _ := mem.ReadDir("des")
+	if len(files) != 1 {
+		t.Errorf("Expected the patched copy to be renamed over the destination got %v files", len(files))
+	}
+}
+
+// failingFile fails reads once it has been seeked, which is when a delta is being patched in.
+type failingFile struct {
+	vfs.File
+	seeked bool
+}
+
+func (f *failingFile) Seek(offset int64, whence int) (int64, error) {
+	f.seeked = true
+	return f.File.Seek(offset, whence)
+}
+
+func (f *failingFile) Read(b []byte) (int, error) {
+	if f.seeked {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return f.File.Read(b)
+}
+
+func TestCopyDeltaFails(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src", 0755)
+	vfs.MkdirAll(mem, "des", 0755)
+	old := randomData(2<<20, 5)
+	vfs.WriteFile(mem, "des/large", old, 0644)
+	data := append([]byte{}, old...)
+	data[1<<20] ^= 0xff
+	vfs.WriteFile(mem, "src/large", data, 0644)
+
+	h := New(logging.Discard, mem)
+	h.Delta = true
+	f, _ := mem.Open("src/large")
+	defer f.Close()
+	info, _ := f.Stat()
+	from := &failingFile{File: f}
+	if updated, err := h.copyDelta(from, "des/large", info); updated || err != nil {
+		t.Errorf("Expected a failed patch to fall back to a whole copy got %v: %v", updated, err)
+	}
+	if b, _ := vfs.ReadFile(mem, "des/large"); !bytes.Equal(b, old) {
+		t.Errorf("Expected a failed patch to leave the destination alone.")
+	}
+	if files, _ := mem.ReadDir("des"); len(files) != 1 {
+		t.Errorf("Expected the temporary copy to be removed got %v files", len(files))
+	}
+}
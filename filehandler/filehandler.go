@@ -6,110 +6,452 @@
 package filehandler
 
 import (
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
-	"github.com/KaiserGald/logger"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
 )
 
-var l *logger.Logger
+// ErrOutsideRoot is returned when a path that is about to be removed isn't inside the root it
+// belongs to.
+var ErrOutsideRoot = errors.New("path is outside of the root")
 
-// Init initializes the filehandler.
-func Init(lg *logger.Logger) {
-	l = lg
+// Handler copies, renames and removes the files of a mirror, logging what it does.
+type Handler struct {
+	log logging.Logger
+	fs  vfs.FS
+	// InPlace makes CopyFile write straight into the destination file instead of renaming a
+	// temporary file over it.
+	InPlace bool
+	// Preserve is the metadata copied along with the mode, on every copy and directory creation.
+	Preserve Preserve
+	// ProgressSize is the size from which the progress of copying a file is logged, nothing is
+	// logged when it's 0.
+	ProgressSize int64
+	// Delta updates files that are already in the destination by writing only the parts of them
+	// that changed, in place, for files of at least DeltaMinSize.
+	Delta bool
+
+	mu sync.Mutex
+	// unsupported is the metadata that was given up on since the file system can't hold it.
+	unsupported map[string]bool
+}
+
+// New returns a Handler that works on the given file system and logs to the given logger. A nil
+// file system is the OS and a nil logger discards everything.
+func New(lg logging.Logger, fsys vfs.FS) *Handler {
+	if lg == nil {
+		lg = logging.Discard
+	}
+	if fsys == nil {
+		fsys = vfs.OS
+	}
+	return &Handler{log: lg, fs: fsys}
 }
 
-// CopyFile will copy the supplied file to the supplied destination
-func CopyFile(srcfp, desfp string) error {
+// FS returns the file system the handler works on.
+func (h *Handler) FS() vfs.FS {
+	return h.fs
+}
 
-	l.Debug.Log("Copying directory '%v' to '%v'.", srcfp, desfp)
-	err := CopyDir(srcfp, desfp)
+// CopyFile will copy the supplied file to the supplied destination. The file is written to a
+// temporary file next to the destination, synced, given the mode and modification time of the
+// source and then renamed over the destination, so the destination is never half written.
+func (h *Handler) CopyFile(srcfp, desfp string) error {
+
+	h.log.Debug("Copying directory '%v' to '%v'.", srcfp, desfp)
+	err := h.CopyDir(srcfp, desfp)
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("Done copying directory.")
+	h.log.Debug("Done copying directory.")
 
-	l.Debug.Log("Getting source file info.")
-	info, err := os.Stat(srcfp)
+	h.log.Debug("Getting source file info.")
+	info, err := h.fs.Stat(srcfp)
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("Done.")
+	h.log.Debug("Done.")
 
-	l.Debug.Log("Opening '%v'.", srcfp)
-	from, err := os.Open(srcfp)
+	h.log.Debug("Opening '%v'.", srcfp)
+	from, err := h.fs.Open(srcfp)
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("'%v' successfully opened!", srcfp)
+	h.log.Debug("'%v' successfully opened!", srcfp)
 	defer from.Close()
 
-	l.Debug.Log("Begin file copy...")
-	to := &os.File{}
-	l.Debug.Log("Checking if '%v' exists...", desfp)
-	if ok := pathExists(desfp); !ok {
-		l.Notice.Log("File '%s' doesn't exist, creating it now...", desfp)
-		to, err = os.Create(desfp)
-		if err != nil {
+	h.log.Debug("Begin file copy...")
+	h.log.Debug("Checking if '%v' exists...", desfp)
+	if ok := h.pathExists(desfp); !ok {
+		h.log.Notice("File '%s' doesn't exist, creating it now...", desfp)
+	} else {
+		h.log.Debug("File already exists.")
+	}
+
+	updated := false
+	if h.Delta && info.Size() >= DeltaMinSize {
+		if updated, err = h.copyDelta(from, desfp, info); err != nil {
 			return err
 		}
-		l.Debug.Log("File '%v' successfully created.", desfp)
-	} else {
-		l.Debug.Log("File already exists.")
-		l.Debug.Log("Opening file '%v'.", desfp)
-		to, err = os.OpenFile(desfp, os.O_RDWR|os.O_CREATE, info.Mode())
+	}
+	switch {
+	case updated:
+	case h.InPlace:
+		err = h.copyInPlace(from, desfp, info)
+	default:
+		err = h.copyAtomic(from, desfp, info)
+	}
+	if err != nil {
+		return err
+	}
+	if err := h.copyDirTimes(srcfp, desfp); err != nil {
+		return err
+	}
+	h.log.Debug("File copy done.")
+
+	return nil
+}
+
+// copyAtomic copies the file into a temporary file in the destination directory and then
+// renames it into place.
+func (h *Handler) copyAtomic(from vfs.File, desfp string, info os.FileInfo) (err error) {
+	h.log.Debug("Creating temporary file for '%v'.", desfp)
+	to, err := vfs.TempFile(h.fs, filepath.Dir(desfp), "."+filepath.Base(desfp)+".mimic-")
+	if err != nil {
+		return err
+	}
+	tmp := to.Name()
+	defer func() {
 		if err != nil {
+			to.Close()
+			h.fs.Remove(tmp)
+		}
+	}()
+	h.log.Debug("Temporary file '%v' successfully created.", tmp)
+
+	h.log.Debug("Copying file '%v' to '%v'.", from.Name(), tmp)
+	if err = h.copyData(to, from, info.Size()); err != nil {
+		return err
+	}
+	if err = to.Sync(); err != nil {
+		return err
+	}
+	if err = to.Close(); err != nil {
+		return err
+	}
+	h.log.Debug("File successfully copied.")
+
+	h.log.Debug("Applying mode, modification time and preserved metadata.")
+	if err = h.copyMeta(from.Name(), tmp, info); err != nil {
+		return err
+	}
+	// files always keep their modification time, it's how they are compared
+	if !h.Preserve.Times {
+		if err = h.fs.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
 			return err
 		}
-		l.Debug.Log("File '%v' successfully opened!", desfp)
 	}
-	l.Debug.Log("Copying file '%v' to '%v'.", srcfp, desfp)
-	_, err = io.Copy(to, from)
+
+	h.log.Debug("Renaming '%v' to '%v'.", tmp, desfp)
+	return h.fs.Rename(tmp, desfp)
+}
+
+// copyInPlace truncates the destination and writes the file straight into it, for file systems
+// that don't handle the rename well.
+func (h *Handler) copyInPlace(from vfs.File, desfp string, info os.FileInfo) error {
+	h.log.Debug("Opening file '%v'.", desfp)
+	to, err := h.fs.OpenFile(desfp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("File successfully copied.")
 	defer to.Close()
-	l.Debug.Log("File copy done.")
+	h.log.Debug("File '%v' successfully opened!", desfp)
+
+	h.log.Debug("Copying file '%v' to '%v'.", from.Name(), desfp)
+	if err := h.copyData(to, from, info.Size()); err != nil {
+		return err
+	}
+	h.log.Debug("File successfully copied.")
+	if err := to.Close(); err != nil {
+		return err
+	}
+	if h.Preserve != (Preserve{}) {
+		h.log.Debug("Applying preserved metadata.")
+		if err := h.copyMeta(from.Name(), desfp, info); err != nil {
+			return err
+		}
+	}
+	// files always keep their modification time, it's how they are compared
+	if !h.Preserve.Times {
+		return h.fs.Chtimes(desfp, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// copyDelta updates the destination file, if there is one, by writing only the parts of the source
+// that aren't in it already. Unless files are written in place, the delta is applied to a copy of
+// the destination, a clone where the file system can, that is renamed over it once it matches the
+// source, so the destination is never half patched. It returns false if the file has to be copied
+// whole instead, which is also the case when patching fails or it doesn't match the source
+// afterwards.
+func (h *Handler) copyDelta(from vfs.File, desfp string, info os.FileInfo) (updated bool, err error) {
+	desinfo, err := h.fs.Stat(desfp)
+	if err != nil || !desinfo.Mode().IsRegular() {
+		return false, nil
+	}
+	h.log.Debug("Opening file '%v'.", desfp)
+	des, err := h.fs.OpenFile(desfp, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer des.Close()
+
+	h.log.Debug("Reading the blocks of '%v'.", desfp)
+	sig, err := Sign(des, desinfo.Size())
+	if err != nil {
+		return false, err
+	}
+	h.log.Debug("Comparing '%v' with them.", from.Name())
+	delta, err := ComputeDelta(sig, from)
+	if err != nil {
+		return false, err
+	}
+	h.log.Info("Updating '%v' with a delta, %v.", desfp, delta)
+
+	to, target := des, desfp
+	if !h.InPlace {
+		h.log.Debug("Copying '%v' to a temporary file to patch.", desfp)
+		if to, err = vfs.TempFile(h.fs, filepath.Dir(desfp), "."+filepath.Base(desfp)+".mimic-"); err != nil {
+			return false, err
+		}
+		target = to.Name()
+		defer func() {
+			if !updated {
+				to.Close()
+				h.fs.Remove(target)
+			}
+		}()
+		if _, err := des.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		if err := h.copyData(to, des, desinfo.Size()); err != nil {
+			return false, err
+		}
+	}
+
+	progress := NewProgress(h.log, from.Name(), delta.Written(), h.ProgressSize)
+	if err := delta.Patch(to, from, progress); err != nil {
+		h.log.Notice("Error updating '%v' with a delta, copying it whole: %v", desfp, err)
+		return false, nil
+	}
+	progress.Done()
+	if err := to.Sync(); err != nil {
+		return false, err
+	}
+
+	h.log.Debug("Checking '%v' against the source.", target)
+	if _, err := to.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	if err := delta.Verify(to); err == ErrDeltaMismatch {
+		h.log.Notice("'%v' doesn't match '%v' after updating it with a delta, copying it whole.", desfp, from.Name())
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := to.Close(); err != nil {
+		return false, err
+	}
+
+	h.log.Debug("Applying mode, modification time and preserved metadata.")
+	if err := h.copyMeta(from.Name(), target, info); err != nil {
+		return false, err
+	}
+	if !h.Preserve.Times {
+		if err := h.fs.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+			return false, err
+		}
+	}
+	if target != desfp {
+		h.log.Debug("Renaming '%v' to '%v'.", target, desfp)
+		if err := h.fs.Rename(target, desfp); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// copyChunk is how much of a file is copied at a time, so the progress of large copies can be
+// logged along the way.
+const copyChunk = 8 << 20
+
+// copyData copies the contents of from, which is size bytes long, into to, which is empty. The
+// file is cloned when the file system can share the data between them. Otherwise only the parts
+// that hold data are copied, so the holes in a sparse file stay holes. io.Copy uses
+// copy_file_range between files of the OS, so the data doesn't pass through mimic either.
+func (h *Handler) copyData(to, from vfs.File, size int64) error {
+	err := vfs.Clone(to, from)
+	if err == nil {
+		h.log.Debug("Cloned '%v' into '%v'.", from.Name(), to.Name())
+		return nil
+	}
+	h.log.Debug("Can't clone '%v', copying it: %v", from.Name(), err)
+
+	progress := NewProgress(h.log, from.Name(), size, h.ProgressSize)
+	for _, e := range vfs.Extents(from, size) {
+		h.log.Debug("Copying %d bytes at %d of '%v'.", e.Len, e.Off, from.Name())
+		if err := seekBoth(to, from, e.Off); err != nil {
+			return err
+		}
+		n, err := copyChunks(to, from, e.Len, progress)
+		if err == io.EOF {
+			h.log.Debug("'%v' shrank while it was being copied.", from.Name())
+			progress.Done()
+			return to.Truncate(e.Off + n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// whatever was added since the file was looked at is copied as well, and a hole at the end
+	// only counts once the size is set
+	if err := seekBoth(to, from, size); err != nil {
+		return err
+	}
+	n, err := copyChunks(to, from, -1, progress)
+	if err != nil {
+		return err
+	}
+	progress.Done()
+	return to.Truncate(size + n)
+}
+
+// seekBoth moves both files to the offset.
+func seekBoth(to, from vfs.File, off int64) error {
+	if _, err := from.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := to.Seek(off, io.SeekStart)
+	return err
+}
 
+// copyChunks copies n bytes, or everything that's left when n is negative, from one file to the
+// other a chunk at a time. It returns io.EOF if there were fewer than n bytes.
+func copyChunks(to, from vfs.File, n int64, progress *Progress) (int64, error) {
+	var copied int64
+	for n < 0 || copied < n {
+		chunk := int64(copyChunk)
+		if n >= 0 && n-copied < chunk {
+			chunk = n - copied
+		}
+		written, err := io.CopyN(to, from, chunk)
+		copied += written
+		progress.Add(written)
+		if err == io.EOF && n < 0 {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// Symlink makes desfp a symlink to target. The link is created under a temporary name next to
+// desfp and renamed over it, so whatever was at desfp is replaced in one go.
+func (h *Handler) Symlink(target, desfp string) error {
+	h.log.Debug("Creating temporary link to '%v' for '%v'.", target, desfp)
+	tmp, err := vfs.TempSymlink(h.fs, target, filepath.Dir(desfp), "."+filepath.Base(desfp)+".mimic-")
+	if err != nil {
+		return err
+	}
+	h.log.Debug("Renaming '%v' to '%v'.", tmp, desfp)
+	if err := h.fs.Rename(tmp, desfp); err != nil {
+		h.fs.Remove(tmp)
+		return err
+	}
+	h.log.Debug("'%v' now links to '%v'.", desfp, target)
 	return nil
 }
 
+// Link makes desfp a hard link to oldfp. Like Symlink, the link is created under a temporary
+// name next to desfp and renamed over it.
+func (h *Handler) Link(oldfp, desfp string) error {
+	// renaming a link over another link to the same file does nothing, leaving it behind
+	if h.sameFile(oldfp, desfp) {
+		h.log.Debug("'%v' is already a hard link to '%v'.", desfp, oldfp)
+		return nil
+	}
+	h.log.Debug("Creating temporary hard link to '%v' for '%v'.", oldfp, desfp)
+	tmp, err := vfs.TempLink(h.fs, oldfp, filepath.Dir(desfp), "."+filepath.Base(desfp)+".mimic-")
+	if err != nil {
+		return err
+	}
+	h.log.Debug("Renaming '%v' to '%v'.", tmp, desfp)
+	if err := h.fs.Rename(tmp, desfp); err != nil {
+		h.fs.Remove(tmp)
+		return err
+	}
+	h.log.Debug("'%v' is now a hard link to '%v'.", desfp, oldfp)
+	return nil
+}
+
+// sameFile checks if both paths are hard links to the same file.
+func (h *Handler) sameFile(fp1, fp2 string) bool {
+	info1, err := h.fs.Lstat(fp1)
+	if err != nil {
+		return false
+	}
+	info2, err := h.fs.Lstat(fp2)
+	if err != nil {
+		return false
+	}
+	id1, _, ok1 := vfs.Links(info1)
+	id2, _, ok2 := vfs.Links(info2)
+	return ok1 && ok2 && id1 == id2
+}
+
 // CopyDir copies the source directory to the destination directory
-func CopyDir(srcdir, desdir string) error {
-	l.Debug.Log("Does '%v' already exist?", desdir)
-	if ok := pathExists(desdir); ok {
-		l.Debug.Log("Yes!")
-		l.Debug.Log("Directory already exists, so no need to create it.")
+func (h *Handler) CopyDir(srcdir, desdir string) error {
+	h.log.Debug("Does '%v' already exist?", desdir)
+	if ok := h.pathExists(desdir); ok {
+		h.log.Debug("Yes!")
+		h.log.Debug("Directory already exists, so no need to create it.")
 		return nil
 	}
-	l.Debug.Log("No!")
-	l.Debug.Log("Directory doesn't exist, so creating it now...")
+	h.log.Debug("No!")
+	h.log.Debug("Directory doesn't exist, so creating it now...")
 
-	l.Debug.Log("Getting file info for '%v'", srcdir)
-	info, err := os.Stat(srcdir)
+	h.log.Debug("Getting file info for '%v'", srcdir)
+	info, err := h.fs.Stat(srcdir)
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("Done.")
+	h.log.Debug("Done.")
 
-	l.Debug.Log("Begin copying directories...")
-	l.Debug.Log("Building paths...")
+	h.log.Debug("Begin copying directories...")
+	h.log.Debug("Building paths...")
 	var desdirs []string
 	var srcdirs []string
 	var srcroot bool
 	var desroot bool
 	if info.IsDir() {
-		desdirs, desroot = splitPath(desdir, false)
+		desdirs, desroot = h.splitPath(desdir, false)
 	} else {
-		desdirs, desroot = splitPath(desdir, true)
+		desdirs, desroot = h.splitPath(desdir, true)
 	}
-	srcdirs, srcroot = splitPath(srcdir, true)
-	l.Debug.Log("srcdirs: %v", srcdirs)
-	l.Debug.Log("desdirs: %v", desdirs)
-	l.Debug.Log("Joining paths into a file path...")
+	srcdirs, srcroot = h.splitPath(srcdir, true)
+	h.log.Debug("srcdirs: %v", srcdirs)
+	h.log.Debug("desdirs: %v", desdirs)
+	h.log.Debug("Joining paths into a file path...")
 	var srcpath, despath string
+	created := false
 	for i, desdir := range desdirs {
 		if i == 0 {
 			if desroot {
@@ -126,90 +468,174 @@ func CopyDir(srcdir, desdir string) error {
 			despath += desdir + "/"
 			if i < len(srcdirs) {
 				srcpath += srcdirs[i] + "/"
-				info, err = os.Stat(srcpath)
+				info, err = h.fs.Stat(srcpath)
 				if err != nil {
 					return err
 				}
 			}
 		}
-		l.Debug.Log("Does directory '%v' exist?", despath)
-		if ok := pathExists(despath); !ok {
-			l.Notice.Log("Directory '%v' doesn't exist, creating it now...", despath)
-			if err := os.Mkdir(despath, info.Mode()); err != nil {
+		h.log.Debug("Does directory '%v' exist?", despath)
+		if ok := h.pathExists(despath); !ok {
+			h.log.Notice("Directory '%v' doesn't exist, creating it now...", despath)
+			if err := h.fs.Mkdir(despath, info.Mode()); err != nil {
 				return err
 			}
+			created = true
 		}
 	}
-	l.Debug.Log("Done copying directories.")
+	h.log.Debug("Done copying directories.")
 
+	if created && h.Preserve != (Preserve{}) {
+		h.log.Debug("Applying preserved metadata.")
+		return h.dirMeta(srcdir, desdir)
+	}
 	return nil
 }
 
+// dirMeta copies the preserved metadata of the source directory to the destination directory
+// that was just created for it, or of the directory a file is in when the source is a file.
+func (h *Handler) dirMeta(srcdir, desdir string) error {
+	info, err := h.fs.Stat(srcdir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		srcdir, desdir = filepath.Dir(srcdir), filepath.Dir(desdir)
+		if info, err = h.fs.Stat(srcdir); err != nil {
+			return err
+		}
+	}
+	if err := h.copyMeta(srcdir, desdir, info); err != nil {
+		return err
+	}
+	return h.copyDirTimes(srcdir, desdir)
+}
+
 // Remove removes the given file or directory
-func Remove(fp string) error {
-	l.Debug.Log("Removing '%v' now...", fp)
-	if err := os.Remove(fp); err != nil {
+func (h *Handler) Remove(fp string) error {
+	h.log.Debug("Removing '%v' now...", fp)
+	if err := h.fs.Remove(fp); err != nil {
 		return err
 	}
-	l.Debug.Log("File '%v' successfully removed!", fp)
+	h.log.Debug("File '%v' successfully removed!", fp)
 	return nil
 }
 
+// RemoveAll removes the file or directory and everything in it. It refuses to remove anything
+// that isn't inside root, or root itself, after resolving any symlinks in the parent
+// directories. Removing a path that doesn't exist isn't an error.
+func (h *Handler) RemoveAll(root, fp string) error {
+	h.log.Debug("Checking '%v' is inside '%v'...", fp, root)
+	abs, err := vfs.Abs(h.fs, fp)
+	if err != nil {
+		return err
+	}
+	parent, err := vfs.EvalSymlinks(h.fs, filepath.Dir(abs))
+	if os.IsNotExist(err) {
+		h.log.Debug("'%v' doesn't exist, nothing to remove.", fp)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rootfp, err := vfs.EvalSymlinks(h.fs, root)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(rootfp, filepath.Join(parent, filepath.Base(abs)))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return ErrOutsideRoot
+	}
+	h.log.Debug("Yes.")
+
+	h.log.Debug("Removing '%v' and everything in it now...", fp)
+	if err := vfs.RemoveAll(h.fs, fp); err != nil {
+		return err
+	}
+	h.log.Debug("'%v' successfully removed!", fp)
+	return nil
+}
+
+// CopyTree copies the source directory and everything in it to the destination.
+func (h *Handler) CopyTree(srcdir, desdir string) error {
+	h.log.Debug("Copying the tree at '%v' to '%v'...", srcdir, desdir)
+	return vfs.Walk(h.fs, srcdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcdir, path)
+		if err != nil {
+			return err
+		}
+		des := filepath.Join(desdir, rel)
+		if info.IsDir() {
+			return h.CopyDir(path, des)
+		}
+		return h.CopyFile(path, des)
+	})
+}
+
 // Rename renames the file or directory to the given name
-func Rename(old, new string) error {
-	l.Debug.Log("Renaming '%v' now...", old)
-	err := os.Rename(old, new)
+func (h *Handler) Rename(old, new string) error {
+	h.log.Debug("Renaming '%v' now...", old)
+	err := h.fs.Rename(old, new)
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("Done renaming. '%v' is now '%v'.", old, new)
+	h.log.Debug("Done renaming. '%v' is now '%v'.", old, new)
 	return nil
 }
 
-// Chmod changes the given file's permissions to the value passed in
-func Chmod(src, des string) error {
-	l.Debug.Log("Getting file info...")
-	f1, err := os.Stat(src)
+// Chmod changes the given file's permissions to the value passed in, along with any other
+// metadata that is preserved
+func (h *Handler) Chmod(src, des string) error {
+	h.log.Debug("Getting file info...")
+	f1, err := h.fs.Stat(src)
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("Done.")
+	h.log.Debug("Done.")
+
+	if h.Preserve != (Preserve{}) {
+		h.log.Debug("Copying the metadata of '%v' to '%v'.", src, des)
+		return h.copyMeta(src, des, f1)
+	}
 
-	l.Debug.Log("Changing file permissions at file '%v'.", des)
-	if err := os.Chmod(des, f1.Mode()); err != nil {
+	h.log.Debug("Changing file permissions at file '%v'.", des)
+	if err := h.fs.Chmod(des, f1.Mode()); err != nil {
 		return err
 	}
-	l.Debug.Log("Done.")
+	h.log.Debug("Done.")
 
 	return nil
 }
 
 // pathExists checks to see if the given path exists, returns a bool
-func pathExists(fp string) bool {
-	l.Debug.Log("Does '%v' exist?", fp)
-	_, err := os.Stat(fp)
+func (h *Handler) pathExists(fp string) bool {
+	h.log.Debug("Does '%v' exist?", fp)
+	_, err := h.fs.Stat(fp)
 	if err != nil {
-		l.Debug.Log("No!")
+		h.log.Debug("No!")
 		return false
 	}
-	l.Debug.Log("Yes!")
+	h.log.Debug("Yes!")
 	return true
 }
 
 // splitPath splits the path string into the individual files and returns them in an array
-func splitPath(path string, dirs bool) ([]string, bool) {
-	l.Debug.Log("Splitting path '%v'.", path)
+func (h *Handler) splitPath(path string, dirs bool) ([]string, bool) {
+	h.log.Debug("Splitting path '%v'.", path)
 	root := false
 	sp := strings.Split(path, "/")
 	if dirs {
-		l.Debug.Log("Is a directory, so dropping off file name.")
+		h.log.Debug("Is a directory, so dropping off file name.")
 		sp = sp[:len(sp)-1]
 	}
 	if sp[0] == "" {
 		sp = sp[1:]
 		root = true
 	}
-	l.Debug.Log("Done.")
+	h.log.Debug("Done.")
 
 	return sp, root
 }
@@ -7,18 +7,23 @@ package filehandler
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/KaiserGald/logger"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
 )
 
+var fh = New(logging.New(logger.New()), nil)
+
 func TestMain(m *testing.M) {
 	os.MkdirAll("testdir/testsrc", 0777)
 	os.Mkdir("testdir/testdes", 0777)
-	lg := logger.New()
-	Init(lg)
 	test := m.Run()
 
 	os.RemoveAll("testdir")
@@ -27,11 +32,10 @@ func TestMain(m *testing.M) {
 }
 
 func TestCopyFile(t *testing.T) {
-	l = logger.New()
 	os.Create("testdir/testsrc/test.txt")
 	src := "testdir/testsrc/test.txt"
 	des := "testdir/testdes/testcreate.txt"
-	err := CopyFile(src, des)
+	err := fh.CopyFile(src, des)
 	if err != nil {
 		t.Errorf("Error copying '%s' to '%s': %v\n", src, des, err)
 	}
@@ -46,14 +50,14 @@ func TestCopyFile(t *testing.T) {
 	os.Mkdir("testdir/testsrc/test", 0777)
 	os.Create(nestsrc)
 
-	err = CopyFile(nestsrc, des)
+	err = fh.CopyFile(nestsrc, des)
 	if err != nil {
 		t.Errorf("Error copying '%s' to '%s': %v\n", nestsrc, des, err)
 	}
 
 	des = "testdir/testdes/test.txt"
 	os.Create(des)
-	err = CopyFile(src, des)
+	err = fh.CopyFile(src, des)
 	if err != nil {
 		t.Errorf("Error copying '%s' to '%s': %v\n", src, des, err)
 	}
@@ -68,10 +72,86 @@ func TestCopyFile(t *testing.T) {
 	os.Remove(des)
 }
 
+func TestCopyFileTruncates(t *testing.T) {
+	src := "testdir/testsrc/shrink.txt"
+	des := "testdir/testdes/shrink.txt"
+	modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	for _, place := range []bool{false, true} {
+		fh.InPlace = place
+		ioutil.WriteFile(src, []byte("This is a long line of text"), 0640)
+		if err := fh.CopyFile(src, des); err != nil {
+			t.Errorf("Error copying '%s' to '%s': %v\n", src, des, err)
+		}
+
+		ioutil.WriteFile(src, []byte("Short"), 0640)
+		os.Chtimes(src, modtime, modtime)
+		if err := fh.CopyFile(src, des); err != nil {
+			t.Errorf("Error copying '%s' to '%s': %v\n", src, des, err)
+		}
+
+		f2, _ := ioutil.ReadFile(des)
+		if string(f2) != "Short" {
+			t.Errorf("Destination wasn't truncated (in place: %v), got '%s'.\n", place, f2)
+		}
+		os.Remove(des)
+	}
+	fh.InPlace = false
+
+	ioutil.WriteFile(src, []byte("Short"), 0600)
+	os.Chmod(src, 0600)
+	os.Chtimes(src, modtime, modtime)
+	fh.CopyFile(src, des)
+	info, _ := os.Stat(des)
+	if info.Mode() != 0600 {
+		t.Errorf("Mode wasn't copied, expected %v got %v.\n", os.FileMode(0600), info.Mode())
+	}
+	if !info.ModTime().Equal(modtime) {
+		t.Errorf("Modification time wasn't copied, expected %v got %v.\n", modtime, info.ModTime())
+	}
+
+	files, _ := ioutil.ReadDir("testdir/testdes")
+	for _, f := range files {
+		if strings.Contains(f.Name(), ".mimic-") {
+			t.Errorf("Temporary file '%s' was left behind.\n", f.Name())
+		}
+	}
+	os.Remove(src)
+	os.Remove(des)
+}
+
+func TestCopyInPlaceSkipped(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src", 0755)
+	vfs.WriteFile(mem, "src/test.txt", []byte("test"), 0644)
+	modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	mem.Chtimes("src/test.txt", modtime, modtime)
+
+	h := New(logging.Discard, mem)
+	h.InPlace = true
+	for i := 0; i < 2; i++ {
+		differs, err := h.Differs("src/test.txt", "des/test.txt", CompareSize)
+		if err != nil {
+			t.Fatalf("Error comparing: %v", err)
+		}
+		if differs != (i == 0) {
+			t.Errorf("Expected copy %d to be needed %v got %v", i+1, i == 0, differs)
+		}
+		if differs {
+			if err := h.CopyFile("src/test.txt", "des/test.txt"); err != nil {
+				t.Fatalf("Error copying: %v", err)
+			}
+		}
+	}
+	if info, _ := mem.Stat("des/test.txt"); !info.ModTime().Equal(modtime) {
+		t.Errorf("Expected the modification time to be copied in place got %v", info.ModTime())
+	}
+}
+
 func TestCopyDir(t *testing.T) {
 	src := "testdir/testsrc"
 	des := "testdir/testdircopy"
-	err := CopyDir(src, des)
+	err := fh.CopyDir(src, des)
 	if err != nil {
 		t.Errorf("Error copying '%s' to '%s': %v\n", src, des, err)
 	}
@@ -85,7 +165,7 @@ func TestCopyDir(t *testing.T) {
 func TestRemove(t *testing.T) {
 	file := "test.txt"
 	os.Create(file)
-	err := Remove(file)
+	err := fh.Remove(file)
 	if err != nil {
 		t.Errorf("Error removing '%s': %v\n", file, err)
 	}
@@ -96,11 +176,70 @@ func TestRemove(t *testing.T) {
 	}
 }
 
+func TestRemoveAll(t *testing.T) {
+	root := "testdir/removeroot"
+	os.MkdirAll(root+"/sub/deeper", 0777)
+	os.MkdirAll("testdir/outside", 0777)
+	defer os.RemoveAll(root)
+	defer os.RemoveAll("testdir/outside")
+	ioutil.WriteFile(root+"/sub/deeper/test.txt", []byte("test"), 0644)
+	ioutil.WriteFile("testdir/outside/test.txt", []byte("test"), 0644)
+	os.Symlink("../outside", root+"/link")
+
+	if err := fh.RemoveAll(root, root+"/sub"); err != nil {
+		t.Errorf("Error removing a nested directory: %v", err)
+	}
+	if exists(root + "/sub") {
+		t.Errorf("Nested directory still exists.")
+	}
+
+	for _, fp := range []string{root, root + "/..", "testdir/outside", root + "/link/test.txt"} {
+		if err := fh.RemoveAll(root, fp); err != ErrOutsideRoot {
+			t.Errorf("Expected removing '%v' to fail with '%v' got %v", fp, ErrOutsideRoot, err)
+		}
+	}
+	if !exists("testdir/outside/test.txt") || !exists(root) {
+		t.Errorf("Something outside of the root was removed.")
+	}
+
+	// the link itself is inside the root, so it can go, but not what it points to
+	if err := fh.RemoveAll(root, root+"/link"); err != nil {
+		t.Errorf("Error removing a symlink: %v", err)
+	}
+	if !exists("testdir/outside/test.txt") {
+		t.Errorf("Removing a symlink removed what it points to.")
+	}
+
+	if err := fh.RemoveAll(root, root+"/missing/test.txt"); err != nil {
+		t.Errorf("Expected removing a missing path to succeed got %v", err)
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	src, des := "testdir/treesrc", "testdir/treedes"
+	os.MkdirAll(src+"/sub/deeper", 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(des)
+	files := []string{"/test.txt", "/sub/test.txt", "/sub/deeper/test.txt"}
+	for _, file := range files {
+		ioutil.WriteFile(src+file, []byte(file), 0644)
+	}
+
+	if err := fh.CopyTree(src, des); err != nil {
+		t.Errorf("Error copying tree: %v", err)
+	}
+	for _, file := range files {
+		if b, err := ioutil.ReadFile(des + file); err != nil || string(b) != file {
+			t.Errorf("'%v' wasn't copied: %v", file, err)
+		}
+	}
+}
+
 func TestRename(t *testing.T) {
 	old := "test.txt"
 	new := "test1.txt"
 	os.Create(old)
-	err := Rename(old, new)
+	err := fh.Rename(old, new)
 	if err != nil {
 		t.Errorf("Error renaming '%s' to '%s': %v\n", old, new, err)
 	}
@@ -114,7 +253,7 @@ func TestRename(t *testing.T) {
 	old = "renamedir"
 	new = "renamedirtest"
 	os.Mkdir(old, 0700)
-	err = Rename(old, new)
+	err = fh.Rename(old, new)
 	if err != nil {
 		t.Errorf("Error renaming '%s' to '%s': %v\n", old, new, err)
 	}
@@ -135,7 +274,7 @@ func TestChmod(t *testing.T) {
 	os.Create(des)
 	os.Chmod(src, perm)
 
-	err := Chmod(src, des)
+	err := fh.Chmod(src, des)
 	if err != nil {
 		t.Errorf("Error changing file mode: %v\n", err)
 	}
@@ -151,6 +290,93 @@ func TestChmod(t *testing.T) {
 	os.Remove(des)
 }
 
+func TestMem(t *testing.T) {
+	mem := vfs.NewMem()
+	h := New(logging.Discard, mem)
+	vfs.MkdirAll(mem, "mem/src/sub", 0755)
+	modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	vfs.WriteFile(mem, "mem/src/sub/test.txt", []byte("test"), 0600)
+	mem.Chtimes("mem/src/sub/test.txt", modtime, modtime)
+
+	if err := h.CopyTree("mem/src", "mem/des"); err != nil {
+		t.Fatalf("Error copying tree: %v", err)
+	}
+	info, err := mem.Stat("mem/des/sub/test.txt")
+	if err != nil || info.Mode() != 0600 || !info.ModTime().Equal(modtime) {
+		t.Errorf("Expected the file to be copied with its mode and modification time, got %v (%v)", info, err)
+	}
+	if b, _ := vfs.ReadFile(mem, "mem/des/sub/test.txt"); string(b) != "test" {
+		t.Errorf("Expected 'test' got '%s'", b)
+	}
+	if exists("mem") {
+		t.Errorf("Expected nothing to be written to disk.")
+	}
+
+	mem.Symlink("/mem/src", "mem/des/escape")
+	if err := h.RemoveAll("mem/des", "mem/des/escape/sub"); err != ErrOutsideRoot {
+		t.Errorf("Expected '%v' removing through a symlink out of the root got '%v'", ErrOutsideRoot, err)
+	}
+	if err := h.RemoveAll("mem/des", "mem/des/sub"); err != nil {
+		t.Errorf("Error removing directory: %v", err)
+	}
+	if _, err := mem.Stat("mem/des/sub"); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory to be removed, got %v", err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	mem := vfs.NewMem()
+	h := New(logging.Discard, mem)
+	vfs.MkdirAll(mem, "des", 0755)
+	vfs.WriteFile(mem, "des/test.txt", []byte("test"), 0644)
+	vfs.WriteFile(mem, "des/link.txt", []byte("old"), 0644)
+
+	for i := 0; i < 2; i++ {
+		if err := h.Link("des/test.txt", "des/link.txt"); err != nil {
+			t.Fatalf("Error linking: %v", err)
+		}
+	}
+	if !h.sameFile("des/test.txt", "des/link.txt") {
+		t.Errorf("Expected 'des/link.txt' to be replaced by a hard link.")
+	}
+	if infos, _ := mem.ReadDir("des"); len(infos) != 2 {
+		t.Errorf("Expected no temporary links to be left behind got %v", len(infos))
+	}
+}
+
+func TestCopySparse(t *testing.T) {
+	src, des := "testdir/testsrc/sparse.img", "testdir/testdes/sparse.img"
+	f, _ := os.Create(src)
+	f.Seek(1<<20, io.SeekStart)
+	f.Write([]byte("data"))
+	f.Truncate(8 << 20)
+	f.Close()
+
+	for _, inPlace := range []bool{false, true} {
+		os.Remove(des)
+		h := New(logging.Discard, nil)
+		h.InPlace = inPlace
+		if err := h.CopyFile(src, des); err != nil {
+			t.Fatalf("Error copying sparse file: %v", err)
+		}
+		b1, _ := ioutil.ReadFile(src)
+		b2, _ := ioutil.ReadFile(des)
+		if !bytes.Equal(b1, b2) {
+			t.Errorf("Expected the copy to hold the same data, got %v bytes", len(b2))
+		}
+		f, _ := os.Open(src)
+		holes := len(vfs.Extents(f, 8<<20)) == 1
+		f.Close()
+		f, _ = os.Open(des)
+		if extents := vfs.Extents(f, 8<<20); !holes && len(extents) == 1 && extents[0].Len == 8<<20 {
+			t.Errorf("Expected the holes to be kept got %v", extents)
+		}
+		f.Close()
+	}
+	os.Remove(src)
+	os.Remove(des)
+}
+
 func exists(fp string) bool {
 	_, err := os.Stat(fp)
 	if err != nil {
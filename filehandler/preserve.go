@@ -0,0 +1,191 @@
+// Package filehandler
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filehandler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// Preserve is the metadata copied along with the contents and mode of files and directories.
+type Preserve struct {
+	// Times copies modification times, of directories as well as files.
+	Times bool
+	// Owner copies the user and group that own a file, which usually takes root.
+	Owner bool
+	// Xattrs copies extended attributes, other than the ones ACLs are kept in.
+	Xattrs bool
+	// ACLs copies POSIX access control lists.
+	ACLs bool
+}
+
+// aclXattrs are the extended attributes POSIX ACLs are kept in.
+var aclXattrs = map[string]bool{"system.posix_acl_access": true, "system.posix_acl_default": true}
+
+// ParsePreserve checks comma separated lists of metadata, made up of 'times', 'owner', 'xattrs'
+// and 'acls'. Nothing extra is preserved for an empty list.
+func ParsePreserve(lists ...string) (Preserve, error) {
+	var p Preserve
+	for _, list := range lists {
+		for _, name := range strings.Split(list, ",") {
+			switch strings.TrimSpace(name) {
+			case "":
+			case "times":
+				p.Times = true
+			case "owner":
+				p.Owner = true
+			case "xattrs":
+				p.Xattrs = true
+			case "acls":
+				p.ACLs = true
+			default:
+				return Preserve{}, fmt.Errorf("unknown metadata '%v' to preserve", name)
+			}
+		}
+	}
+	return p, nil
+}
+
+// String returns the metadata as a comma separated list, like ParsePreserve takes.
+func (p Preserve) String() string {
+	var names []string
+	for _, m := range []struct {
+		on   bool
+		name string
+	}{{p.Times, "times"}, {p.Owner, "owner"}, {p.Xattrs, "xattrs"}, {p.ACLs, "acls"}} {
+		if m.on {
+			names = append(names, m.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Without returns the metadata in p that isn't in other, for what a destination can't hold.
+func (p Preserve) Without(other Preserve) Preserve {
+	return Preserve{
+		Times:  p.Times && !other.Times,
+		Owner:  p.Owner && !other.Owner,
+		Xattrs: p.Xattrs && !other.Xattrs,
+		ACLs:   p.ACLs && !other.ACLs,
+	}
+}
+
+// chown gives the destination path the owner of the source info, if owners are preserved.
+func (h *Handler) chown(desfp string, info os.FileInfo) error {
+	if !h.Preserve.Owner || h.lost("owner") {
+		return nil
+	}
+	uid, gid, ok := vfs.Owner(info)
+	if !ok {
+		return h.degrade("owner", &os.PathError{Op: "owner", Path: info.Name(), Err: vfs.ErrUnsupported})
+	}
+	h.log.Debug("Changing the owner of '%v' to %v:%v.", desfp, uid, gid)
+	if err := vfs.Lchown(h.fs, desfp, uid, gid); err != nil {
+		return h.degrade("owner", err)
+	}
+	return nil
+}
+
+// copyXattrs copies the extended attributes and ACLs of the source path to the destination path,
+// whichever of them are preserved.
+func (h *Handler) copyXattrs(srcfp, desfp string) error {
+	if !h.Preserve.Xattrs && !h.Preserve.ACLs || h.lost("xattrs") && h.lost("acls") {
+		return nil
+	}
+	attrs, err := vfs.Listxattr(h.fs, srcfp)
+	if err != nil {
+		if err := h.degrade("xattrs", err); err != nil {
+			return err
+		}
+		return h.degrade("acls", err)
+	}
+	for _, attr := range attrs {
+		kind, on := "xattrs", h.Preserve.Xattrs
+		if aclXattrs[attr] {
+			kind, on = "acls", h.Preserve.ACLs
+		}
+		name := "extended attribute '" + attr + "'"
+		if !on || h.lost(kind) || h.lost(name) {
+			continue
+		}
+		value, err := vfs.Getxattr(h.fs, srcfp, attr)
+		if err != nil {
+			return err
+		}
+		h.log.Debug("Copying extended attribute '%v' from '%v' to '%v'.", attr, srcfp, desfp)
+		if err := vfs.Setxattr(h.fs, desfp, attr, value); err != nil {
+			// a single attribute can be refused, like the ones only root can set
+			if os.IsPermission(err) {
+				kind = name
+			}
+			if err := h.degrade(kind, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyMeta copies the preserved metadata of the source path, whose info is given, to the
+// destination path. The owner goes first since changing it can clear the mode, and ACLs go last
+// since changing the mode changes them.
+func (h *Handler) copyMeta(srcfp, desfp string, info os.FileInfo) error {
+	if err := h.chown(desfp, info); err != nil {
+		return err
+	}
+	if err := h.fs.Chmod(desfp, info.Mode()); err != nil {
+		return err
+	}
+	if err := h.copyXattrs(srcfp, desfp); err != nil {
+		return err
+	}
+	if h.Preserve.Times {
+		return h.fs.Chtimes(desfp, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// copyDirTimes gives the directory the destination path is in the modification time of the one
+// the source path is in, since writing into it just changed it.
+func (h *Handler) copyDirTimes(srcfp, desfp string) error {
+	if !h.Preserve.Times {
+		return nil
+	}
+	info, err := h.fs.Stat(filepath.Dir(srcfp))
+	if err != nil {
+		return err
+	}
+	return h.fs.Chtimes(filepath.Dir(desfp), info.ModTime(), info.ModTime())
+}
+
+// degrade turns an error preserving metadata into a warning if the file system can't hold it,
+// or won't let it be set, and stops preserving it. Any other error is returned.
+func (h *Handler) degrade(what string, err error) error {
+	if !vfs.IsUnsupported(err) && !os.IsPermission(err) {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.unsupported == nil {
+		h.unsupported = make(map[string]bool)
+	}
+	if !h.unsupported[what] {
+		h.unsupported[what] = true
+		h.log.Notice("Can't preserve %v, copying without it from now on: %v", what, err)
+	}
+	return nil
+}
+
+// lost checks if the metadata was given up on.
+func (h *Handler) lost(what string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.unsupported[what]
+}
@@ -0,0 +1,110 @@
+// Package filehandler
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filehandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+func TestParsePreserve(t *testing.T) {
+	p, err := ParsePreserve("times, owner", "acls")
+	if err != nil || p != (Preserve{Times: true, Owner: true, ACLs: true}) {
+		t.Errorf("Expected times, owner and acls got %+v (%v)", p, err)
+	}
+	if p.String() != "times,owner,acls" {
+		t.Errorf("Expected 'times,owner,acls' got '%v'", p)
+	}
+	if lost := p.Without(Preserve{Times: true, Owner: true}); lost != (Preserve{ACLs: true}) {
+		t.Errorf("Expected only acls to be left got %+v", lost)
+	}
+	if p, err := ParsePreserve(""); err != nil || p != (Preserve{}) {
+		t.Errorf("Expected nothing to be preserved got %+v (%v)", p, err)
+	}
+	if _, err := ParsePreserve("times,colour"); err == nil {
+		t.Errorf("Expected an error parsing unknown metadata.")
+	}
+}
+
+func TestPreserve(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src/sub", 0750)
+	vfs.WriteFile(mem, "src/sub/test.txt", []byte("test"), 0640)
+	vfs.Lchown(mem, "src/sub/test.txt", 1000, 100)
+	vfs.Lchown(mem, "src/sub", 1000, 100)
+	vfs.Setxattr(mem, "src/sub/test.txt", "user.mimic", []byte("test"))
+	vfs.Setxattr(mem, "src/sub/test.txt", "system.posix_acl_access", []byte("acl"))
+	modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	mem.Chtimes("src/sub/test.txt", modtime, modtime)
+	mem.Chtimes("src/sub", modtime, modtime)
+
+	for _, inPlace := range []bool{false, true} {
+		h := New(logging.Discard, mem)
+		h.InPlace = inPlace
+		h.Preserve = Preserve{Times: true, Owner: true, Xattrs: true}
+		vfs.RemoveAll(mem, "des")
+		if err := h.CopyFile("src/sub/test.txt", "des/sub/test.txt"); err != nil {
+			t.Fatalf("Error copying file: %v", err)
+		}
+
+		for _, fp := range []string{"des/sub/test.txt", "des/sub"} {
+			info, _ := mem.Stat(fp)
+			if uid, gid, _ := vfs.Owner(info); uid != 1000 || gid != 100 {
+				t.Errorf("Expected '%v' to be owned by 1000:100 got %v:%v", fp, uid, gid)
+			}
+			if !info.ModTime().Equal(modtime) {
+				t.Errorf("Expected '%v' to be modified at %v got %v", fp, modtime, info.ModTime())
+			}
+		}
+		if value, err := vfs.Getxattr(mem, "des/sub/test.txt", "user.mimic"); string(value) != "test" {
+			t.Errorf("Expected the extended attribute to be copied got '%s' (%v)", value, err)
+		}
+		if _, err := vfs.Getxattr(mem, "des/sub/test.txt", "system.posix_acl_access"); err == nil {
+			t.Errorf("Expected the ACL not to be copied without preserving ACLs.")
+		}
+	}
+
+	// a later change to the metadata is picked up with the mode
+	h := New(logging.Discard, mem)
+	h.Preserve = Preserve{Owner: true, ACLs: true}
+	vfs.Lchown(mem, "src/sub/test.txt", 1001, 100)
+	if err := h.Chmod("src/sub/test.txt", "des/sub/test.txt"); err != nil {
+		t.Fatalf("Error copying metadata: %v", err)
+	}
+	info, _ := mem.Stat("des/sub/test.txt")
+	if uid, _, _ := vfs.Owner(info); uid != 1001 {
+		t.Errorf("Expected the new owner to be copied got %v", uid)
+	}
+	if value, _ := vfs.Getxattr(mem, "des/sub/test.txt", "system.posix_acl_access"); string(value) != "acl" {
+		t.Errorf("Expected the ACL to be copied got '%s'", value)
+	}
+}
+
+func TestPreserveUnsupported(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src", 0755)
+	vfs.WriteFile(mem, "src/test.txt", []byte("test"), 0644)
+
+	// hides the owners and extended attributes of the Mem
+	h := New(logging.Discard, struct{ vfs.FS }{mem})
+	h.Preserve = Preserve{Times: true, Owner: true, Xattrs: true, ACLs: true}
+	for i := 0; i < 2; i++ {
+		if err := h.CopyFile("src/test.txt", "des/test.txt"); err != nil {
+			t.Fatalf("Expected copying without the metadata got %v", err)
+		}
+	}
+	if b, _ := vfs.ReadFile(mem, "des/test.txt"); string(b) != "test" {
+		t.Errorf("Expected 'test' got '%s'", b)
+	}
+	for _, what := range []string{"owner", "xattrs", "acls"} {
+		if !h.lost(what) {
+			t.Errorf("Expected %v to be given up on.", what)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package filehandler
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filehandler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KaiserGald/mimic/logging"
+)
+
+// progressEvery is how often the progress of a large copy is logged.
+var progressEvery = 5 * time.Second
+
+// units are the suffixes ParseSize takes and FormatSize gives, each 1024 times the one before.
+var units = []string{"B", "KB", "MB", "GB", "TB", "PB"}
+
+// ParseSize parses a size like '512KB', '100MB' or '2G', in bytes when there's no unit. Units are
+// powers of 1024, with or without the B, and an empty size is 0.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	num := strings.TrimRight(s, "KMGTPIB")
+	unit := strings.TrimSuffix(strings.TrimSuffix(s[len(num):], "B"), "I")
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%v'", s)
+	}
+	for i, u := range units {
+		if unit == strings.TrimSuffix(u, "B") {
+			return int64(n * float64(int64(1)<<(10*uint(i)))), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown unit in size '%v'", s)
+}
+
+// FormatSize formats the size in bytes with the largest unit it has at least one of.
+func FormatSize(n int64) string {
+	size, i := float64(n), 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %v", size, units[i])
+}
+
+// Progress logs how far a copy of a large file has got, every few seconds while it's going on. A
+// nil Progress logs nothing, which is what NewProgress returns for files that aren't large.
+type Progress struct {
+	log   logging.Logger
+	name  string
+	total int64
+	done  int64
+	start time.Time
+	last  time.Time
+}
+
+// NewProgress returns the Progress of copying total bytes of the named file, or nil if it's
+// smaller than the threshold or the threshold isn't above 0.
+func NewProgress(lg logging.Logger, name string, total, threshold int64) *Progress {
+	if threshold <= 0 || total < threshold {
+		return nil
+	}
+	now := time.Now()
+	lg.Info("Copying '%v', %v...", name, FormatSize(total))
+	return &Progress{log: lg, name: name, total: total, start: now, last: now}
+}
+
+// Add counts n more bytes as copied, and logs how far the copy has got if it hasn't in a while.
+func (p *Progress) Add(n int64) {
+	if p == nil || n == 0 {
+		return
+	}
+	p.done += n
+	if now := time.Now(); now.Sub(p.last) >= progressEvery {
+		p.last = now
+		percent := int64(100)
+		if p.total > 0 && p.done < p.total {
+			percent = p.done * 100 / p.total
+		}
+		p.log.Info("Copying '%v', %v of %v (%d%%) at %v/s.", p.name, FormatSize(p.done), FormatSize(p.total), percent, FormatSize(p.rate(now)))
+	}
+}
+
+// Done logs that the copy is done.
+func (p *Progress) Done() {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	p.log.Info("Copied '%v', %v in %v at %v/s.", p.name, FormatSize(p.done), now.Sub(p.start).Round(time.Millisecond), FormatSize(p.rate(now)))
+}
+
+// rate returns how many bytes a second have been copied so far.
+func (p *Progress) rate(now time.Time) int64 {
+	elapsed := now.Sub(p.start).Seconds()
+	if elapsed <= 0 {
+		return p.done
+	}
+	return int64(float64(p.done) / elapsed)
+}
+
+// Reader returns the reader counting what's read from it as copied. The reader has the size of
+// the copy, so writers that copy in parallel when they know it still can. The reader is returned
+// as it is when the Progress is nil.
+func (p *Progress) Reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r: r, p: p}
+}
+
+type progressReader struct {
+	r io.Reader
+	p *Progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.Add(int64(n))
+	return n, err
+}
+
+func (pr *progressReader) Size() int64 { return pr.p.total }
@@ -0,0 +1,77 @@
+// Package filehandler
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filehandler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// lines records the info lines logged to it.
+type lines struct {
+	logging.Logger
+	logged []string
+}
+
+func (l *lines) Info(format string, args ...interface{}) {
+	l.logged = append(l.logged, fmt.Sprintf(format, args...))
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"":      0,
+		"512":   512,
+		"2k":    2 << 10,
+		"100MB": 100 << 20,
+		"1.5G":  3 << 29,
+		"1TiB":  1 << 40,
+	}
+	for s, expected := range tests {
+		if size, err := ParseSize(s); err != nil || size != expected {
+			t.Errorf("Expected '%v' to be %v got %v (%v)", s, expected, size, err)
+		}
+	}
+	for _, s := range []string{"lots", "MB", "-1KB", "10XB"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("Expected an error parsing '%v'", s)
+		}
+	}
+	if s := FormatSize(3 << 29); s != "1.5 GB" {
+		t.Errorf("Expected '1.5 GB' got '%v'", s)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	defer func(every time.Duration) { progressEvery = every }(progressEvery)
+	progressEvery = 0
+
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src", 0755)
+	vfs.WriteFile(mem, "src/large", bytes.Repeat([]byte("x"), 20<<20), 0644)
+	vfs.WriteFile(mem, "src/small", []byte("x"), 0644)
+
+	l := &lines{Logger: logging.Discard}
+	h := New(l, mem)
+	h.ProgressSize = 1 << 20
+	if err := h.CopyFile("src/small", "des/small"); err != nil || len(l.logged) != 0 {
+		t.Errorf("Expected nothing to be logged copying a small file got %v (%v)", l.logged, err)
+	}
+	if err := h.CopyFile("src/large", "des/large"); err != nil {
+		t.Fatalf("Error copying: %v", err)
+	}
+	if len(l.logged) != 5 || !strings.Contains(l.logged[1], "(40%)") || !strings.HasPrefix(l.logged[4], "Copied 'src/large', 20.0 MB") {
+		t.Errorf("Expected the progress of the copy to be logged got %q", l.logged)
+	}
+	if info, _ := mem.Stat("des/large"); info.Size() != 20<<20 {
+		t.Errorf("Expected the whole file to be copied got %v bytes", info.Size())
+	}
+}
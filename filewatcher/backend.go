@@ -0,0 +1,140 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// Names of the backends that can be used to watch the source.
+const (
+	BackendInotify = "inotify"
+	BackendPoll    = "poll"
+)
+
+// ErrOverflow is sent by a backend when it has lost events and the source needs to be rescanned.
+var ErrOverflow = errors.New("event queue overflowed")
+
+// FilterFunc decides if a path is watched, it returns watcher.ErrSkip for paths that aren't.
+type FilterFunc func(info os.FileInfo, fullPath string) error
+
+// Backend is the source of file system events for a pair. Events use absolute paths, and
+// renames and moves have a path of the form 'OLD -> NEW'.
+type Backend interface {
+	// AddRecursive watches the directory and everything under it.
+	AddRecursive(name string) error
+	// WatchedFiles returns everything that is being watched.
+	WatchedFiles() map[string]os.FileInfo
+	// Start delivers events until the backend is closed.
+	Start() error
+	// Close stops the backend.
+	Close()
+	Events() <-chan watcher.Event
+	Errors() <-chan error
+	Closed() <-chan struct{}
+}
+
+// newBackend creates the named backend, an empty name picks the best one for the platform.
+func newBackend(name string, interval time.Duration, filter FilterFunc) (Backend, error) {
+	if name == "" {
+		name = defaultBackend
+	}
+	switch name {
+	case BackendInotify:
+		return newInotifyBackend(filter)
+	case BackendPoll:
+		return newPollBackend(interval, filter), nil
+	}
+	return nil, fmt.Errorf("unknown backend '%v'", name)
+}
+
+// pollBackend polls the source for changes using radovskyb/watcher.
+type pollBackend struct {
+	w        *watcher.Watcher
+	interval time.Duration
+
+	mu      sync.Mutex
+	started bool
+	closing bool
+}
+
+// newPollBackend creates a backend that polls the source at the given interval.
+func newPollBackend(interval time.Duration, filter FilterFunc) *pollBackend {
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	w := watcher.New()
+	if filter != nil {
+		w.AddFilterHook(watcher.FilterFileHookFunc(filter))
+	}
+	return &pollBackend{w: w, interval: interval}
+}
+
+func (p *pollBackend) AddRecursive(name string) error {
+	return p.w.AddRecursive(name)
+}
+
+func (p *pollBackend) WatchedFiles() map[string]os.FileInfo {
+	return p.w.WatchedFiles()
+}
+
+// Start polls the source until the backend is closed. A backend that was closed before it
+// started doesn't start at all.
+func (p *pollBackend) Start() error {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		return nil
+	}
+	p.started = true
+	p.mu.Unlock()
+	return p.w.Start(p.interval)
+}
+
+// Close stops the watcher. The watcher blocks on sending events until they are read, so
+// anything it still sends while closing is thrown away.
+func (p *pollBackend) Close() {
+	p.mu.Lock()
+	started, closing := p.started, p.closing
+	p.closing = true
+	p.mu.Unlock()
+	if !started || closing {
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-p.w.Event:
+			case <-p.w.Error:
+			case <-done:
+				return
+			}
+		}
+	}()
+	p.w.Wait()
+	p.w.Close()
+}
+
+func (p *pollBackend) Events() <-chan watcher.Event {
+	return p.w.Event
+}
+
+func (p *pollBackend) Errors() <-chan error {
+	return p.w.Error
+}
+
+func (p *pollBackend) Closed() <-chan struct{} {
+	return p.w.Closed
+}
@@ -0,0 +1,106 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+func TestNewBackend(t *testing.T) {
+	b, err := newBackend(BackendPoll, 0, nil)
+	if err != nil {
+		t.Errorf("Error creating poll backend: %v", err)
+	}
+	if p, ok := b.(*pollBackend); !ok || p.interval != defaultInterval {
+		t.Errorf("Expected a poll backend with the default interval.")
+	}
+
+	b, err = newBackend("", 0, nil)
+	if err != nil || b == nil {
+		t.Errorf("Error creating default backend: %v", err)
+	}
+	if b != nil {
+		b.Close()
+	}
+
+	_, err = newBackend("carrier-pigeon", 0, nil)
+	if err == nil {
+		t.Errorf("Expected an error creating an unknown backend.")
+	}
+}
+
+func TestPollBackend(t *testing.T) {
+	dir := "testpoll"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, 0770)
+	defer os.RemoveAll(dir)
+
+	b := newPollBackend(10*time.Millisecond, func(info os.FileInfo, fullPath string) error {
+		if info.Name() == "skip.txt" {
+			return watcher.ErrSkip
+		}
+		return nil
+	})
+	if err := b.AddRecursive(dir); err != nil {
+		t.Fatalf("Error adding '%v': %v", dir, err)
+	}
+	go b.Start()
+
+	os.Create(dir + "/skip.txt")
+	os.Create(dir + "/test.txt")
+
+	timeout := time.After(time.Second)
+	for created := false; !created; {
+		select {
+		case event := <-b.Events():
+			if event.Name() == "skip.txt" {
+				t.Errorf("Got an event for a skipped file: %v", event)
+			}
+			created = event.Op == watcher.Create && event.Name() == "test.txt"
+		case err := <-b.Errors():
+			t.Fatalf("Error watching '%v': %v", dir, err)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for an event.")
+		}
+	}
+
+	// the poller blocks on sending events nobody reads, closing it mustn't
+	os.Create(dir + "/unread.txt")
+	time.Sleep(30 * time.Millisecond)
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out closing the backend.")
+	}
+}
+
+func TestPollBackendCloseBeforeStart(t *testing.T) {
+	b := newPollBackend(10*time.Millisecond, nil)
+	b.Close()
+
+	started := make(chan error)
+	go func() {
+		started <- b.Start()
+	}()
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Errorf("Error starting a closed backend: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("A backend closed before it started kept running.")
+		b.Close()
+	}
+}
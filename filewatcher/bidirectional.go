@@ -0,0 +1,491 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/ignore"
+	"github.com/KaiserGald/mimic/state"
+	"github.com/KaiserGald/mimic/vfs"
+	"github.com/radovskyb/watcher"
+)
+
+// ConflictPolicy decides what happens in bidirectional mode when a path changed in both the
+// source and the destination since they were last in sync.
+type ConflictPolicy string
+
+const (
+	// ConflictNewest keeps whichever side was modified last, the source wins a tie.
+	ConflictNewest ConflictPolicy = "newest"
+	// ConflictSource always keeps the source.
+	ConflictSource ConflictPolicy = "source"
+	// ConflictKeepBoth keeps the source, and the destination's version next to it under a
+	// '.conflict-<host>-<time>' suffix.
+	ConflictKeepBoth ConflictPolicy = "keep-both"
+)
+
+// conflictTime is the layout of the time in the name of a conflict copy.
+const conflictTime = "20060102-150405"
+
+// ParseConflict checks the name of a conflict policy, an empty name is ConflictNewest.
+func ParseConflict(name string) (ConflictPolicy, error) {
+	switch c := ConflictPolicy(name); c {
+	case "":
+		return ConflictNewest, nil
+	case ConflictNewest, ConflictSource, ConflictKeepBoth:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy '%v'", name)
+}
+
+// side is one of the two trees of a bidirectional pair.
+type side struct {
+	name string
+	root string
+	// dest writes into the side.
+	dest destination.Destination
+}
+
+// path returns where rel is on the side.
+func (s side) path(rel string) string {
+	return filepath.Join(s.root, filepath.FromSlash(rel))
+}
+
+// openSource opens the source as a destination, so changes made in the destination can be copied
+// back into it. Only local destinations can be mirrored both ways, nothing else can be watched.
+func (m *mirror) openSource() error {
+	local, ok := m.dest.(*destination.Local)
+	if !ok {
+		return fmt.Errorf("bidirectional sync needs a local destination, '%v' isn't one", m.Destination)
+	}
+	root, err := vfs.Abs(m.files.FS(), local.Root())
+	if err != nil {
+		return err
+	}
+	m.desRoot = root
+	m.back = destination.NewLocal(m.Source, destination.Options{Log: m.log, FS: m.files.FS(), InPlace: m.InPlace, Preserve: m.Preserve, ProgressSize: m.ProgressSize, Delta: m.Delta})
+	return nil
+}
+
+// sides returns the source and the destination of a bidirectional pair.
+func (m *mirror) sides() (side, side) {
+	local := m.dest.(*destination.Local)
+	return side{name: "source", root: m.Source, dest: m.back}, side{name: "destination", root: local.Root(), dest: m.dest}
+}
+
+// conflictPolicy returns the pair's conflict policy.
+func (m *mirror) conflictPolicy() ConflictPolicy {
+	if m.Conflict == "" {
+		return ConflictNewest
+	}
+	return m.Conflict
+}
+
+// syncBoth brings the source and the destination up to date with each other.
+func (m *mirror) syncBoth() error {
+	m.log.Debug("Reconciling '%v' and '%v'...", m.Source, m.Destination)
+	if err := m.reconcileTree(""); err != nil {
+		return err
+	}
+	if err := m.state.Save(); err != nil {
+		m.log.Error("[%v] Error saving state: %v", m, err)
+	}
+	m.log.Notice("[%v] Initial sync done, the source and the destination are in sync.", m)
+	return nil
+}
+
+// reconcileTree reconciles rel and then everything under it on either side, or in the state
+// index, parents before their children.
+func (m *mirror) reconcileTree(rel string) error {
+	if err := m.reconcile(rel); err != nil {
+		return err
+	}
+	var skipped []string
+	for _, p := range m.under(rel) {
+		if m.stopping() {
+			return nil
+		}
+		if inside(p, skipped) {
+			continue
+		}
+		if m.excluded(p) {
+			m.log.Debug("'%v' is ignored.", p)
+			m.state.Remove(p)
+			skipped = append(skipped, p)
+			continue
+		}
+		if err := m.reconcile(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inside checks if the path is one of the directories, or in one of them.
+func inside(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// under returns every path below rel on either side or in the state index, sorted.
+func (m *mirror) under(rel string) []string {
+	seen := make(map[string]bool)
+	src, des := m.sides()
+	for _, s := range []side{src, des} {
+		tree, err := mapTree(m.files.FS(), s.path(rel))
+		if err != nil {
+			continue
+		}
+		for p := range tree {
+			seen[path.Join(rel, p)] = true
+		}
+	}
+	for _, p := range m.state.Paths() {
+		if rel == "" || strings.HasPrefix(p, rel+"/") {
+			seen[p] = true
+		}
+	}
+	paths := make([]string, 0, len(seen))
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// excluded checks if the path is left alone in bidirectional mode, because it's ignored or it's
+// one of mimic's own files.
+func (m *mirror) excluded(rel string) bool {
+	if rel == "" || rel == "." || rel == state.FileName {
+		return true
+	}
+	if name := path.Base(rel); strings.HasPrefix(name, ".") && strings.Contains(name, ".mimic-") {
+		return true
+	}
+	src, des := m.sides()
+	var isDir bool
+	if info, err := m.files.FS().Stat(src.path(rel)); err == nil {
+		isDir = info.IsDir()
+	} else if info, err := m.files.FS().Stat(des.path(rel)); err == nil {
+		isDir = info.IsDir()
+	}
+	return m.isIgnored(rel, isDir)
+}
+
+// look returns the info of rel on the side, nil when it isn't there, and whether it changed since
+// the two sides were last in sync.
+func (m *mirror) look(s side, rel string, entry state.Entry, known bool) (os.FileInfo, bool, error) {
+	fp := s.path(rel)
+	info, err := m.files.FS().Stat(fp)
+	if os.IsNotExist(err) {
+		return nil, known, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return info, !known || m.modified(fp, info, entry), nil
+}
+
+// modified checks if the file changed since the entry was made. A file that was only touched, or
+// that was copied without its modification time, hasn't.
+func (m *mirror) modified(fp string, info os.FileInfo, entry state.Entry) bool {
+	if entry.Matches(info) {
+		return false
+	}
+	if info.IsDir() || entry.IsDir() || entry.Hash == "" || entry.Size != info.Size() || entry.Mode != info.Mode() {
+		return true
+	}
+	sum, err := m.files.HashFile(fp)
+	return err != nil || hex.EncodeToString(sum) != entry.Hash
+}
+
+// reconcile compares rel on both sides with the state index, which holds what both sides were
+// the last time they were in sync. A path that only changed on one side is copied, or removed,
+// on the other, and one that changed on both is a conflict. Changes mimic made itself come back
+// as events too, but by then both sides match the state index and nothing happens.
+func (m *mirror) reconcile(rel string) error {
+	if m.excluded(rel) {
+		return nil
+	}
+	src, des := m.sides()
+	entry, known := m.state.Get(rel)
+	sinfo, schanged, err := m.look(src, rel, entry, known)
+	if err != nil {
+		return err
+	}
+	dinfo, dchanged, err := m.look(des, rel, entry, known)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !schanged && !dchanged:
+		return nil
+	case sinfo == nil && dinfo == nil:
+		m.log.Debug("'%v' was removed from both sides.", rel)
+		m.state.Remove(rel)
+		return nil
+	case !dchanged:
+		return m.propagate(src, des, rel, sinfo, dinfo)
+	case !schanged:
+		return m.propagate(des, src, rel, dinfo, sinfo)
+	case m.same(src, des, rel, sinfo, dinfo):
+		m.log.Debug("'%v' changed the same way on both sides.", rel)
+		m.remember(rel, sinfo, des.path(rel))
+		return nil
+	}
+	return m.conflict(rel, src, des, sinfo, dinfo)
+}
+
+// same checks if rel is the same on both sides.
+func (m *mirror) same(src, des side, rel string, sinfo, dinfo os.FileInfo) bool {
+	if sinfo == nil || dinfo == nil || sinfo.IsDir() != dinfo.IsDir() {
+		return false
+	}
+	if sinfo.IsDir() {
+		return true
+	}
+	if sinfo.Size() != dinfo.Size() {
+		return false
+	}
+	ssum, err := m.files.HashFile(src.path(rel))
+	if err != nil {
+		return false
+	}
+	dsum, err := m.files.HashFile(des.path(rel))
+	return err == nil && string(ssum) == string(dsum)
+}
+
+// propagate makes rel on the to side what it is on the from side, info is what it is on the from
+// side and old what it is on the to side.
+func (m *mirror) propagate(from, to side, rel string, info, old os.FileInfo) error {
+	if info == nil {
+		return m.remove(from, to, rel)
+	}
+	m.log.Info("[%v] Copying '%v' from the %v into the %v.", m, rel, from.name, to.name)
+	if old != nil && old.IsDir() != info.IsDir() {
+		if err := to.dest.RemoveAll(rel); err != nil {
+			return err
+		}
+	}
+	var err error
+	if info.IsDir() {
+		err = to.dest.CopyDir(from.path(rel), rel)
+	} else {
+		err = to.dest.CopyFile(from.path(rel), rel)
+	}
+	if err != nil {
+		return err
+	}
+	m.remember(rel, info, to.path(rel))
+	return nil
+}
+
+// remember saves rel in the state index as it was on the side it was copied from, before it was
+// copied, so a change made while it was being copied is picked up as a change later. The hash is
+// taken from the copy, fp, which the other side doesn't touch.
+func (m *mirror) remember(rel string, info os.FileInfo, fp string) {
+	var hash string
+	if !info.IsDir() {
+		if sum, err := m.files.HashFile(fp); err == nil {
+			hash = hex.EncodeToString(sum)
+		}
+	}
+	m.state.Put(rel, state.NewEntry(info, hash))
+}
+
+// remove removes rel from the to side after it was removed from the from side. Nothing is ever
+// removed with the keep delete policy, rel is copied back instead. A directory that has paths in
+// it that changed on the to side is kept, and what's in it is reconciled one path at a time.
+func (m *mirror) remove(from, to side, rel string) error {
+	if m.Delete == DeleteKeep {
+		m.log.Info("[%v] '%v' was removed from the %v, the delete policy is '%v' so it's copied back.", m, rel, from.name, m.Delete)
+		info, err := m.files.FS().Stat(to.path(rel))
+		if err != nil {
+			return err
+		}
+		return m.propagate(to, from, rel, info, nil)
+	}
+	if changed := m.changedUnder(to, rel); changed > 0 {
+		m.log.Notice("[%v] Conflict at '%v': it was removed from the %v but %d paths in it changed in the %v, keeping them.", m, rel, from.name, changed, to.name)
+		info, err := m.files.FS().Stat(to.path(rel))
+		if err != nil {
+			return err
+		}
+		if err := from.dest.CopyDir(to.path(rel), rel); err != nil {
+			return err
+		}
+		m.remember(rel, info, from.path(rel))
+		return nil
+	}
+	m.log.Info("[%v] '%v' was removed from the %v, removing it from the %v.", m, rel, from.name, to.name)
+	if err := to.dest.RemoveAll(rel); err != nil {
+		return err
+	}
+	m.state.Remove(rel)
+	return nil
+}
+
+// changedUnder returns how many paths under the directory rel changed on the side since the last
+// sync.
+func (m *mirror) changedUnder(s side, rel string) int {
+	tree, err := mapTree(m.files.FS(), s.path(rel))
+	if err != nil {
+		return 0
+	}
+	var changed int
+	for p, info := range tree {
+		p = path.Join(rel, p)
+		if m.excluded(p) {
+			continue
+		}
+		if entry, known := m.state.Get(p); !known || m.modified(s.path(p), info, entry) {
+			changed++
+		}
+	}
+	return changed
+}
+
+// conflict resolves a path that changed on both sides with the pair's conflict policy. When it
+// was removed from one side and changed on the other, the change is kept unless the source wins.
+func (m *mirror) conflict(rel string, src, des side, sinfo, dinfo os.FileInfo) error {
+	policy := m.conflictPolicy()
+	winner, loser, winfo, linfo := src, des, sinfo, dinfo
+	switch {
+	case sinfo == nil || dinfo == nil:
+		if sinfo == nil && policy != ConflictSource {
+			winner, loser, winfo, linfo = des, src, dinfo, sinfo
+		}
+	case policy == ConflictNewest && dinfo.ModTime().After(sinfo.ModTime()):
+		winner, loser, winfo, linfo = des, src, dinfo, sinfo
+	case policy == ConflictKeepBoth:
+		kept := m.conflictName(rel)
+		m.log.Notice("[%v] Conflict at '%v': both sides changed since the last sync, keeping the destination's version as '%v'.", m, rel, kept)
+		if err := m.files.FS().Rename(des.path(rel), des.path(kept)); err != nil {
+			return err
+		}
+		if err := m.reconcileTree(kept); err != nil {
+			return err
+		}
+		return m.propagate(src, des, rel, sinfo, nil)
+	}
+
+	m.log.Notice("[%v] Conflict at '%v': both sides changed since the last sync, keeping the %v's version, the conflict policy is '%v'.", m, rel, winner.name, policy)
+	if winfo == nil {
+		if err := loser.dest.RemoveAll(rel); err != nil {
+			return err
+		}
+		m.state.Remove(rel)
+		return nil
+	}
+	return m.propagate(winner, loser, rel, winfo, linfo)
+}
+
+// conflictName returns the name the destination's version of a conflicting path is kept under.
+func (m *mirror) conflictName(rel string) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return rel + ".conflict-" + host + "-" + time.Now().Format(conflictTime)
+}
+
+// dispatchBoth reconciles every path the event touched, along with everything under them.
+func (m *mirror) dispatchBoth(event watcher.Event) error {
+	for _, p := range strings.Split(event.Path, " -> ") {
+		if err := m.reconcileTree(m.relPath(p)); err != nil {
+			m.log.Error("[%v] Error reconciling '%v': %v", m, m.relPath(p), err)
+			return err
+		}
+	}
+	return nil
+}
+
+// watchDestination starts watching the destination and returns the events of both sides. Events
+// in the destination are handed on as if they happened to the same path in the source, the
+// reconciling works out which side changed.
+func (m *mirror) watchDestination(w Backend) (<-chan watcher.Event, error) {
+	dw, err := newBackend(m.Backend, m.Interval, m.desFilterHook)
+	if err != nil {
+		return nil, err
+	}
+	m.log.Debug("Adding '%v' to be watched...", m.desRoot)
+	if err := dw.AddRecursive(m.desRoot); err != nil {
+		return nil, err
+	}
+	m.dw = dw
+	go func() {
+		if err := dw.Start(); err != nil {
+			m.log.Error("[%v] Error watching the destination: %v", m, err)
+		}
+	}()
+
+	events := make(chan watcher.Event)
+	go func() {
+		for {
+			var event watcher.Event
+			select {
+			case event = <-w.Events():
+			case event = <-dw.Events():
+				event = m.fromDestination(event)
+			case <-w.Closed():
+				return
+			}
+			select {
+			case events <- event:
+			case <-w.Closed():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// fromDestination turns an event in the destination into the same event in the source.
+func (m *mirror) fromDestination(event watcher.Event) watcher.Event {
+	paths := strings.Split(event.Path, " -> ")
+	for i, p := range paths {
+		rel, err := filepath.Rel(m.desRoot, p)
+		if err != nil {
+			continue
+		}
+		paths[i] = m.relfp + "/" + filepath.ToSlash(rel)
+	}
+	event.Path = strings.Join(paths, " -> ")
+	return event
+}
+
+// desFilterHook keeps ignored and hidden files in the destination out of its watcher, like
+// filterHook does for the source.
+func (m *mirror) desFilterHook(info os.FileInfo, fullPath string) error {
+	rel, err := filepath.Rel(m.desRoot, fullPath)
+	if err != nil || rel == "." {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	for _, name := range strings.Split(rel, "/") {
+		if strings.HasPrefix(name, ".") && name != ignore.FileName {
+			return watcher.ErrSkip
+		}
+	}
+	if m.isIgnored(rel, info.IsDir()) {
+		return watcher.ErrSkip
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// syncBoth syncs the pair in both directions once.
+func syncBoth(t *testing.T, mr *Mirror) {
+	if err := mr.Sync(context.Background()); err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+}
+
+// expectFile checks the contents of the file, "" expects it not to exist.
+func expectFile(t *testing.T, fsys vfs.FS, fp, expected string) {
+	b, err := vfs.ReadFile(fsys, fp)
+	if expected == "" {
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected '%v' not to exist got '%s' (%v)", fp, b, err)
+		}
+		return
+	}
+	if err != nil || string(b) != expected {
+		t.Errorf("Expected '%v' to hold '%v' got '%s' (%v)", fp, expected, b, err)
+	}
+}
+
+func TestBidirectionalSync(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src/sub", 0755)
+	vfs.MkdirAll(mem, "des/other", 0755)
+	vfs.WriteFile(mem, "src/sub/a.txt", []byte("a"), 0644)
+	vfs.WriteFile(mem, "des/other/b.txt", []byte("b"), 0644)
+	vfs.WriteFile(mem, "src/same.txt", []byte("same"), 0644)
+	vfs.WriteFile(mem, "des/same.txt", []byte("same"), 0644)
+	vfs.WriteFile(mem, "des/skip.tmp", []byte("tmp"), 0644)
+
+	mr, _ := New(WithSource("src"), WithDestination("des"), WithFS(mem), WithLogger(testLog),
+		WithBidirectional(true), WithIgnore("*.tmp"))
+	syncBoth(t, mr)
+	expectFile(t, mem, "des/sub/a.txt", "a")
+	expectFile(t, mem, "src/other/b.txt", "b")
+	expectFile(t, mem, "src/same.txt", "same")
+	expectFile(t, mem, "src/skip.tmp", "")
+
+	// a change in the destination is copied into the source, and the other way round
+	vfs.WriteFile(mem, "des/other/b.txt", []byte("changed"), 0644)
+	vfs.WriteFile(mem, "src/sub/new.txt", []byte("new"), 0644)
+	syncBoth(t, mr)
+	expectFile(t, mem, "src/other/b.txt", "changed")
+	expectFile(t, mem, "des/sub/new.txt", "new")
+
+	// a file only touched on one side isn't a change
+	later := time.Now().Add(time.Hour)
+	mem.Chtimes("des/same.txt", later, later)
+	vfs.WriteFile(mem, "src/same.txt", []byte("source"), 0644)
+	syncBoth(t, mr)
+	expectFile(t, mem, "des/same.txt", "source")
+
+	// removing from either side removes from the other
+	mem.Remove("des/sub/a.txt")
+	vfs.RemoveAll(mem, "src/other")
+	syncBoth(t, mr)
+	expectFile(t, mem, "src/sub/a.txt", "")
+	expectFile(t, mem, "des/other/b.txt", "")
+	if _, err := mem.Stat("des/other"); !os.IsNotExist(err) {
+		t.Errorf("Expected the removed directory to be removed from the destination.")
+	}
+
+	// a directory removed on one side is kept when something in it changed on the other
+	vfs.WriteFile(mem, "src/sub/new.txt", []byte("newer"), 0644)
+	vfs.RemoveAll(mem, "des/sub")
+	syncBoth(t, mr)
+	expectFile(t, mem, "des/sub/new.txt", "newer")
+	expectFile(t, mem, "src/sub/new.txt", "newer")
+
+	// with the keep policy nothing is removed, it's copied back
+	mkeep, _ := New(WithPair(mr.Pair()), WithDelete(DeleteKeep), WithFS(mem), WithLogger(testLog))
+	mem.Remove("des/same.txt")
+	syncBoth(t, mkeep)
+	expectFile(t, mem, "des/same.txt", "source")
+}
+
+func TestBidirectionalConflict(t *testing.T) {
+	tests := []struct {
+		policy   ConflictPolicy
+		expected string
+	}{
+		{ConflictNewest, "destination"},
+		{ConflictSource, "source"},
+		{ConflictKeepBoth, "source"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			mem := vfs.NewMem()
+			vfs.MkdirAll(mem, "src", 0755)
+			vfs.WriteFile(mem, "src/test.txt", []byte("test"), 0644)
+			vfs.WriteFile(mem, "src/gone.txt", []byte("gone"), 0644)
+			mr, _ := New(WithSource("src"), WithDestination("des"), WithFS(mem), WithLogger(testLog),
+				WithBidirectional(true), WithConflict(tt.policy))
+			syncBoth(t, mr)
+
+			// both sides change, the destination last
+			earlier, later := time.Now().Add(-time.Hour), time.Now()
+			vfs.WriteFile(mem, "src/test.txt", []byte("source"), 0644)
+			mem.Chtimes("src/test.txt", earlier, earlier)
+			vfs.WriteFile(mem, "des/test.txt", []byte("destination"), 0644)
+			mem.Chtimes("des/test.txt", later, later)
+			// removed from one side and changed on the other
+			mem.Remove("src/gone.txt")
+			vfs.WriteFile(mem, "des/gone.txt", []byte("changed"), 0644)
+			syncBoth(t, mr)
+
+			expectFile(t, mem, "src/test.txt", tt.expected)
+			expectFile(t, mem, "des/test.txt", tt.expected)
+			kept := ""
+			if tt.policy != ConflictSource {
+				kept = "changed"
+			}
+			expectFile(t, mem, "src/gone.txt", kept)
+			expectFile(t, mem, "des/gone.txt", kept)
+
+			files, _ := mem.ReadDir("src")
+			var conflicts []string
+			for _, f := range files {
+				if strings.Contains(f.Name(), ".conflict-") {
+					conflicts = append(conflicts, f.Name())
+				}
+			}
+			if tt.policy != ConflictKeepBoth {
+				if len(conflicts) != 0 {
+					t.Errorf("Expected no conflict copies got %v", conflicts)
+				}
+				return
+			}
+			host, _ := os.Hostname()
+			if len(conflicts) != 1 || !strings.HasPrefix(conflicts[0], "test.txt.conflict-"+host+"-") {
+				t.Fatalf("Expected a conflict copy got %v", conflicts)
+			}
+			expectFile(t, mem, path.Join("src", conflicts[0]), "destination")
+			expectFile(t, mem, path.Join("des", conflicts[0]), "destination")
+		})
+	}
+}
+
+func TestBidirectionalWatch(t *testing.T) {
+	src, des := "testdir/bisrc", "testdir/bides"
+	os.MkdirAll(src, 0777)
+	os.MkdirAll(des, 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(des)
+
+	mr, _ := New(WithSource(src), WithDestination(des), WithBackend(BackendPoll), WithInterval(10*time.Millisecond),
+		WithDebounce(-1), WithLogger(testLog), WithBidirectional(true))
+	if err := mr.Start(context.Background()); err != nil {
+		t.Fatalf("Error starting mirror: %v", err)
+	}
+	defer mr.Stop()
+
+	wait := func(fp, expected string) {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if b, _ := ioutil.ReadFile(fp); string(b) == expected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for '%v' to hold '%v'", fp, expected)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	ioutil.WriteFile(des+"/test.txt", []byte("destination"), 0644)
+	wait(src+"/test.txt", "destination")
+	ioutil.WriteFile(src+"/test.txt", []byte("source"), 0644)
+	wait(des+"/test.txt", "source")
+}
+
+func TestBidirectionalErrors(t *testing.T) {
+	mr, _ := New(WithSource("src"), WithDestination("zip://out/des.zip"), WithFS(vfs.NewMem()),
+		WithLogger(testLog), WithBidirectional(true))
+	if err := mr.Sync(context.Background()); err == nil || !strings.Contains(err.Error(), "local destination") {
+		t.Errorf("Expected an error syncing both ways with an archive got %v", err)
+	}
+
+	for name, expected := range map[string]ConflictPolicy{"": ConflictNewest, "keep-both": ConflictKeepBoth} {
+		if c, err := ParseConflict(name); c != expected || err != nil {
+			t.Errorf("Expected '%v' parsing '%v' got '%v' (%v)", expected, name, c, err)
+		}
+	}
+	if _, err := ParseConflict("mine"); err == nil {
+		t.Errorf("Expected an error parsing an unknown conflict policy.")
+	}
+}
@@ -0,0 +1,174 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"strings"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// defaultDebounce is the quiet window used when a pair doesn't set one.
+const defaultDebounce = time.Millisecond * 100
+
+// pending is everything that happened to a single path since it was last dispatched.
+type pending struct {
+	event watcher.Event
+	// op is the create, write or remove that still has to happen, if hasOp is set.
+	op    watcher.Op
+	hasOp bool
+	chmod bool
+	// created is set when the path didn't exist before its first event.
+	created bool
+	last    time.Time
+}
+
+// coalescer holds events back until their path has been quiet for the window, and collapses
+// everything that happened to the path in the meantime into as few events as possible.
+type coalescer struct {
+	window  time.Duration
+	pending map[string]*pending
+	order   []string
+	out     chan watcher.Event
+}
+
+// newCoalescer creates a coalescer with the given quiet window.
+func newCoalescer(window time.Duration) *coalescer {
+	return &coalescer{
+		window:  window,
+		pending: make(map[string]*pending),
+		out:     make(chan watcher.Event),
+	}
+}
+
+// run coalesces the events coming in until done is closed.
+func (c *coalescer) run(in <-chan watcher.Event, done <-chan struct{}) {
+	ticker := time.NewTicker(c.window / 2)
+	defer ticker.Stop()
+	for {
+		var events []watcher.Event
+		select {
+		case event := <-in:
+			events = c.add(event, time.Now())
+		case now := <-ticker.C:
+			events = c.flush(now, false)
+		case <-done:
+			return
+		}
+		for _, event := range events {
+			select {
+			case c.out <- event:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// add records the event and returns anything that has to be dispatched straight away.
+func (c *coalescer) add(event watcher.Event, now time.Time) []watcher.Event {
+	switch event.Op {
+	case watcher.Create, watcher.Write, watcher.Remove, watcher.Chmod:
+		c.merge(event.Path, event, event.Op, now)
+		return nil
+	case watcher.Rename, watcher.Move:
+		path := strings.Split(event.Path, " -> ")
+		if len(path) == 2 {
+			// a file created and then renamed, like an editor's temp file, is only a create
+			// of its new name. Directories are left alone as their contents would have to
+			// follow them.
+			isDir := event.FileInfo != nil && event.IsDir()
+			if p, ok := c.pending[path[0]]; ok && p.hasOp && p.op == watcher.Create && !isDir {
+				c.drop(path[0])
+				created := watcher.Event{Op: watcher.Create, Path: path[1], FileInfo: event.FileInfo}
+				c.merge(path[1], created, watcher.Create, now)
+				return nil
+			}
+		}
+	}
+
+	// anything else has to keep its place in line, so everything before it goes first
+	return append(c.flush(now, true), event)
+}
+
+// merge folds the op into whatever is already pending for the path.
+func (c *coalescer) merge(path string, event watcher.Event, op watcher.Op, now time.Time) {
+	p, ok := c.pending[path]
+	if !ok {
+		p = &pending{event: event, op: op, hasOp: true, created: op == watcher.Create}
+		if op == watcher.Chmod {
+			p.hasOp = false
+			p.chmod = true
+		}
+		c.pending[path] = p
+		c.order = append(c.order, path)
+		p.last = now
+		return
+	}
+
+	p.last = now
+	p.event.FileInfo = event.FileInfo
+	switch op {
+	case watcher.Create:
+		// removed and created again, so it's a new file either way
+		p.op, p.hasOp = watcher.Create, true
+	case watcher.Write:
+		if !p.hasOp || p.op != watcher.Create {
+			p.op, p.hasOp = watcher.Write, true
+		}
+	case watcher.Chmod:
+		if !p.hasOp || p.op != watcher.Create {
+			p.chmod = true
+		}
+	case watcher.Remove:
+		if p.created {
+			// it never made it to the destination, so there is nothing to do
+			c.drop(path)
+			return
+		}
+		p.op, p.hasOp = watcher.Remove, true
+		p.chmod = false
+	}
+}
+
+// drop forgets everything pending for the path.
+func (c *coalescer) drop(path string) {
+	delete(c.pending, path)
+	for i, fp := range c.order {
+		if fp == path {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// flush returns the events of every path that has been quiet for the window, or of every path
+// when forced, in the order the paths first changed.
+func (c *coalescer) flush(now time.Time, force bool) []watcher.Event {
+	var events []watcher.Event
+	var order []string
+	for _, path := range c.order {
+		p := c.pending[path]
+		if !force && now.Sub(p.last) < c.window {
+			order = append(order, path)
+			continue
+		}
+		delete(c.pending, path)
+		if p.hasOp {
+			event := p.event
+			event.Op = p.op
+			events = append(events, event)
+		}
+		if p.chmod {
+			event := p.event
+			event.Op = watcher.Chmod
+			events = append(events, event)
+		}
+	}
+	c.order = order
+	return events
+}
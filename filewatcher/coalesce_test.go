@@ -0,0 +1,115 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+func TestCoalesce(t *testing.T) {
+	window := 100 * time.Millisecond
+	start := time.Now()
+	ev := func(op watcher.Op, path string) watcher.Event {
+		return watcher.Event{Op: op, Path: path}
+	}
+
+	tests := []struct {
+		name     string
+		events   []watcher.Event
+		expected []watcher.Event
+	}{
+		{
+			"create, write and chmod is one create",
+			[]watcher.Event{ev(watcher.Create, "a"), ev(watcher.Write, "a"), ev(watcher.Chmod, "a"), ev(watcher.Write, "a")},
+			[]watcher.Event{ev(watcher.Create, "a")},
+		},
+		{
+			"create and remove cancel out",
+			[]watcher.Event{ev(watcher.Create, "a"), ev(watcher.Write, "a"), ev(watcher.Remove, "a")},
+			nil,
+		},
+		{
+			"write and remove is a remove",
+			[]watcher.Event{ev(watcher.Write, "a"), ev(watcher.Remove, "a")},
+			[]watcher.Event{ev(watcher.Remove, "a")},
+		},
+		{
+			"remove and create is a create",
+			[]watcher.Event{ev(watcher.Remove, "a"), ev(watcher.Create, "a")},
+			[]watcher.Event{ev(watcher.Create, "a")},
+		},
+		{
+			"a file that existed is still removed",
+			[]watcher.Event{ev(watcher.Remove, "a"), ev(watcher.Create, "a"), ev(watcher.Remove, "a")},
+			[]watcher.Event{ev(watcher.Remove, "a")},
+		},
+		{
+			"writes and a chmod are kept apart",
+			[]watcher.Event{ev(watcher.Chmod, "a"), ev(watcher.Write, "a"), ev(watcher.Write, "a")},
+			[]watcher.Event{ev(watcher.Write, "a"), ev(watcher.Chmod, "a")},
+		},
+		{
+			"paths come out in the order they first changed",
+			[]watcher.Event{ev(watcher.Write, "b"), ev(watcher.Create, "a"), ev(watcher.Write, "b")},
+			[]watcher.Event{ev(watcher.Write, "b"), ev(watcher.Create, "a")},
+		},
+		{
+			"a renamed temp file is a create",
+			[]watcher.Event{ev(watcher.Create, "a.tmp"), ev(watcher.Write, "a.tmp"), ev(watcher.Rename, "a.tmp -> a")},
+			[]watcher.Event{ev(watcher.Create, "a")},
+		},
+		{
+			"a rename flushes everything before it",
+			[]watcher.Event{ev(watcher.Write, "b"), ev(watcher.Rename, "a -> c")},
+			[]watcher.Event{ev(watcher.Write, "b"), ev(watcher.Rename, "a -> c")},
+		},
+	}
+
+	for _, test := range tests {
+		c := newCoalescer(window)
+		var actual []watcher.Event
+		for i, event := range test.events {
+			actual = append(actual, c.add(event, start.Add(time.Duration(i)*time.Millisecond))...)
+		}
+		if events := c.flush(start.Add(window/2), false); len(events) != 0 {
+			t.Errorf("%v: events were flushed before the window passed: %v", test.name, events)
+		}
+		actual = append(actual, c.flush(start.Add(2*window), false)...)
+
+		if len(actual) != len(test.expected) {
+			t.Errorf("%v: expected %v events got %v", test.name, len(test.expected), len(actual))
+			continue
+		}
+		for i := range actual {
+			if actual[i].Op != test.expected[i].Op || actual[i].Path != test.expected[i].Path {
+				t.Errorf("%v: expected %v '%v' got %v '%v'", test.name, test.expected[i].Op, test.expected[i].Path, actual[i].Op, actual[i].Path)
+			}
+		}
+	}
+}
+
+func TestCoalescerRun(t *testing.T) {
+	in := make(chan watcher.Event)
+	done := make(chan struct{})
+	defer close(done)
+	c := newCoalescer(20 * time.Millisecond)
+	go c.run(in, done)
+
+	in <- watcher.Event{Op: watcher.Create, Path: "a"}
+	in <- watcher.Event{Op: watcher.Write, Path: "a"}
+
+	select {
+	case event := <-c.out:
+		if event.Op != watcher.Create || event.Path != "a" {
+			t.Errorf("Expected CREATE 'a' got %v '%v'", event.Op, event.Path)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Timed out waiting for the coalesced event.")
+	}
+}
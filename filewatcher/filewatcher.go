@@ -6,345 +6,1216 @@
 package filewatcher
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/KaiserGald/logger"
+	"github.com/KaiserGald/mimic/destination"
 	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/ignore"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/state"
+	"github.com/KaiserGald/mimic/vfs"
 	"github.com/radovskyb/watcher"
 )
 
-var l *logger.Logger
+// DeletePolicy decides what happens in the destination when something is removed from the source.
+type DeletePolicy string
 
-// initWatcher will initialize the watcher with any configuration an return the watcher, it also gets and returns the relative filepath to the source directory
-func initWatcher(srcfp string) (*watcher.Watcher, string, error) {
-	w := watcher.New()
-	w.IgnoreHiddenFiles(true)
-	filehandler.Init(l)
+const (
+	// DeleteMirror removes the file from the destination as well.
+	DeleteMirror DeletePolicy = "mirror"
+	// DeleteKeep leaves the file in the destination.
+	DeleteKeep DeletePolicy = "keep"
+)
 
-	// get relative file path
-	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
-	if err != nil {
-		return nil, "", err
+// stateSaveInterval is how often the state index is written to disk while mirroring.
+const stateSaveInterval = time.Second
+
+// defaultInterval is how often the source is polled when a pair doesn't set an interval.
+const defaultInterval = time.Millisecond * 100
+
+// Hooks are shell commands that are run after mimic has changed the destination.
+type Hooks struct {
+	// AfterSync runs once the destination tree has been initialized.
+	AfterSync string
+	// AfterChange runs after every event that was mirrored into the destination.
+	AfterChange string
+}
+
+// Pair is a single source directory and the destination it is mirrored into.
+type Pair struct {
+	Source string
+	// Destination is a local directory or the URL of a destination, see the destination package.
+	Destination string
+	// Ignore holds gitignore style patterns for paths that are never mirrored.
+	Ignore []string
+	// Include holds patterns for paths that are mirrored even though an Ignore pattern matches.
+	Include []string
+	// Backend is the name of the backend used to watch the source, the platform default is used
+	// when it's empty.
+	Backend string
+	// Interval is how often the source is polled for changes by the poll backend.
+	Interval time.Duration
+	// Debounce is how long a path has to be quiet before its events are mirrored, 0 uses the
+	// default and a negative window mirrors every event straight away.
+	Debounce time.Duration
+	// Delete is the policy used when files are removed from the source.
+	Delete DeletePolicy
+	// Compare decides which files are copied, files that are the same in the source and
+	// destination are skipped.
+	Compare filehandler.Compare
+	// InPlace writes straight into the destination files instead of renaming a temporary file
+	// over them.
+	InPlace bool
+	// StateDir is where the pair's state index is kept. When it's empty the index is kept in a
+	// local destination, or in the user's cache directory for any other destination.
+	StateDir string
+	// Prune reconciles the destination with the source on startup.
+	Prune Prune
+	// Retries is how many times an event that failed with a transient error is retried before it
+	// is given up on, 0 uses the default and a negative number never retries.
+	Retries int
+	// FailFast stops the pair on the first error instead of retrying it.
+	FailFast bool
+	// Bidirectional mirrors changes made in the destination back into the source as well, the
+	// destination has to be a local directory.
+	Bidirectional bool
+	// Conflict is the policy used in bidirectional mode when a path changed on both sides.
+	Conflict ConflictPolicy
+	// Symlinks is the policy for symlinks in the source, they are preserved when it's empty.
+	Symlinks SymlinkPolicy
+	// Preserve is the metadata copied into the destination along with modes.
+	Preserve filehandler.Preserve
+	// HardLinks keeps files that are hard links to each other in the source linked in the
+	// destination, instead of copying each of them. It's ignored in bidirectional mode.
+	HardLinks bool
+	// ProgressSize is the size from which the progress of copying a file is logged, nothing is
+	// logged when it's 0.
+	ProgressSize int64
+	// Delta updates large files that changed by writing only the parts of them that did, in local
+	// destinations.
+	Delta bool
+	Hooks Hooks
+}
+
+// String returns the pair in the same 'SOURCE:DESTINATION' form it is given on the command line.
+func (p Pair) String() string {
+	return p.Source + ":" + p.Destination
+}
+
+// mirror holds the watcher state for a single pair.
+type mirror struct {
+	Pair
+	relfp string
+	w     Backend
+	log   logging.Logger
+	files *filehandler.Handler
+	dest  destination.Destination
+	// back writes into the source, dw watches the destination and desRoot is its absolute path,
+	// in bidirectional mode.
+	back    destination.Destination
+	dw      Backend
+	desRoot string
+
+	mu      sync.RWMutex
+	matcher *ignore.Matcher
+	state   *state.DB
+	dead    []deadLetter
+
+	// ctx stops the pair when it's done, a nil ctx never stops it.
+	ctx context.Context
+	// next is the latest change to the pair, the event loop is told about it on updated.
+	next    *Pair
+	updated chan struct{}
+	// notify is told about every event that was mirrored or given up on, when it's set.
+	notify func(Event)
+	// started is closed once the initial sync is done and the source is being watched.
+	started chan struct{}
+	// quit stops the event loop when watching fails after it was started.
+	quit chan struct{}
+	// links indexes the files in the source with more than one hard link, when they're preserved.
+	links hardLinks
+}
+
+// newMirror returns the mirror for the pair, which stops when the context is done. The source is
+// read through the file system, a nil one is the OS, and so is a local destination.
+func newMirror(ctx context.Context, p Pair, lg logging.Logger, fsys vfs.FS) *mirror {
+	m := &mirror{
+		Pair:    p,
+		log:     lg,
+		files:   filehandler.New(lg, fsys),
+		ctx:     ctx,
+		updated: make(chan struct{}, 1),
+		started: make(chan struct{}),
 	}
-	relfp := strings.Join([]string{dir, srcfp}, "/")
+	// event paths are absolute, so the source is resolved against the working directory, which
+	// is where it's given relative to, rather than the directory of the program
+	m.relfp, _ = vfs.Abs(m.files.FS(), p.Source)
+	return m
+}
 
-	return w, relfp, nil
+// initWatcher will initialize the watcher with any configuration and return it.
+func initWatcher(p Pair, filter FilterFunc) (Backend, error) {
+	return newBackend(p.Backend, p.Interval, filter)
 }
 
 // WatchFiles will watch the files at the specified filepath and will fire off an
 // event when a change happens
-func WatchFiles(srcfp, desfp string, lg *logger.Logger) error {
-	l = lg
-	l.Debug.Log("Initializing watcher...")
-	w, relfp, err := initWatcher(srcfp)
+func WatchFiles(srcfp, desfp string, lg logging.Logger) error {
+	return WatchPairs([]Pair{{Source: srcfp, Destination: desfp}}, lg)
+}
+
+// WatchPairs watches every pair at once until they all stop, see WatchPairsContext.
+func WatchPairs(pairs []Pair, lg logging.Logger) error {
+	return WatchPairsContext(context.Background(), pairs, lg)
+}
+
+// WatchPairsContext watches every pair at once, each with its own watcher. A pair that fails is
+// logged and stopped without affecting the others. When the context is done every pair stops
+// taking new events, finishes the one it is mirroring, saves its state and closes its watcher and
+// destination. WatchPairsContext blocks until every pair has stopped and returns an error if any of them
+// failed, unless a pair that fails fast fails, in which case its error is returned straight away.
+func WatchPairsContext(ctx context.Context, pairs []Pair, lg logging.Logger) error {
+	g := NewGroup(ctx, lg)
+	g.Update(pairs)
+	return g.Wait()
+}
+
+// watch initializes the destination tree for the pair and then mirrors any changes made to
+// the source until the watcher is closed.
+func (m *mirror) watch() error {
+	m.log.Debug("Initializing watcher...")
+	w, err := initWatcher(m.Pair, m.filterHook)
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("Done")
-	l.Notice.Log("Initializing the destination file tree...")
-	err = initializeFileTree(srcfp, desfp, relfp)
-	if err != nil {
+	m.w = w
+	m.log.Debug("Done")
+	if err := m.sync(); err != nil {
+		m.closeDestination()
 		return err
 	}
-	l.Debug.Log("Done initializing destination file tree.")
+	if m.stopping() {
+		m.closeDestination()
+		return nil
+	}
 	// listen for events
-	l.Info.Log("Listening for events at '%v'.", relfp)
+	m.log.Info("[%v] Listening for events at '%v'.", m, m.relfp)
+	events := w.Events()
+	if m.Bidirectional {
+		if events, err = m.watchDestination(w); err != nil {
+			m.closeDestination()
+			return err
+		}
+	}
+	window := m.Debounce
+	if window == 0 {
+		window = defaultDebounce
+	}
+	if window > 0 {
+		m.log.Debug("Coalescing events over %v.", window)
+		c := newCoalescer(window)
+		go c.run(events, w.Closed())
+		events = c.out
+	}
+	// the loop saves the state and closes the destination once it's done, which is what writes
+	// archives out, so watch doesn't return until it has
+	fatal := make(chan error, 1)
+	finished := make(chan struct{})
+	m.quit = make(chan struct{})
+	stop := func(err error) error {
+		close(m.quit)
+		<-finished
+		return err
+	}
 	go func() {
-		for {
-			select {
-			case event := <-w.Event:
-				l.Debug.Log(event.String())
-				switch event.Op.String() {
-				case "CREATE":
-					l.Debug.Log("CREATE event occured at '%v'", event.Path)
-					err = handleCreate(event, srcfp, desfp, relfp)
-					if err != nil {
-						return
-					}
-					l.Debug.Log("CREATE event handled.")
-
-				case "WRITE":
-					l.Debug.Log("WRITE event occured at '%v'", event.Path)
-					err = handleWrite(event, srcfp, desfp, relfp)
-					if err != nil {
-						return
-					}
-					l.Debug.Log("WRITE event handled.")
-
-				case "REMOVE":
-					l.Debug.Log("REMOVE event occured at '%v'", event.Path)
-					err = handleRemove(event, srcfp, desfp, relfp)
-					if err != nil {
-						return
-					}
-					l.Debug.Log("REMOVE event handled.")
-
-				case "RENAME":
-					l.Debug.Log("RENAME event occured at '%v'", event.Path)
-					err = handleRename(event, desfp, relfp)
-					if err != nil {
-						return
-					}
-					l.Debug.Log("RENAME event handled.")
-
-				case "CHMOD":
-					l.Debug.Log("CHMOD event occured at '%v'", event.Path)
-					err = handleChmod(event, srcfp, desfp, relfp)
-					if err != nil {
-						return
-					}
-					l.Debug.Log("CHMOD event handled.")
-
-				case "MOVE":
-					l.Debug.Log("MOVE event occured at '%v'", event.Path)
-					err = handleMove(event, srcfp, desfp, relfp)
-					if err != nil {
-						return
-					}
-					l.Debug.Log("MOVE event handled.")
-				}
-
-			case err := <-w.Error:
-				l.Error.Log(err.Error())
-				return
-			case <-w.Closed:
-				return
-			}
+		defer close(finished)
+		if err := m.loop(events); err != nil {
+			fatal <- err
 		}
+		m.log.Debug("Saving state...")
+		if err := m.state.Save(); err != nil {
+			m.log.Error("[%v] Error saving state: %v", m, err)
+		}
+		m.log.Debug("Closing watcher...")
+		w.Close()
+		if m.dw != nil {
+			m.dw.Close()
+		}
+		m.closeDestination()
 	}()
 
-	l.Debug.Log("Adding '%v' to be watched...", srcfp)
-	if err := w.AddRecursive(srcfp); err != nil {
-		return err
+	m.log.Debug("Adding '%v' to be watched...", m.Source)
+	if err := w.AddRecursive(m.Source); err != nil {
+		return stop(err)
 	}
 
 	for path, f := range w.WatchedFiles() {
-		l.Info.Log("%s is mimicking %s", f.Name(), path)
+		m.log.Info("[%v] %s is mimicking %s", m, f.Name(), path)
+	}
+
+	m.log.Debug("Done.")
+	m.log.Notice("[%v] Mimic successfully started!", m)
+	if m.started != nil {
+		close(m.started)
+	}
+
+	if err := w.Start(); err != nil {
+		return stop(err)
+	}
+	<-finished
+
+	select {
+	case err := <-fatal:
+		return err
+	default:
+	}
+	m.log.Notice("[%v] Stopped.", m)
+	return nil
+}
+
+// sync loads the ignore rules and the state index and brings the destination up to date with the
+// source. It returns early, without an error, when the pair is asked to stop.
+func (m *mirror) sync() error {
+	m.log.Debug("Opening destination...")
+	if err := m.openDestination(); err != nil {
+		return err
+	}
+	m.log.Debug("Done")
+	if m.Bidirectional {
+		m.log.Debug("Opening source as a destination...")
+		if err := m.openSource(); err != nil {
+			return err
+		}
+		m.log.Debug("Done")
+	}
+	m.log.Debug("Loading ignore rules...")
+	if err := m.loadIgnore(); err != nil {
+		return err
+	}
+	m.log.Debug("Done")
+	m.log.Debug("Opening state index...")
+	if err := m.openState(); err != nil {
+		return err
+	}
+	m.log.Debug("Done")
+	if m.Bidirectional {
+		if err := m.syncBoth(); err != nil {
+			return err
+		}
+		if m.stopping() {
+			return nil
+		}
+		m.runHook("after_sync", m.Hooks.AfterSync)
+		return nil
+	}
+	m.log.Notice("[%v] Initializing the destination file tree...", m)
+	if err := m.initializeFileTree(); err != nil {
+		return err
+	}
+	if m.stopping() {
+		return nil
+	}
+	m.log.Debug("Done initializing destination file tree.")
+	if m.Prune.Enabled {
+		if err := m.prune(); err != nil {
+			return err
+		}
+	}
+	m.runHook("after_sync", m.Hooks.AfterSync)
+	return nil
+}
+
+// openDestination opens the pair's destination with the backend registered for its scheme.
+func (m *mirror) openDestination() error {
+	if m.dest != nil {
+		return nil
+	}
+	des, err := destination.Open(m.Destination, destination.Options{Log: m.log, FS: m.files.FS(), InPlace: m.InPlace, Preserve: m.Preserve, ProgressSize: m.ProgressSize, Delta: m.Delta})
+	if err != nil {
+		return err
 	}
+	m.dest = des
+	return nil
+}
+
+// closeDestination closes the pair's destination, if it was opened.
+func (m *mirror) closeDestination() {
+	if m.dest == nil {
+		return
+	}
+	m.log.Debug("Closing destination...")
+	if err := m.dest.Close(); err != nil {
+		m.log.Error("[%v] Error closing the destination: %v", m, err)
+	}
+}
+
+// done returns a channel that is closed when the pair is asked to stop.
+func (m *mirror) done() <-chan struct{} {
+	if m.ctx == nil {
+		return nil
+	}
+	return m.ctx.Done()
+}
+
+// stopping checks if the pair has been asked to stop.
+func (m *mirror) stopping() bool {
+	select {
+	case <-m.done():
+		return true
+	default:
+		return false
+	}
+}
+
+// loop mirrors the events until the watcher is closed. An event that fails is retried later if
+// the error looks like it will go away, while other events keep being mirrored. A retry is
+// dropped when a newer event for the same path comes in first, so it can't undo that one. loop
+// only returns an error when the pair is set to fail fast.
+func (m *mirror) loop(events <-chan watcher.Event) error {
+	save := time.NewTicker(stateSaveInterval)
+	defer save.Stop()
+	retries := make(chan *attempt)
+	// pending is the attempt waiting to be retried for each path
+	pending := make(map[string]*attempt)
+	for {
+		var a *attempt
+		select {
+		case <-save.C:
+			if err := m.state.Save(); err != nil {
+				m.log.Error("[%v] Error saving state: %v", m, err)
+			}
+			continue
+		case event := <-events:
+			m.log.Debug("%v", event)
+			event, ok := m.filter(event)
+			if !ok {
+				m.log.Debug("'%v' is ignored.", event.Path)
+				continue
+			}
+			a = &attempt{event: event}
+			if _, ok := pending[event.Path]; ok {
+				m.log.Debug("Dropping the retry for '%v', a newer event replaces it.", event.Path)
+				delete(pending, event.Path)
+			}
+		case a = <-retries:
+			if pending[a.event.Path] != a {
+				m.log.Debug("Dropping the retry of %v of '%v', a newer event replaced it.", a.event.Op, a.event.Path)
+				continue
+			}
+			delete(pending, a.event.Path)
+			m.log.Info("[%v] Retrying %v of '%v', attempt %d.", m, a.event.Op, a.event.Path, a.count+1)
+		case err := <-m.w.Errors():
+			if err := m.watchError(err); err != nil {
+				return err
+			}
+			continue
+		case err := <-m.desErrors():
+			if err := m.watchError(err); err != nil {
+				return err
+			}
+			continue
+		case <-m.w.Closed():
+			return nil
+		case <-m.done():
+			m.log.Notice("[%v] Stopping, no longer taking new events.", m)
+			return nil
+		case <-m.quit:
+			return nil
+		case <-m.updated:
+			m.apply()
+			continue
+		}
 
-	l.Debug.Log("Done.")
-	l.Notice.Log("Mimic successfully started!")
+		err := m.dispatch(a.event)
+		if err == nil {
+			m.handled(a.event)
+			continue
+		}
+		if m.FailFast {
+			return err
+		}
+		if m.retry(a, err, retries) {
+			pending[a.event.Path] = a
+		}
+	}
+}
 
-	if err := w.Start(time.Millisecond * 100); err != nil {
+// watchError handles an error from a watcher, it only returns the error when the pair is set to
+// fail fast.
+func (m *mirror) watchError(err error) error {
+	if err == ErrOverflow {
+		m.rescan()
+		return nil
+	}
+	m.log.Error("[%v] %v", m, err.Error())
+	if m.FailFast {
 		return err
 	}
+	return nil
+}
+
+// desErrors returns the errors of the destination's watcher, which is only there in
+// bidirectional mode.
+func (m *mirror) desErrors() <-chan error {
+	if m.dw == nil {
+		return nil
+	}
+	return m.dw.Errors()
+}
+
+// update hands a change to the pair over to its event loop.
+func (m *mirror) update(p Pair) {
+	m.mu.Lock()
+	m.next = &p
+	m.mu.Unlock()
+	select {
+	case m.updated <- struct{}{}:
+	default:
+	}
+}
+
+// apply applies the latest change to the pair. Only the settings that don't need a new watcher
+// are changed, and the ignore rules are reloaded if the patterns changed.
+func (m *mirror) apply() {
+	m.mu.Lock()
+	p := m.next
+	m.next = nil
+	m.mu.Unlock()
+	if p == nil {
+		return
+	}
+
+	m.log.Info("[%v] Applying new settings...", m)
+	filters := !reflect.DeepEqual(m.Ignore, p.Ignore) || !reflect.DeepEqual(m.Include, p.Include)
+	m.Ignore, m.Include = p.Ignore, p.Include
+	m.Delete = p.Delete
+	m.Compare = p.Compare
+	m.Retries = p.Retries
+	m.FailFast = p.FailFast
+	m.Prune = p.Prune
+	m.Conflict = p.Conflict
+	m.Hooks = p.Hooks
+	if filters {
+		if err := m.reloadIgnore(); err != nil {
+			m.log.Error("[%v] Error reloading ignore rules: %v", m, err)
+		}
+	}
+	m.log.Debug("Done applying new settings.")
+}
 
+// dispatch hands the event to its handler.
+func (m *mirror) dispatch(event watcher.Event) error {
+	if m.Bidirectional {
+		m.log.Debug("%v event occured at '%v'", event.Op, event.Path)
+		return m.dispatchBoth(event)
+	}
+	var err error
+	switch event.Op.String() {
+	case "CREATE":
+		m.log.Debug("CREATE event occured at '%v'", event.Path)
+		err = m.handleCreate(event)
+	case "WRITE":
+		m.log.Debug("WRITE event occured at '%v'", event.Path)
+		err = m.handleWrite(event)
+	case "REMOVE":
+		m.log.Debug("REMOVE event occured at '%v'", event.Path)
+		err = m.handleRemove(event)
+	case "RENAME":
+		m.log.Debug("RENAME event occured at '%v'", event.Path)
+		err = m.handleRename(event)
+	case "CHMOD":
+		m.log.Debug("CHMOD event occured at '%v'", event.Path)
+		err = m.handleChmod(event)
+	case "MOVE":
+		m.log.Debug("MOVE event occured at '%v'", event.Path)
+		err = m.handleMove(event)
+	}
+	if err != nil {
+		return err
+	}
+	m.log.Debug("%v event handled.", event.Op)
 	return nil
 }
 
-func initializeFileTree(srcfp, desfp, relfp string) error {
-	l.Debug.Log("Mapping source tree in '%v'...", srcfp)
-	tree, err := mapTree(srcfp)
+// handled runs everything that follows an event that was mirrored.
+func (m *mirror) handled(event watcher.Event) {
+	m.report(event, nil)
+	m.runHook("after_change", m.Hooks.AfterChange, "MIMIC_EVENT="+event.Op.String(), "MIMIC_PATH="+event.Path)
+	if !m.Bidirectional {
+		m.track(event)
+	}
+
+	if ignore.IsIgnoreFile(event.Path) {
+		if err := m.reloadIgnore(); err != nil {
+			m.log.Error("[%v] Error reloading ignore rules: %v", m, err)
+		}
+	}
+}
+
+// initializeFileTree copies everything already in the source into the destination.
+func (m *mirror) initializeFileTree() error {
+	m.log.Debug("Mapping source tree in '%v'...", m.Source)
+	tree, err := m.mapSource(m.Source)
 	if err != nil {
 		return err
 	}
-	l.Debug.Log("Tree: %v", tree)
-	l.Debug.Log("Done.")
-	l.Debug.Log("Starting to copy source tree to destination tree...")
+	m.log.Debug("Tree: %v", tree)
+	m.log.Debug("Done.")
+	m.indexLinks(tree)
+	m.log.Debug("Starting to copy source tree to destination tree...")
 
+	var copied, skipped int
+	// later holds the hard links that are linked to the first path of their file once it's copied
+	var later []string
 	for file := range tree {
+		if m.stopping() {
+			m.log.Notice("[%v] Stopping the initial sync, %d files copied so far.", m, copied)
+			return m.state.Save()
+		}
+
+		m.log.Debug("file: %v", file)
+		if m.isIgnored(file, tree[file].IsDir()) {
+			m.log.Debug("'%v' is ignored.", file)
+			m.state.Remove(file)
+			continue
+		}
 
-		l.Debug.Log("file: %v", file)
+		src, des := filepath.Join(m.Source, file), m.desPath(file)
 
-		l.Debug.Log("Building file paths...")
-		src, des := buildPaths("/"+file, srcfp, desfp, relfp)
-		l.Debug.Log("Done.")
+		if isLink(tree[file]) {
+			if entry, ok := m.state.Get(file); ok && entry.Matches(tree[file]) {
+				if info, err := m.dest.Stat(file); err == nil && isLink(info) {
+					m.log.Debug("Link '%v' hasn't changed since it was last mirrored, skipping it.", src)
+					skipped++
+					continue
+				}
+			}
+			if err := m.copyLink(src, file); err != nil {
+				m.log.Error("[%v] Error copying a symlink: %v", m, err)
+				return err
+			}
+			copied++
+			m.record(file)
+			continue
+		}
 
-		l.Debug.Log("Is file a directory?")
+		m.log.Debug("Is file a directory?")
 		if !tree[file].IsDir() {
-			l.Debug.Log("No!")
-			l.Info.Log("Copying '%v' into '%v'", src, des)
-			err := filehandler.CopyFile(src, des)
+			m.log.Debug("No!")
+			if first, ok := m.firstLink(tree[file]); ok && first != file {
+				m.log.Debug("'%v' is a hard link to '%v', linking it after the copy.", src, first)
+				later = append(later, file)
+				continue
+			}
+			if m.synced(file, tree[file], src) {
+				m.log.Debug("'%v' hasn't changed since it was last mirrored, skipping it.", src)
+				skipped++
+				continue
+			}
+			differs, err := m.dest.Differs(src, file, m.compare())
 			if err != nil {
-				l.Error.Log("Error copying a file: %v", err)
+				m.log.Error("[%v] Error comparing a file: %v", m, err)
 				return err
 			}
+			if !differs {
+				m.log.Debug("'%v' is unchanged, skipping it.", src)
+				m.record(file)
+				skipped++
+				continue
+			}
+			m.log.Info("[%v] Copying '%v' into '%v'", m, src, des)
+			err = m.dest.CopyFile(src, file)
+			if err != nil {
+				m.log.Error("[%v] Error copying a file: %v", m, err)
+				return err
+			}
+			copied++
+			m.record(file)
 		} else {
-			l.Debug.Log("Yes!")
-			l.Info.Log("Copying '%v' into '%v'", src, des)
-			err := filehandler.CopyDir(src, des)
+			m.log.Debug("Yes!")
+			m.log.Info("[%v] Copying '%v' into '%v'", m, src, des)
+			err := m.dest.CopyDir(src, file)
 			if err != nil {
-				l.Error.Log("Error copying a directory: %v", err)
+				m.log.Error("[%v] Error copying a directory: %v", m, err)
 				return err
 			}
+			m.record(file)
 		}
-		l.Debug.Log("Copy complete!")
+		m.log.Debug("Copy complete!")
 	}
 
-	l.Debug.Log("Done copying source tree to destination tree.")
+	sort.Strings(later)
+	for _, file := range later {
+		src := filepath.Join(m.Source, file)
+		if m.synced(file, tree[file], src) {
+			m.log.Debug("'%v' hasn't changed since it was last mirrored, skipping it.", src)
+			skipped++
+			continue
+		}
+		first, _ := m.firstLink(tree[file])
+		linked, err := m.linkFile(first, file)
+		if err != nil {
+			m.log.Error("[%v] Error linking a file: %v", m, err)
+			return err
+		}
+		if !linked {
+			m.log.Info("[%v] Copying '%v' into '%v'", m, src, m.desPath(file))
+			if err := m.dest.CopyFile(src, file); err != nil {
+				m.log.Error("[%v] Error copying a file: %v", m, err)
+				return err
+			}
+		}
+		copied++
+		m.record(file)
+	}
+
+	m.log.Debug("Done copying source tree to destination tree.")
+	removed := m.removeOffline(tree)
+	if err := m.state.Save(); err != nil {
+		m.log.Error("[%v] Error saving state: %v", m, err)
+	}
+	m.log.Notice("[%v] Initial sync done, %d files copied, %d unchanged files skipped and %d removed.", m, copied, skipped, removed)
+	return nil
+}
+
+// openState opens the pair's state index. Without a state directory it's kept in a local
+// destination, otherwise it's named after the pair so several pairs can share the directory.
+// Other destinations without a state directory keep it in mimic's directory in the user's cache.
+func (m *mirror) openState() error {
+	local, isLocal := m.dest.(*destination.Local)
+	dir := m.StateDir
+	if dir == "" && !isLocal {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(cache, "mimic")
+	}
+
+	var path string
+	if dir == "" {
+		path = local.Path(state.FileName)
+	} else {
+		src, _ := vfs.Abs(m.files.FS(), m.Source)
+		des := m.Destination
+		if isLocal {
+			des, _ = vfs.Abs(m.files.FS(), local.Root())
+		}
+		sum := sha256.Sum256([]byte(src + ":" + des))
+		path = filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+	}
+	m.log.Debug("State index: '%v'", path)
+	db, err := state.OpenFS(m.files.FS(), path)
+	if err != nil {
+		return err
+	}
+	m.state = db
 	return nil
 }
 
+// synced checks the state index to see if the file was mirrored before and hasn't changed
+// since, which saves comparing it against the destination.
+func (m *mirror) synced(rel string, info os.FileInfo, src string) bool {
+	entry, ok := m.state.Get(rel)
+	if !ok || m.compare() == filehandler.CompareAlways {
+		return false
+	}
+	desinfo, err := m.dest.Stat(rel)
+	if err != nil || desinfo.Size() != info.Size() {
+		return false
+	}
+	if entry.Matches(info) {
+		return true
+	}
+	// only touched, the hash of the contents mirrored last time can still tell it hasn't changed
+	if m.compare() != filehandler.CompareHash || entry.Hash == "" || entry.Size != info.Size() {
+		return false
+	}
+	sum, err := m.files.HashFile(src)
+	if err != nil || hex.EncodeToString(sum) != entry.Hash {
+		return false
+	}
+	m.record(rel)
+	return true
+}
+
+// record saves the current state of the source path in the state index.
+func (m *mirror) record(rel string) {
+	if m.state == nil {
+		return
+	}
+	src := filepath.Join(m.Source, rel)
+	info, err := m.statSource(src)
+	if err != nil {
+		m.log.Debug("Not recording '%v': %v", src, err)
+		return
+	}
+	var hash string
+	if m.compare() == filehandler.CompareHash && info.Mode().IsRegular() {
+		if sum, err := m.files.HashFile(src); err == nil {
+			hash = hex.EncodeToString(sum)
+		}
+	}
+	m.state.Put(rel, state.NewEntry(info, hash))
+}
+
+// track updates the state index after an event was mirrored.
+func (m *mirror) track(event watcher.Event) {
+	switch event.Op {
+	case watcher.Create, watcher.Write, watcher.Chmod:
+		m.record(m.relPath(event.Path))
+	case watcher.Remove:
+		m.state.Remove(m.relPath(event.Path))
+	case watcher.Rename, watcher.Move:
+		path := strings.Split(event.Path, " -> ")
+		if len(path) == 2 {
+			m.state.Rename(m.relPath(path[0]), m.relPath(path[1]))
+		}
+	}
+}
+
+// removeOffline removes everything from the destination that was mirrored before but has been
+// removed from the source while mimic wasn't running, and returns how many paths it removed.
+func (m *mirror) removeOffline(tree map[string]os.FileInfo) int {
+	var gone []string
+	for _, file := range m.state.Paths() {
+		if _, ok := tree[file]; !ok {
+			gone = append(gone, file)
+		}
+	}
+	// remove the deepest paths first so directories are empty by the time they are removed
+	sort.Sort(sort.Reverse(sort.StringSlice(gone)))
+
+	var removed int
+	for _, file := range gone {
+		m.state.Remove(file)
+		des := m.desPath(file)
+		if m.Delete == DeleteKeep {
+			m.log.Info("[%v] Keeping '%v', the delete policy is '%v'.", m, des, m.Delete)
+			continue
+		}
+		m.log.Info("[%v] '%v' was removed while mimic was stopped, removing '%v'.", m, file, des)
+		if err := m.dest.Remove(file); err != nil && !os.IsNotExist(err) {
+			m.log.Error("[%v] Error removing '%v': %v", m, des, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// compare returns the pair's comparison strategy.
+func (m *mirror) compare() filehandler.Compare {
+	if m.Compare == "" {
+		return filehandler.CompareSize
+	}
+	return m.Compare
+}
+
+// rescan copies the whole source tree again after the backend lost track of events.
+func (m *mirror) rescan() {
+	m.log.Notice("[%v] Events were lost, rescanning the source...", m)
+	sync := m.initializeFileTree
+	if m.Bidirectional {
+		sync = m.syncBoth
+	}
+	if err := sync(); err != nil {
+		m.log.Error("[%v] Error rescanning the source: %v", m, err)
+		return
+	}
+	m.log.Debug("Done rescanning.")
+}
+
 // handleCreate handles the create events for both directories and files.
-func handleCreate(event watcher.Event, srcfp, desfp, relfp string) error {
+func (m *mirror) handleCreate(event watcher.Event) error {
+	if src, rel := m.paths(event.Path); m.linked(src) {
+		m.log.Info("[%v] Copying symlink %v to %v...", m, src, m.desPath(rel))
+		if err := m.copyPath(src, rel); err != nil {
+			m.log.Error("[%v] Error copying symlink: %v", m, err)
+			return err
+		}
+		return nil
+	}
 	if event.IsDir() {
-		l.Debug.Log("Building paths...")
-		src, des := buildPaths(event.Path, srcfp, desfp, relfp)
-		l.Debug.Log("Done.")
-		l.Info.Log("Copying directory %v to %v...", src, des)
-		err := filehandler.CopyDir(src, des)
+		m.log.Debug("Building paths...")
+		src, rel := m.paths(event.Path)
+		m.log.Debug("Done.")
+		m.log.Info("[%v] Copying directory %v to %v...", m, src, m.desPath(rel))
+		err := m.dest.CopyDir(src, rel)
 		if err != nil {
-			l.Error.Log("Error copying directory: %v", err)
+			m.log.Error("[%v] Error copying directory: %v", m, err)
 			return err
 		}
-		l.Debug.Log("Done copying directory.")
+		m.log.Debug("Done copying directory.")
 	} else {
-		l.Debug.Log("Building paths...")
-		src, des := buildPaths(event.Path, srcfp, desfp, relfp)
-		l.Debug.Log("Done.")
-		l.Info.Log("Copying file %v to %v...", src, des)
-		err := filehandler.CopyFile(src, des)
+		m.log.Debug("Building paths...")
+		src, rel := m.paths(event.Path)
+		m.log.Debug("Done.")
+		m.log.Info("[%v] Copying file %v to %v...", m, src, m.desPath(rel))
+		info, err := m.files.FS().Lstat(src)
+		if err != nil {
+			m.log.Error("[%v] Error copying file: %v", m, err)
+			return err
+		}
+		err = m.copyLinked(src, rel, info)
 		if err != nil {
-			l.Error.Log("Error copying file: %v", err)
+			m.log.Error("[%v] Error copying file: %v", m, err)
 			return err
 		}
-		l.Debug.Log("Done copying file.")
+		m.log.Debug("Done copying file.")
 	}
 	return nil
 }
 
 // handleWrite handles the write events for files.
-func handleWrite(event watcher.Event, srcfp, desfp, relfp string) error {
-	l.Debug.Log("Is WRITE event at a direcory?")
+func (m *mirror) handleWrite(event watcher.Event) error {
+	m.log.Debug("Is WRITE event at a direcory?")
 	if !event.IsDir() {
-		l.Debug.Log("No!")
-		l.Debug.Log("Building paths...")
-		src, des := buildPaths(event.Path, srcfp, desfp, relfp)
-		l.Debug.Log("Done.")
-		l.Info.Log("Copying '%v' into '%v'.", src, des)
-		err := filehandler.CopyFile(src, des)
+		m.log.Debug("No!")
+		m.log.Debug("Building paths...")
+		src, rel := m.paths(event.Path)
+		m.log.Debug("Done.")
+		if m.linked(src) && m.symlinks() != SymlinkFollow {
+			m.log.Info("[%v] Copying symlink '%v' into '%v'.", m, src, m.desPath(rel))
+			return m.copyPath(src, rel)
+		}
+		differs, err := m.dest.Differs(src, rel, m.compare())
+		if err != nil {
+			m.log.Error("[%v] Error comparing file: %v", m, err)
+			return err
+		}
+		if !differs {
+			m.log.Debug("'%v' is unchanged, skipping it.", src)
+			return nil
+		}
+		m.log.Info("[%v] Copying '%v' into '%v'.", m, src, m.desPath(rel))
+		err = m.dest.CopyFile(src, rel)
 		if err != nil {
-			l.Error.Log("Error copying file: %v", err)
+			m.log.Error("[%v] Error copying file: %v", m, err)
 			return err
 		}
-		l.Debug.Log("Done copying file.")
+		if info, err := m.files.FS().Lstat(src); err == nil {
+			if err := m.relink(rel, info); err != nil {
+				m.log.Error("[%v] Error copying hard links: %v", m, err)
+				return err
+			}
+		}
+		m.log.Debug("Done copying file.")
 	} else {
-		l.Debug.Log("Yes...")
+		m.log.Debug("Yes...")
 	}
 	return nil
 }
 
-// handleRemove handles the remove events for files
-func handleRemove(event watcher.Event, srcfp, desfp, relfp string) error {
-	l.Debug.Log("Building path...")
-	_, des := buildPaths(event.Path, srcfp, desfp, relfp)
-	l.Debug.Log("Done.")
-	l.Info.Log("Removing '%v'.", des)
-	err := filehandler.Remove(des)
+// handleRemove handles the remove events for files and directories, a directory is removed
+// along with everything in it.
+func (m *mirror) handleRemove(event watcher.Event) error {
+	m.log.Debug("Building path...")
+	_, rel := m.paths(event.Path)
+	des := m.desPath(rel)
+	m.log.Debug("Done.")
+	if m.Delete == DeleteKeep {
+		m.log.Info("[%v] Keeping '%v', the delete policy is '%v'.", m, des, m.Delete)
+		return nil
+	}
+	m.log.Info("[%v] Removing '%v'.", m, des)
+	err := m.dest.RemoveAll(rel)
 	if err != nil {
-		l.Error.Log("Error deleting file: %v", err)
+		m.log.Error("[%v] Error deleting file: %v", m, err)
 		return err
 	}
-	l.Debug.Log("Done.")
+	m.log.Debug("Done.")
 
 	return nil
 }
 
-func handleRename(event watcher.Event, desfp, relfp string) error {
-	l.Debug.Log("Building paths...")
+// handleRename handles the rename events for files and directories.
+func (m *mirror) handleRename(event watcher.Event) error {
+	m.log.Debug("Building paths...")
 	path := strings.Split(event.Path, " -> ")
-	l.Debug.Log("path: %v", path)
-	rel := strings.Replace(path[1], relfp, "", -1)
-	l.Debug.Log("rel: %v", rel)
-	old := strings.Join([]string{desfp, event.Name()}, "/")
-	l.Debug.Log("old: %v", old)
-	new := strings.Join([]string{desfp, rel}, "")
-	l.Debug.Log("new: %v", new)
-	l.Debug.Log("Done.")
-	l.Info.Log("Renaming '%v' to '%v'.", old, new)
-	err := filehandler.Rename(old, new)
+	m.log.Debug("path: %v", path)
+	_, old := m.paths(path[0])
+	m.log.Debug("old: %v", old)
+	src, new := m.paths(path[1])
+	m.log.Debug("new: %v", new)
+	m.log.Debug("Done.")
+	m.log.Info("[%v] Renaming '%v' to '%v'.", m, m.desPath(old), m.desPath(new))
+	err := m.move(src, old, new)
 	if err != nil {
-		l.Error.Log("Error renaming file: %v", err)
+		m.log.Error("[%v] Error renaming file: %v", m, err)
 		return err
 	}
-	l.Debug.Log("Done.")
+	m.log.Debug("Done.")
 	return nil
 }
 
-func handleChmod(event watcher.Event, srcfp, desfp, relfp string) error {
-	l.Debug.Log("Building paths...")
-	src, des := buildPaths(event.Path, srcfp, desfp, relfp)
-	l.Debug.Log("Done.")
-	l.Info.Log("Copying file permissions from '%v' to '%v'.", src, des)
-	err := filehandler.Chmod(src, des)
+// handleChmod copies the permissions of the source file over to the destination.
+func (m *mirror) handleChmod(event watcher.Event) error {
+	m.log.Debug("Building paths...")
+	src, rel := m.paths(event.Path)
+	m.log.Debug("Done.")
+	if m.linked(src) && m.symlinks() != SymlinkFollow {
+		m.log.Debug("'%v' is a symlink, links have no permissions of their own.", src)
+		return nil
+	}
+	m.log.Info("[%v] Copying file permissions from '%v' to '%v'.", m, src, m.desPath(rel))
+	err := m.dest.Chmod(src, rel)
 	if err != nil {
-		l.Error.Log("Error changing permissions: %v", err)
+		m.log.Error("[%v] Error changing permissions: %v", m, err)
 	}
-	l.Debug.Log("Done.")
+	m.log.Debug("Done.")
 	return nil
 }
 
-func handleMove(event watcher.Event, srcfp, desfp, relfp string) error {
-	l.Debug.Log("Building paths...")
+// handleMove handles files and directories being moved to a different directory.
+func (m *mirror) handleMove(event watcher.Event) error {
+	m.log.Debug("Building paths...")
 	path := strings.Split(event.Path, " -> ")
-	l.Debug.Log("path: %v", path)
-	path[0] = strings.Replace(path[0], relfp, "", -1)
-	path[1] = strings.Replace(path[1], relfp, "", -1)
-	l.Debug.Log("Move Source Path: %v", path[0])
-	l.Debug.Log("Move Destination Path: %v", path[1])
-	src, _ := buildPaths(path[0], desfp, desfp, relfp)
-	_, des := buildPaths(path[1], srcfp, desfp, relfp)
-	l.Debug.Log("Is source directory?")
-	if event.IsDir() {
-		l.Debug.Log("Yes!")
-		l.Info.Log("Moving '%v' to '%v'.", src, des)
-		err := filehandler.CopyDir(src, des)
+	m.log.Debug("path: %v", path)
+	_, old := m.paths(path[0])
+	m.log.Debug("Move Source Path: %v", old)
+	src, new := m.paths(path[1])
+	m.log.Debug("Move Destination Path: %v", new)
+	m.log.Info("[%v] Moving '%v' to '%v'.", m, m.desPath(old), m.desPath(new))
+	err := m.move(src, old, new)
+	if err != nil {
+		m.log.Error("[%v] Error moving file: %v", m, err)
+		return err
+	}
+	m.log.Debug("Done.")
+	return nil
+}
+
+// move moves a file or directory, along with everything in it, from old to new in the
+// destination. Anything already at new is replaced, and if old was never mirrored the source is
+// copied to new instead.
+func (m *mirror) move(src, old, new string) error {
+	m.renameLinks(old, new)
+	m.log.Debug("Does '%v' exist?", m.desPath(old))
+	if _, err := m.dest.Stat(old); os.IsNotExist(err) {
+		m.log.Debug("No, copying '%v' instead.", src)
+		info, err := m.files.FS().Lstat(src)
 		if err != nil {
-			l.Error.Log("Error moving directory: %v\n", err)
+			return err
 		}
-		l.Debug.Log("Done moving directory.")
-	} else {
-		l.Debug.Log("No!")
-		l.Info.Log("Moving '%v' to '%v'", src, des)
-		err := filehandler.CopyFile(src, des)
-		if err != nil {
-			l.Error.Log("Error moving file: %v\n", err)
+		if info.IsDir() {
+			return m.copyTree(src, new)
 		}
-		l.Debug.Log("Done moving file.")
+		return m.copyPath(src, new)
+	}
+	m.log.Debug("Yes!")
+
+	if err := m.dest.RemoveAll(new); err != nil {
+		return err
+	}
+	if err := m.dest.CopyDir(filepath.Dir(src), path.Dir(new)); err != nil {
+		return err
 	}
-	l.Debug.Log("Removing source file...")
-	err := filehandler.Remove(src)
+	return m.dest.Rename(old, new)
+}
+
+// runHook runs the given hook command, if there is one, with the pair and any extra values in
+// its environment. A failing hook is logged but never stops the mirroring.
+func (m *mirror) runHook(name, command string, env ...string) {
+	if command == "" {
+		return
+	}
+	m.log.Debug("Running %v hook '%v'...", name, command)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "MIMIC_SOURCE="+m.Source, "MIMIC_DESTINATION="+m.Destination)
+	cmd.Env = append(cmd.Env, env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		m.log.Error("[%v] Error running %v hook: %v: %s", m, name, err, out)
+		return
+	}
+	m.log.Debug("Done.")
+}
+
+// patterns returns the ignore patterns of the pair, with the include patterns negated so they
+// win over the ignore patterns before them.
+func (m *mirror) patterns() []string {
+	patterns := append([]string{}, m.Ignore...)
+	for _, include := range m.Include {
+		patterns = append(patterns, "!"+include)
+	}
+	return patterns
+}
+
+// loadIgnore loads the pair's patterns and every .mimicignore file in the source.
+func (m *mirror) loadIgnore() error {
+	matcher, err := ignore.LoadFS(m.files.FS(), m.Source, m.patterns())
 	if err != nil {
-		l.Error.Log("Error removing source file: %v\n", err)
+		return err
 	}
-	l.Debug.Log("Done.")
+	m.mu.Lock()
+	m.matcher = matcher
+	m.mu.Unlock()
 	return nil
 }
 
-// copyFile takes the file that triggered the event and copies it to the destination
-func buildPaths(ep string, srcfp string, desfp string, relfp string) (string, string) {
-	rel := strings.Replace(ep, relfp, "", -1)
-	l.Debug.Log("rel: %v", rel)
-	des := strings.Join([]string{desfp, rel}, "")
-	l.Debug.Log("des: %v", des)
-	src := strings.Join([]string{srcfp, rel}, "")
-	l.Debug.Log("src: %v", src)
-	return src, des
+// isIgnored checks if the path, relative to the source, is ignored.
+func (m *mirror) isIgnored(rel string, isDir bool) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.matcher.Match(rel, isDir)
 }
 
-// mapTree returns a map of the file tree being watched
-func mapTree(name string) (map[string]os.FileInfo, error) {
+// relPath returns the path of the event relative to the source.
+func (m *mirror) relPath(ep string) string {
+	return strings.TrimPrefix(strings.Replace(ep, m.relfp, "", -1), "/")
+}
+
+// filterHook keeps ignored and hidden files out of the watcher. The .mimicignore files are
+// hidden as well, but they are still watched so changes to them are picked up.
+func (m *mirror) filterHook(info os.FileInfo, fullPath string) error {
+	rel := m.relPath(fullPath)
+	if rel == "" {
+		return nil
+	}
+	for _, name := range strings.Split(rel, "/") {
+		if strings.HasPrefix(name, ".") && name != ignore.FileName {
+			return watcher.ErrSkip
+		}
+	}
+	if m.isIgnored(rel, info.IsDir()) {
+		return watcher.ErrSkip
+	}
+	return nil
+}
+
+// filter checks the event against the ignore rules and returns false if it should be dropped.
+// A rename or move between an ignored path and a mirrored one is turned into a create or a
+// remove of the mirrored path.
+func (m *mirror) filter(event watcher.Event) (watcher.Event, bool) {
+	isDir := event.FileInfo != nil && event.IsDir()
+	if event.Op != watcher.Rename && event.Op != watcher.Move {
+		return event, !m.isIgnored(m.relPath(event.Path), isDir)
+	}
+
+	path := strings.Split(event.Path, " -> ")
+	if len(path) != 2 {
+		return event, true
+	}
+	oldIgnored := m.isIgnored(m.relPath(path[0]), isDir)
+	newIgnored := m.isIgnored(m.relPath(path[1]), isDir)
+	switch {
+	case oldIgnored && newIgnored:
+		return event, false
+	case oldIgnored:
+		return watcher.Event{Op: watcher.Create, Path: path[1], FileInfo: event.FileInfo}, true
+	case newIgnored:
+		return watcher.Event{Op: watcher.Remove, Path: path[0], FileInfo: event.FileInfo}, true
+	}
+	return event, true
+}
 
+// reloadIgnore reloads the ignore rules after a .mimicignore file changed. Anything that is no
+// longer ignored is copied over, and unless the delete policy is keep, anything that is now
+// ignored is pruned from the destination.
+func (m *mirror) reloadIgnore() error {
+	m.log.Info("[%v] Reloading ignore rules...", m)
+	m.mu.RLock()
+	old := m.matcher
+	m.mu.RUnlock()
+	if err := m.loadIgnore(); err != nil {
+		return err
+	}
+	if m.Bidirectional {
+		// both sides are reconciled with the new rules, paths that are now ignored are left alone
+		return m.syncBoth()
+	}
+
+	tree, err := m.mapSource(m.Source)
+	if err != nil {
+		return err
+	}
+	for file, info := range tree {
+		if !old.Match(file, info.IsDir()) || m.isIgnored(file, info.IsDir()) {
+			continue
+		}
+		src := filepath.Join(m.Source, file)
+		m.log.Info("[%v] '%v' is no longer ignored, copying it into '%v'.", m, src, m.desPath(file))
+		if err := m.copyEntry(src, file, info); err != nil {
+			m.log.Error("[%v] Error copying '%v': %v", m, src, err)
+		}
+	}
+
+	if m.Delete == DeleteKeep {
+		m.log.Debug("Delete policy is keep, so not pruning the destination.")
+		return nil
+	}
+	destree, err := mapDestination(m.dest)
+	if err != nil {
+		return err
+	}
+	var prune []string
+	for file, info := range destree {
+		// only prune files that still exist in the source, anything else isn't ours to remove
+		if _, ok := tree[file]; ok && m.isIgnored(file, info.IsDir()) {
+			prune = append(prune, file)
+		}
+	}
+	// remove the deepest paths first so directories are empty by the time they are removed
+	sort.Sort(sort.Reverse(sort.StringSlice(prune)))
+	for _, file := range prune {
+		des := m.desPath(file)
+		m.log.Info("[%v] '%v' is now ignored, removing it.", m, des)
+		if err := m.dest.Remove(file); err != nil {
+			m.log.Error("[%v] Error removing '%v': %v", m, des, err)
+		}
+	}
+	m.log.Debug("Done reloading ignore rules.")
+	return nil
+}
+
+// paths returns the path of the event in the source and its path relative to the destination.
+func (m *mirror) paths(ep string) (string, string) {
+	rel := m.relPath(ep)
+	return filepath.Join(m.Source, rel), rel
+}
+
+// desPath returns where the path, relative to the destination, is for logging.
+func (m *mirror) desPath(rel string) string {
+	return strings.TrimSuffix(m.Destination, "/") + "/" + rel
+}
+
+// mapTree returns a map of the file tree being watched
+func mapTree(fsys vfs.FS, name string) (map[string]os.FileInfo, error) {
 	tree := make(map[string]os.FileInfo)
-	l.Debug.Log("tree: %v", tree)
 
-	return tree, filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+	return tree, vfs.Walk(fsys, name, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		files := strings.Split(path, "/")
-		l.Debug.Log("files: %v", files)
-		files = files[1:]
-		l.Debug.Log("files: %v", files)
-		path = strings.Join(files, "/")
-		l.Debug.Log("path: %v", path)
-		l.Debug.Log("len(path): %v", len(path))
-		if len(path) != 0 {
-			tree[path] = info
+		path, err = filepath.Rel(name, path)
+		if err != nil {
+			return err
+		}
+		if path != "." {
+			tree[filepath.ToSlash(path)] = info
 		}
 		return nil
 	})
 }
+
+// mapDestination returns a map of everything in the destination.
+func mapDestination(des destination.Destination) (map[string]os.FileInfo, error) {
+	tree := make(map[string]os.FileInfo)
+
+	return tree, des.Walk(func(rel string, info os.FileInfo) error {
+		tree[rel] = info
+		return nil
+	})
+}
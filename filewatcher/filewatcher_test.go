@@ -7,14 +7,21 @@ package filewatcher
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/KaiserGald/logger"
+	"github.com/KaiserGald/mimic/destination"
 	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/ignore"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/state"
+	"github.com/KaiserGald/mimic/vfs"
 	"github.com/radovskyb/watcher"
 )
 
@@ -22,14 +29,23 @@ var (
 	srcfp string
 	desfp string
 	relfp string
+	mr    *mirror
+	// testLog is the logger every mirror in the tests logs to.
+	testLog = logging.New(logger.New())
 )
 
+// localDest returns the local destination at des for a mirror in the tests.
+func localDest(des string) destination.Destination {
+	return destination.NewLocal(des, destination.Options{Log: testLog})
+}
+
 func TestMain(m *testing.M) {
 	// set source and destination dirs and make them
 	srcfp = "testsrc"
 	desfp = "testdes"
 	dir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
 	relfp = strings.Join([]string{dir, "../" + srcfp}, "/")
+	mr = &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(desfp), Pair: Pair{Source: srcfp, Destination: desfp}, relfp: relfp}
 	os.Mkdir(srcfp, 0770)
 	os.Mkdir(desfp, 0770)
 
@@ -43,15 +59,18 @@ func TestMain(m *testing.M) {
 }
 
 func TestInitWatcher(t *testing.T) {
-	w, fp, err := initWatcher("testdir/testsrc")
+	w, err := initWatcher(Pair{Source: "testdir/testsrc", Backend: BackendPoll}, nil)
 	if w == nil {
 		t.Errorf("Error creating watcher.")
 	}
 
-	dir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
-	rlfp := strings.Join([]string{dir, "testdir/testsrc"}, "/")
-	if fp != rlfp {
-		t.Errorf("Filepaths do not match.")
+	// the source is relative to the working directory, wherever the program is
+	abs, _ := filepath.Abs("testdir/testsrc")
+	if m := newMirror(context.Background(), Pair{Source: "testdir/testsrc"}, testLog, nil); m.relfp != abs {
+		t.Errorf("Expected the source to resolve to '%v' got '%v'", abs, m.relfp)
+	}
+	if m := newMirror(context.Background(), Pair{Source: abs}, testLog, nil); m.relfp != abs {
+		t.Errorf("Expected an absolute source to be kept got '%v'", m.relfp)
 	}
 
 	if err != nil {
@@ -60,7 +79,6 @@ func TestInitWatcher(t *testing.T) {
 }
 
 func TestInitializeFileTree(t *testing.T) {
-	l = logger.New()
 	os.MkdirAll("testsrc/subtest/subtest1", 0777)
 	os.MkdirAll("testsrc/subtest/subtest2", 0777)
 	os.Create("testsrc/test.txt")
@@ -70,15 +88,14 @@ func TestInitializeFileTree(t *testing.T) {
 	os.Create("testsrc/subtest/subtest1/test1.txt")
 	os.Create("testsrc/subtest/subtest2/test.txt")
 	os.Create("testsrc/subtest/subtest2/test1.txt")
-	filehandler.Init(l)
-	err := initializeFileTree(srcfp, desfp, relfp)
+	err := mr.initializeFileTree()
 	if err != nil {
 		t.Errorf("Error initializing file tree: %v", err)
 	}
 
-	expected, _ := mapTree("testsrc")
+	expected, _ := mapTree(vfs.OS, "testsrc")
 
-	actual, _ := mapTree("testdes")
+	actual, _ := mapTree(vfs.OS, "testdes")
 
 	if len(actual) == 0 {
 		t.Errorf("Copied file tree was not mapped")
@@ -90,6 +107,48 @@ func TestInitializeFileTree(t *testing.T) {
 	os.Mkdir("testsrc", 0770)
 }
 
+func TestInitializeFileTreeState(t *testing.T) {
+	src, des := "testdir/statesrc", "testdir/statedes"
+	os.MkdirAll(src+"/sub", 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(des)
+	ioutil.WriteFile(src+"/keep.txt", []byte("keep"), 0644)
+	ioutil.WriteFile(src+"/sub/gone.txt", []byte("gone"), 0644)
+
+	dir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(des), Pair: Pair{Source: src, Destination: des}, relfp: dir + "/" + src}
+	if err := m.openState(); err != nil {
+		t.Fatalf("Error opening state: %v", err)
+	}
+	if err := m.initializeFileTree(); err != nil {
+		t.Fatalf("Error initializing file tree: %v", err)
+	}
+	if _, err := os.Stat(des + "/" + state.FileName); err != nil {
+		t.Fatalf("Expected the state to be saved in the destination: %v", err)
+	}
+
+	// removed while mimic wasn't running
+	os.RemoveAll(src + "/sub")
+
+	m = &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(des), Pair: Pair{Source: src, Destination: des}, relfp: dir + "/" + src}
+	m.openState()
+	if _, ok := m.state.Get("sub/gone.txt"); !ok {
+		t.Fatalf("Expected 'sub/gone.txt' to be in the saved state.")
+	}
+	if err := m.initializeFileTree(); err != nil {
+		t.Fatalf("Error initializing file tree: %v", err)
+	}
+	if _, err := os.Stat(des + "/sub"); !os.IsNotExist(err) {
+		t.Errorf("Expected 'sub' to be removed from the destination.")
+	}
+	if _, err := os.Stat(des + "/keep.txt"); err != nil {
+		t.Errorf("Expected 'keep.txt' to still be in the destination: %v", err)
+	}
+	if _, ok := m.state.Get("sub/gone.txt"); ok {
+		t.Errorf("Expected 'sub/gone.txt' to be removed from the state.")
+	}
+}
+
 func TestHandleCreate(t *testing.T) {
 	testdir := srcfp + "/test"
 	testfile := testdir + "/test.txt"
@@ -102,7 +161,7 @@ func TestHandleCreate(t *testing.T) {
 		info,
 	}
 
-	err := handleCreate(event, srcfp, desfp, relfp)
+	err := mr.handleCreate(event)
 	if err != nil {
 		t.Errorf("Error creating directory.")
 	}
@@ -121,7 +180,7 @@ func TestHandleCreate(t *testing.T) {
 		info,
 	}
 
-	err = handleCreate(event, srcfp, desfp, relfp)
+	err = mr.handleCreate(event)
 	if err != nil {
 		t.Errorf("Error creating file.")
 	}
@@ -148,7 +207,7 @@ func TestHandleWrite(t *testing.T) {
 		info,
 	}
 
-	err := handleWrite(event, srcfp, desfp, relfp)
+	err := mr.handleWrite(event)
 	if err != nil {
 		t.Errorf("Error writing file: %v", err)
 	}
@@ -172,7 +231,7 @@ func TestHandleWrite(t *testing.T) {
 		info,
 	}
 
-	err = handleWrite(event, srcfp, desfp, relfp)
+	err = mr.handleWrite(event)
 	if err != nil {
 		t.Errorf("Error writing file: %v", err)
 	}
@@ -184,6 +243,42 @@ func TestHandleWrite(t *testing.T) {
 
 }
 
+func TestHandleWriteUnchanged(t *testing.T) {
+	filename := "/unchanged.txt"
+	testfile := srcfp + filename
+	ioutil.WriteFile(testfile, []byte("Some content"), 0644)
+	defer os.Remove(testfile)
+	defer os.Remove(desfp + filename)
+	mr.files.CopyFile(testfile, desfp+filename)
+
+	// same size and modification time, but different contents
+	info, _ := os.Stat(testfile)
+	ioutil.WriteFile(desfp+filename, []byte("Some CONTENT"), 0644)
+	os.Chtimes(desfp+filename, info.ModTime(), info.ModTime())
+
+	event := watcher.Event{
+		watcher.Write,
+		relfp + filename,
+		info,
+	}
+
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(desfp), Pair: Pair{Source: srcfp, Destination: desfp, Compare: filehandler.CompareSize}, relfp: relfp}
+	if err := m.handleWrite(event); err != nil {
+		t.Errorf("Error writing file: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(desfp + filename); string(b) != "Some CONTENT" {
+		t.Errorf("Expected an unchanged file to be skipped when comparing by size.")
+	}
+
+	m.Compare = filehandler.CompareHash
+	if err := m.handleWrite(event); err != nil {
+		t.Errorf("Error writing file: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(desfp + filename); string(b) != "Some content" {
+		t.Errorf("Expected a changed file to be copied when comparing by hash, got '%s'", b)
+	}
+}
+
 func TestHandleRemove(t *testing.T) {
 	filename := "/test.txt"
 	srcpath := srcfp + filename
@@ -200,7 +295,7 @@ func TestHandleRemove(t *testing.T) {
 
 	os.Remove(srcpath)
 
-	err := handleRemove(event, srcfp, desfp, relfp)
+	err := mr.handleRemove(event)
 	if err != nil {
 		t.Errorf("Error handling removal: %v", err)
 	}
@@ -210,6 +305,119 @@ func TestHandleRemove(t *testing.T) {
 		t.Errorf("File wasn't removed.")
 	}
 
+	os.Create(despath)
+	keep := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(desfp), Pair: Pair{Source: srcfp, Destination: desfp, Delete: DeleteKeep}, relfp: relfp}
+	err = keep.handleRemove(event)
+	if err != nil {
+		t.Errorf("Error handling removal: %v", err)
+	}
+
+	_, err = os.Stat(despath)
+	if err != nil {
+		t.Errorf("File was removed even though the delete policy is keep.")
+	}
+	os.Remove(despath)
+}
+
+// makeNested creates a nested tree under the directory and returns the files in it.
+func makeNested(dir string) []string {
+	files := []string{"/a.txt", "/sub/b.txt", "/sub/deeper/c.txt"}
+	os.MkdirAll(dir+"/sub/deeper", 0777)
+	for _, file := range files {
+		ioutil.WriteFile(dir+file, []byte(file), 0644)
+	}
+	return files
+}
+
+func TestHandleRemoveDir(t *testing.T) {
+	dir := "/nested"
+	makeNested(desfp + dir)
+	defer os.RemoveAll(desfp + dir)
+	os.Mkdir(srcfp+dir, 0777)
+	info, _ := os.Stat(srcfp + dir)
+	os.Remove(srcfp + dir)
+
+	event := watcher.Event{
+		watcher.Remove,
+		relfp + dir,
+		info,
+	}
+	if err := mr.handleRemove(event); err != nil {
+		t.Errorf("Error handling removal of a directory: %v", err)
+	}
+	if _, err := os.Stat(desfp + dir); !os.IsNotExist(err) {
+		t.Errorf("Directory wasn't removed along with everything in it.")
+	}
+
+	// removing something that is already gone is fine
+	if err := mr.handleRemove(event); err != nil {
+		t.Errorf("Error handling removal of a missing directory: %v", err)
+	}
+}
+
+func TestHandleRenameDir(t *testing.T) {
+	olddir, newdir := "/olddir", "/newdir"
+	files := makeNested(srcfp + newdir)
+	makeNested(desfp + olddir)
+	defer os.RemoveAll(srcfp + newdir)
+	defer os.RemoveAll(desfp + newdir)
+	defer os.RemoveAll(desfp + olddir)
+
+	info, _ := os.Stat(srcfp + newdir)
+	event := watcher.Event{
+		watcher.Rename,
+		relfp + olddir + " -> " + relfp + newdir,
+		info,
+	}
+	if err := mr.handleRename(event); err != nil {
+		t.Errorf("Error renaming directory: %v", err)
+	}
+	if _, err := os.Stat(desfp + olddir); !os.IsNotExist(err) {
+		t.Errorf("Old directory is still in the destination.")
+	}
+	for _, file := range files {
+		if b, err := ioutil.ReadFile(desfp + newdir + file); err != nil || string(b) != file {
+			t.Errorf("'%v' wasn't renamed with its directory: %v", file, err)
+		}
+	}
+}
+
+func TestHandleMoveDir(t *testing.T) {
+	olddir, newdir := "/from/nested", "/to/deeper/nested"
+	files := makeNested(srcfp + newdir)
+	makeNested(desfp + olddir)
+	defer os.RemoveAll(srcfp + "/to")
+	defer os.RemoveAll(desfp + "/to")
+	defer os.RemoveAll(desfp + "/from")
+
+	info, _ := os.Stat(srcfp + newdir)
+	event := watcher.Event{
+		watcher.Move,
+		relfp + olddir + " -> " + relfp + newdir,
+		info,
+	}
+	if err := mr.handleMove(event); err != nil {
+		t.Errorf("Error moving directory: %v", err)
+	}
+	if _, err := os.Stat(desfp + olddir); !os.IsNotExist(err) {
+		t.Errorf("Old directory is still in the destination.")
+	}
+	for _, file := range files {
+		if b, err := ioutil.ReadFile(desfp + newdir + file); err != nil || string(b) != file {
+			t.Errorf("'%v' wasn't moved with its directory: %v", file, err)
+		}
+	}
+
+	// a directory that was never mirrored is copied from the source instead
+	os.RemoveAll(desfp + "/to")
+	if err := mr.handleMove(event); err != nil {
+		t.Errorf("Error moving a directory that isn't in the destination: %v", err)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(desfp + newdir + file); err != nil {
+			t.Errorf("'%v' wasn't copied from the source: %v", file, err)
+		}
+	}
 }
 
 func TestHandleRename(t *testing.T) {
@@ -232,7 +440,7 @@ func TestHandleRename(t *testing.T) {
 		info,
 	}
 
-	err := handleRename(event, desfp, relfp)
+	err := mr.handleRename(event)
 	if err != nil {
 		t.Errorf("Error renaming file: %v\n", err)
 	}
@@ -264,7 +472,7 @@ func TestHandleChmod(t *testing.T) {
 		srcinfo,
 	}
 
-	err := handleChmod(event, srcfp, desfp, relfp)
+	err := mr.handleChmod(event)
 	if err != nil {
 		t.Errorf("Error changing file permissions.")
 	}
@@ -287,7 +495,7 @@ func TestHandleChmod(t *testing.T) {
 		srcinfo,
 	}
 
-	err = handleChmod(event, srcfp, desfp, relfp)
+	err = mr.handleChmod(event)
 	if err != nil {
 		t.Errorf("Error changing directory permissions.")
 	}
@@ -303,7 +511,6 @@ func TestHandleChmod(t *testing.T) {
 }
 
 func TestHandleMove(t *testing.T) {
-	l = logger.New()
 
 	filename := "/test.txt"
 	desdir := "/test"
@@ -317,7 +524,7 @@ func TestHandleMove(t *testing.T) {
 	os.Mkdir(srcfp+desdir, 0777)
 	os.Mkdir(desfp+desdir, 0777)
 
-	filehandler.CopyFile(srcf, desf)
+	mr.files.CopyFile(srcf, desf)
 	info, _ := os.Stat(srcf)
 	os.Remove(srcf)
 	event := watcher.Event{
@@ -326,7 +533,7 @@ func TestHandleMove(t *testing.T) {
 		info,
 	}
 
-	err := handleMove(event, srcfp, desfp, relfp)
+	err := mr.handleMove(event)
 	if err != nil {
 		t.Errorf("Error moving file: %v\n", err)
 	}
@@ -348,21 +555,154 @@ func TestHandleMove(t *testing.T) {
 	os.RemoveAll(desfp + desdir)
 }
 
-func TestBuildPaths(t *testing.T) {
+func TestWatchPairsContext(t *testing.T) {
+	src, des := "testdir/ctxsrc", "testdir/ctxdes"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(des)
+	ioutil.WriteFile(src+"/test.txt", []byte("test"), 0644)
+
+	for _, backend := range []string{BackendPoll, defaultBackend} {
+		os.RemoveAll(des)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- WatchPairsContext(ctx, []Pair{{Source: src, Destination: des, Backend: backend}}, testLog)
+		}()
+
+		// wait for the initial sync before stopping
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(des + "/" + state.FileName); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Expected the %v backend to stop cleanly got %v", backend, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for the %v backend to stop.", backend)
+		}
+		if _, err := os.Stat(des + "/test.txt"); err != nil {
+			t.Errorf("Expected the destination to be synced before stopping: %v", err)
+		}
+	}
+}
+
+func TestPairString(t *testing.T) {
+	p := Pair{Source: "testsrc", Destination: "testdes"}
+	if p.String() != "testsrc:testdes" {
+		t.Errorf("Expected 'testsrc:testdes' got '%v'", p.String())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(desfp), Pair: Pair{Source: srcfp, Destination: desfp, Ignore: []string{"*.swp", "build/"}, Include: []string{"keep.swp"}}, relfp: relfp}
+	m.loadIgnore()
+
+	os.Create(srcfp + "/test.txt")
+	info, _ := os.Stat(srcfp + "/test.txt")
+	defer os.Remove(srcfp + "/test.txt")
+
+	tests := []struct {
+		op       watcher.Op
+		path     string
+		expOp    watcher.Op
+		expPath  string
+		expected bool
+	}{
+		{watcher.Write, relfp + "/test.txt", watcher.Write, relfp + "/test.txt", true},
+		{watcher.Write, relfp + "/test.txt.swp", watcher.Write, relfp + "/test.txt.swp", false},
+		{watcher.Write, relfp + "/keep.swp", watcher.Write, relfp + "/keep.swp", true},
+		{watcher.Create, relfp + "/build/test.txt", watcher.Create, relfp + "/build/test.txt", false},
+		{watcher.Rename, relfp + "/test.txt.swp -> " + relfp + "/test.txt", watcher.Create, relfp + "/test.txt", true},
+		{watcher.Move, relfp + "/test.txt -> " + relfp + "/build/test.txt", watcher.Remove, relfp + "/test.txt", true},
+		{watcher.Rename, relfp + "/a.swp -> " + relfp + "/b.swp", watcher.Rename, relfp + "/a.swp -> " + relfp + "/b.swp", false},
+	}
+	for _, test := range tests {
+		event, ok := m.filter(watcher.Event{Op: test.op, Path: test.path, FileInfo: info})
+		if ok != test.expected {
+			t.Errorf("Expected %v for %v '%v' got %v", test.expected, test.op, test.path, ok)
+		}
+		if event.Op != test.expOp || event.Path != test.expPath {
+			t.Errorf("Expected %v '%v' got %v '%v'", test.expOp, test.expPath, event.Op, event.Path)
+		}
+	}
+}
+
+func TestReloadIgnore(t *testing.T) {
+	os.MkdirAll(srcfp+"/logs", 0777)
+	os.Create(srcfp + "/logs/debug.log")
+	os.Create(srcfp + "/test.txt")
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(desfp), Pair: Pair{Source: srcfp, Destination: desfp}, relfp: relfp}
+	m.loadIgnore()
+	m.initializeFileTree()
+
+	ioutil.WriteFile(srcfp+"/"+ignore.FileName, []byte("logs/\n"), 0644)
+	err := m.reloadIgnore()
+	if err != nil {
+		t.Errorf("Error reloading ignore rules: %v", err)
+	}
+	if _, err := os.Stat(desfp + "/logs"); err == nil {
+		t.Errorf("Newly ignored directory was not pruned.")
+	}
+	if _, err := os.Stat(desfp + "/test.txt"); err != nil {
+		t.Errorf("File that isn't ignored was pruned.")
+	}
+
+	ioutil.WriteFile(srcfp+"/"+ignore.FileName, []byte(""), 0644)
+	err = m.reloadIgnore()
+	if err != nil {
+		t.Errorf("Error reloading ignore rules: %v", err)
+	}
+	if _, err := os.Stat(desfp + "/logs/debug.log"); err != nil {
+		t.Errorf("File that is no longer ignored was not copied: %v", err)
+	}
+
+	os.RemoveAll(srcfp)
+	os.Mkdir(srcfp, 0770)
+	os.RemoveAll(desfp)
+	os.Mkdir(desfp, 0770)
+}
+
+func TestRunHook(t *testing.T) {
+	out := desfp + "/hook.txt"
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(desfp), Pair: Pair{Source: srcfp, Destination: desfp}}
+	m.runHook("after_change", "echo -n $MIMIC_SOURCE $MIMIC_PATH > "+out, "MIMIC_PATH=test.txt")
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Hook did not run: %v", err)
+	}
+	if string(b) != "testsrc test.txt" {
+		t.Errorf("Expected hook to write 'testsrc test.txt' got '%s'", b)
+	}
+	os.Remove(out)
+}
+
+func TestPaths(t *testing.T) {
 	ep := "/home/workspace/projectroot/test/testsrc/dir/test.txt"
-	srcfp := "test/testsrc"
-	desfp := "test/testdes"
-	relfp := "/home/workspace/projectroot/test/testsrc"
+	m := &mirror{Pair: Pair{Source: "test/testsrc", Destination: "test/testdes/"}, relfp: "/home/workspace/projectroot/test/testsrc"}
 	srctest := "test/testsrc/dir/test.txt"
+	reltest := "dir/test.txt"
 	destest := "test/testdes/dir/test.txt"
 
-	src, des := buildPaths(ep, srcfp, desfp, relfp)
+	src, rel := m.paths(ep)
 	if src != srctest {
 		t.Errorf("Error building source file path. Expected '%s' got '%s'.\n", srctest, src)
 	}
 
-	if des != destest {
-		t.Errorf("Error building destination path. Expected '%s' got '%s'.\n", destest, des)
+	if rel != reltest {
+		t.Errorf("Error building destination path. Expected '%s' got '%s'.\n", reltest, rel)
+	}
+
+	if des := m.desPath(rel); des != destest {
+		t.Errorf("Error building destination path for logging. Expected '%s' got '%s'.\n", destest, des)
 	}
 }
 
@@ -388,7 +728,7 @@ func TestMapTree(t *testing.T) {
 		return nil
 	})
 
-	actual, err := mapTree("testsrc")
+	actual, err := mapTree(vfs.OS, "testsrc")
 	if err != nil {
 		t.Errorf("Error mapping file tree: %v", err)
 	}
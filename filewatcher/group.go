@@ -0,0 +1,235 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/KaiserGald/mimic/logging"
+)
+
+// Group runs a set of pairs, each with its own watcher, and lets the set change while it runs.
+type Group struct {
+	ctx context.Context
+	log logging.Logger
+	wg  sync.WaitGroup
+	// updating keeps updates from overlapping, so a pair is never started twice.
+	updating sync.Mutex
+
+	mu       sync.Mutex
+	running  map[string]*run
+	started  int
+	failed   int
+	failFast chan error
+}
+
+// run is a pair that is being mirrored.
+type run struct {
+	key    string
+	pair   Pair
+	m      *mirror
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Changes is what an update did to the running pairs.
+type Changes struct {
+	Started   []string
+	Stopped   []string
+	Restarted []string
+	Updated   []string
+}
+
+// String summarizes the changes.
+func (c Changes) String() string {
+	var parts []string
+	for _, change := range []struct {
+		name  string
+		pairs []string
+	}{{"started", c.Started}, {"stopped", c.Stopped}, {"restarted", c.Restarted}, {"updated", c.Updated}} {
+		if len(change.pairs) > 0 {
+			parts = append(parts, fmt.Sprintf("%v %v", change.name, strings.Join(change.pairs, ", ")))
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing changed"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Status is how a running pair is doing.
+type Status struct {
+	Pair Pair
+	// DeadLetters is how many events the pair has given up on.
+	DeadLetters int
+}
+
+// NewGroup creates an empty group whose pairs stop when the context is done, a nil logger
+// discards everything.
+func NewGroup(ctx context.Context, lg logging.Logger) *Group {
+	if lg == nil {
+		lg = logging.Discard
+	}
+	return &Group{
+		ctx:      ctx,
+		log:      lg,
+		running:  make(map[string]*run),
+		failFast: make(chan error, 1),
+	}
+}
+
+// Update makes the running pairs match the given ones. New pairs are started and pairs that are
+// gone are stopped. A pair whose backend, interval, debounce or state directory changed is
+// restarted, any other change is handed to the running pair so that no events are dropped.
+// Updates made at the same time, like a reload from a signal and one from the control socket,
+// are applied one after the other.
+func (g *Group) Update(pairs []Pair) Changes {
+	g.updating.Lock()
+	defer g.updating.Unlock()
+	// the update counts as running until it's done, so Wait doesn't return between stopping a
+	// pair and starting it again
+	g.wg.Add(1)
+	defer g.wg.Done()
+
+	var c Changes
+	want := make(map[string]bool)
+	var start, restart []Pair
+	var stop []*run
+
+	g.mu.Lock()
+	for _, p := range pairs {
+		key := p.String()
+		if want[key] {
+			continue
+		}
+		want[key] = true
+		r, ok := g.running[key]
+		switch {
+		case !ok:
+			start = append(start, p)
+			c.Started = append(c.Started, key)
+		case needsRestart(r.pair, p):
+			restart = append(restart, p)
+			stop = append(stop, r)
+			c.Restarted = append(c.Restarted, key)
+		case !reflect.DeepEqual(r.pair, p):
+			r.pair = p
+			r.m.update(p)
+			c.Updated = append(c.Updated, key)
+		}
+	}
+	for key, r := range g.running {
+		if !want[key] {
+			stop = append(stop, r)
+			c.Stopped = append(c.Stopped, key)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, r := range stop {
+		g.log.Notice("[%v] Stopping...", r.key)
+		r.cancel()
+	}
+	for _, r := range stop {
+		<-r.done
+	}
+	for _, p := range append(restart, start...) {
+		g.start(p)
+	}
+	sort.Strings(c.Stopped)
+	return c
+}
+
+// needsRestart checks if the pair has changed in a way that needs a new watcher, or a destination
+// that is opened again.
+func needsRestart(old, new Pair) bool {
+	return old.Backend != new.Backend || old.Interval != new.Interval ||
+		old.Debounce != new.Debounce || old.StateDir != new.StateDir || old.InPlace != new.InPlace ||
+		old.Bidirectional != new.Bidirectional || old.Symlinks != new.Symlinks || old.Preserve != new.Preserve ||
+		old.HardLinks != new.HardLinks || old.ProgressSize != new.ProgressSize ||
+		old.Delta != new.Delta
+}
+
+// start starts mirroring the pair.
+func (g *Group) start(p Pair) {
+	ctx, cancel := context.WithCancel(g.ctx)
+	m := newMirror(ctx, p, g.log, nil)
+	r := &run{key: p.String(), pair: p, m: m, cancel: cancel, done: make(chan struct{})}
+
+	g.mu.Lock()
+	g.running[p.String()] = r
+	g.started++
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer close(r.done)
+		defer cancel()
+		err := m.watch()
+
+		g.mu.Lock()
+		if g.running[p.String()] == r {
+			delete(g.running, p.String())
+		}
+		if err != nil {
+			g.failed++
+		}
+		g.mu.Unlock()
+
+		if err != nil {
+			g.log.Error("[%v] Stopped mirroring: %v", m, err)
+			if p.FailFast {
+				select {
+				case g.failFast <- fmt.Errorf("[%v] %v", m, err):
+				default:
+				}
+			}
+		}
+	}()
+}
+
+// Status returns how every running pair is doing, sorted by pair.
+func (g *Group) Status() []Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var status []Status
+	for _, r := range g.running {
+		status = append(status, Status{Pair: r.pair, DeadLetters: len(r.m.deadLetters())})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Pair.String() < status[j].Pair.String()
+	})
+	return status
+}
+
+// Wait blocks until every pair has stopped, with its state saved and its destination closed, and
+// returns an error if any of them failed, unless a pair that fails fast fails, in which case its
+// error is returned straight away.
+func (g *Group) Wait() error {
+	stopped := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case err := <-g.failFast:
+		return err
+	case <-stopped:
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failed > 0 {
+		return fmt.Errorf("%d of %d pairs failed", g.failed, g.started)
+	}
+	return nil
+}
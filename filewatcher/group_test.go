@@ -0,0 +1,211 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/state"
+)
+
+// waitFor polls until the file exists.
+func waitFor(t *testing.T, fp string) {
+	for i := 0; i < 200; i++ {
+		if _, err := os.Stat(fp); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for '%v'.", fp)
+}
+
+func TestGroupUpdate(t *testing.T) {
+	src := "testdir/groupsrc"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll("testdir/groupsrc")
+	defer os.RemoveAll("testdir/groupdes1")
+	defer os.RemoveAll("testdir/groupdes2")
+	ioutil.WriteFile(src+"/test.txt", []byte("test"), 0644)
+
+	g := NewGroup(context.Background(), testLog)
+	one := Pair{Source: src, Destination: "testdir/groupdes1", Backend: BackendPoll}
+	two := Pair{Source: src, Destination: "testdir/groupdes2", Backend: BackendPoll}
+
+	c := g.Update([]Pair{one})
+	if !reflect.DeepEqual(c.Started, []string{one.String()}) {
+		t.Errorf("Expected '%v' to be started got %v", one, c)
+	}
+	waitFor(t, one.Destination+"/"+state.FileName)
+
+	one.Ignore = []string{"*.log"}
+	c = g.Update([]Pair{one, two})
+	if !reflect.DeepEqual(c.Updated, []string{one.String()}) || !reflect.DeepEqual(c.Started, []string{two.String()}) {
+		t.Errorf("Expected '%v' to be updated and '%v' started got %v", one, two, c)
+	}
+	waitFor(t, two.Destination+"/"+state.FileName)
+
+	c = g.Update([]Pair{one, two})
+	if c.String() != "nothing changed" {
+		t.Errorf("Expected nothing to change got %v", c)
+	}
+
+	one.Interval = 20 * time.Millisecond
+	c = g.Update([]Pair{one})
+	if !reflect.DeepEqual(c.Restarted, []string{one.String()}) || !reflect.DeepEqual(c.Stopped, []string{two.String()}) {
+		t.Errorf("Expected '%v' to be restarted and '%v' stopped got %v", one, two, c)
+	}
+	if status := g.Status(); len(status) != 1 || status[0].Pair.Interval != one.Interval {
+		t.Errorf("Expected only the restarted pair to be running got %+v", status)
+	}
+
+	g.Update(nil)
+	done := make(chan error)
+	go func() {
+		done <- g.Wait()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected every pair to stop cleanly got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the pairs to stop.")
+	}
+}
+
+func TestMirrorApply(t *testing.T) {
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest(desfp), Pair: Pair{Source: srcfp, Destination: desfp, Backend: BackendPoll}, relfp: relfp, updated: make(chan struct{}, 1)}
+	m.update(Pair{Source: srcfp, Destination: desfp, Delete: DeleteKeep, Ignore: []string{"*.log"}})
+	m.update(Pair{Source: srcfp, Destination: desfp, Delete: DeleteKeep, Ignore: []string{"*.tmp"}})
+
+	select {
+	case <-m.updated:
+	default:
+		t.Fatalf("Expected the event loop to be told about the update.")
+	}
+	m.apply()
+	if m.Delete != DeleteKeep || !reflect.DeepEqual(m.Ignore, []string{"*.tmp"}) {
+		t.Errorf("Expected the latest update to be applied got %+v", m.Pair)
+	}
+	if m.Backend != BackendPoll {
+		t.Errorf("Expected settings that need a restart to be left alone.")
+	}
+	if !m.isIgnored("test.tmp", false) {
+		t.Errorf("Expected the ignore rules to be reloaded.")
+	}
+}
+
+func TestGroupShutdown(t *testing.T) {
+	src, des := "testdir/shutdownsrc", "testdir/shutdown.zip"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll(src)
+	defer os.Remove(des)
+	ioutil.WriteFile(src+"/test.txt", []byte("test"), 0644)
+
+	// the archive is only written when its destination is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	g := NewGroup(ctx, testLog)
+	p := Pair{Source: src, Destination: "zip://" + des + "?settle=1h", Backend: BackendPoll}
+	g.Update([]Pair{p})
+	g.mu.Lock()
+	r := g.running[p.String()]
+	g.mu.Unlock()
+	select {
+	case <-r.m.started:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the pair to start.")
+	}
+
+	cancel()
+	if err := g.Wait(); err != nil {
+		t.Errorf("Expected the pair to stop cleanly got %v", err)
+	}
+	if _, err := os.Stat(des); err != nil {
+		t.Errorf("Expected the destination to be closed before Wait returns: %v", err)
+	}
+}
+
+func TestGroupConcurrentUpdates(t *testing.T) {
+	src := "testdir/concurrentsrc"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll("testdir/concurrentdes")
+
+	g := NewGroup(context.Background(), testLog)
+	p := Pair{Source: src, Destination: "testdir/concurrentdes", Backend: BackendPoll}
+	// reloads from a signal and the control socket can come in at once
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ready
+			g.Update([]Pair{p})
+		}()
+	}
+	close(ready)
+	wg.Wait()
+	g.mu.Lock()
+	started := g.started
+	g.mu.Unlock()
+	if started != 1 {
+		t.Errorf("Expected the pair to be started once got %d times", started)
+	}
+
+	// every pair that was started stops with the update
+	g.Update(nil)
+	done := make(chan error)
+	go func() {
+		done <- g.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the pairs to stop.")
+	}
+}
+
+func TestGroupRestartOnlyPair(t *testing.T) {
+	src := "testdir/restartsrc"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll("testdir/restartdes")
+
+	g := NewGroup(context.Background(), testLog)
+	p := Pair{Source: src, Destination: "testdir/restartdes", Backend: BackendPoll}
+	g.Update([]Pair{p})
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Wait()
+	}()
+
+	for i := 1; i <= 5; i++ {
+		p.Debounce = time.Duration(i) * time.Millisecond
+		if c := g.Update([]Pair{p}); len(c.Restarted) != 1 {
+			t.Fatalf("Expected the pair to be restarted got %v", c)
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("Wait returned during a restart: %v", err)
+		default:
+		}
+	}
+
+	g.Update(nil)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the pair to stop.")
+	}
+}
@@ -0,0 +1,209 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// errNoHardLinks is why hard links are copied into destinations that can't hold them.
+var errNoHardLinks = errors.New("the destination can't hold hard links")
+
+// hardLinks indexes the files in the source by which file they are, so the destination can be
+// given the same hard links. Files with a single link are in it too, since a link to one can be
+// made at any time and the event for it doesn't say what it's linked to.
+type hardLinks struct {
+	mu    sync.Mutex
+	paths map[vfs.FileID][]string
+	// broken is set once the destination failed to make a link, everything is copied after that.
+	broken bool
+}
+
+// linkID returns which file the source info is of, if hard links are preserved and it's a
+// regular file.
+func (m *mirror) linkID(info os.FileInfo) (vfs.FileID, bool) {
+	if !m.HardLinks || m.Bidirectional || !info.Mode().IsRegular() {
+		return vfs.FileID{}, false
+	}
+	id, _, ok := vfs.Links(info)
+	return id, ok
+}
+
+// indexLinks starts the index over with the files of the tree, which are relative to the source,
+// leaving out the ones that are ignored.
+func (m *mirror) indexLinks(tree map[string]os.FileInfo) {
+	m.links.mu.Lock()
+	defer m.links.mu.Unlock()
+	m.links.paths = make(map[vfs.FileID][]string)
+	for rel, info := range tree {
+		if id, ok := m.linkID(info); ok && !m.isIgnored(rel, false) {
+			m.links.paths[id] = append(m.links.paths[id], rel)
+		}
+	}
+	for _, paths := range m.links.paths {
+		sort.Strings(paths)
+	}
+}
+
+// firstLink returns the first path in the index of the file the source info is of, which the
+// others are linked to in the initial sync. ok is false unless there are others.
+func (m *mirror) firstLink(info os.FileInfo) (string, bool) {
+	id, ok := m.linkID(info)
+	if !ok {
+		return "", false
+	}
+	m.links.mu.Lock()
+	defer m.links.mu.Unlock()
+	if paths := m.links.paths[id]; len(paths) > 1 {
+		return paths[0], true
+	}
+	return "", false
+}
+
+// addLink adds the path to the index as the file.
+func (m *mirror) addLink(id vfs.FileID, rel string) {
+	m.links.mu.Lock()
+	defer m.links.mu.Unlock()
+	if m.links.paths == nil {
+		m.links.paths = make(map[vfs.FileID][]string)
+	}
+	for _, p := range m.links.paths[id] {
+		if p == rel {
+			return
+		}
+	}
+	m.links.paths[id] = append(m.links.paths[id], rel)
+	sort.Strings(m.links.paths[id])
+}
+
+// siblings returns the other paths in the index that are still links to the same file as rel.
+// The ones that have since been removed, or replaced by another file, are dropped.
+func (m *mirror) siblings(id vfs.FileID, rel string) []string {
+	m.links.mu.Lock()
+	defer m.links.mu.Unlock()
+	var kept, others []string
+	for _, p := range m.links.paths[id] {
+		info, err := m.files.FS().Lstat(filepath.Join(m.Source, filepath.FromSlash(p)))
+		if err != nil {
+			continue
+		}
+		if other, _, ok := vfs.Links(info); !ok || other != id {
+			continue
+		}
+		kept = append(kept, p)
+		if p != rel {
+			others = append(others, p)
+		}
+	}
+	m.links.paths[id] = kept
+	return others
+}
+
+// renameLinks moves the paths at and under old in the index to new.
+func (m *mirror) renameLinks(old, new string) {
+	m.links.mu.Lock()
+	defer m.links.mu.Unlock()
+	for id, paths := range m.links.paths {
+		for i, p := range paths {
+			if p == old || strings.HasPrefix(p, old+"/") {
+				paths[i] = new + strings.TrimPrefix(p, old)
+			}
+		}
+		sort.Strings(paths)
+		m.links.paths[id] = paths
+	}
+}
+
+// linkFile makes rel a hard link to old in the destination, like they are in the source. It
+// returns false when the destination can't hold hard links, after warning about it the first
+// time, and the file has to be copied instead. Any other error is returned.
+func (m *mirror) linkFile(old, rel string) (bool, error) {
+	m.links.mu.Lock()
+	broken := m.links.broken
+	m.links.mu.Unlock()
+	if broken {
+		return false, nil
+	}
+
+	err := errNoHardLinks
+	if linker, ok := m.dest.(destination.HardLinker); ok {
+		m.log.Info("[%v] Linking '%v' to '%v'.", m, m.desPath(rel), m.desPath(old))
+		src := filepath.Join(m.Source, filepath.FromSlash(rel))
+		if err := m.dest.CopyDir(filepath.Dir(src), path.Dir(rel)); err != nil {
+			return false, err
+		}
+		if err = linker.Link(old, rel); err == nil {
+			return true, nil
+		}
+		if !noHardLinks(err) {
+			return false, err
+		}
+	}
+	m.links.mu.Lock()
+	defer m.links.mu.Unlock()
+	if !m.links.broken {
+		m.links.broken = true
+		m.log.Notice("[%v] Can't make hard links in '%v', copying them instead: %v", m, m.Destination, err)
+	}
+	return false, nil
+}
+
+// noHardLinks checks if the error means the destination can't make hard links at all, rather
+// than that making this one failed: links across file systems, file systems that refuse them or
+// don't support them and files with as many links as they can have.
+func noHardLinks(err error) bool {
+	return errors.Is(err, errNoHardLinks) || errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EPERM) ||
+		errors.Is(err, syscall.EMLINK) || vfs.IsUnsupported(err)
+}
+
+// copyLinked copies the source file, whose info is given, to rel, as a hard link to a path it's
+// already linked to in the destination if it can.
+func (m *mirror) copyLinked(src, rel string, info os.FileInfo) error {
+	if id, ok := m.linkID(info); ok {
+		m.addLink(id, rel)
+		for _, other := range m.siblings(id, rel) {
+			if _, err := m.dest.Stat(other); err != nil {
+				continue
+			}
+			if linked, err := m.linkFile(other, rel); err != nil || linked {
+				return err
+			}
+		}
+	}
+	return m.dest.CopyFile(src, rel)
+}
+
+// relink brings the paths the source file at rel is linked to up to date, after rel was copied,
+// by linking them to it again. Copying rel replaced the file they shared in the destination, and
+// a write to one link of a file changes them all, with only one event to say so.
+func (m *mirror) relink(rel string, info os.FileInfo) error {
+	id, ok := m.linkID(info)
+	if !ok {
+		return nil
+	}
+	for _, other := range m.siblings(id, rel) {
+		if linked, err := m.linkFile(rel, other); err != nil {
+			return err
+		} else if linked {
+			continue
+		}
+		m.log.Info("[%v] Copying '%v' into '%v', it's a hard link to '%v'.", m, other, m.desPath(other), rel)
+		if err := m.dest.CopyFile(filepath.Join(m.Source, filepath.FromSlash(other)), other); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/vfs"
+	"github.com/radovskyb/watcher"
+)
+
+// sameFile checks if both paths are hard links to the same file.
+func sameFile(fsys vfs.FS, fp1, fp2 string) bool {
+	info1, err1 := fsys.Lstat(fp1)
+	info2, err2 := fsys.Lstat(fp2)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	id1, _, _ := vfs.Links(info1)
+	id2, _, _ := vfs.Links(info2)
+	return id1 == id2
+}
+
+func TestHardLinksSync(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src/sub", 0755)
+	vfs.WriteFile(mem, "src/a.txt", []byte("a"), 0644)
+	vfs.WriteFile(mem, "src/c.txt", []byte("a"), 0644)
+	mem.Link("src/a.txt", "src/sub/b.txt")
+	mem.Link("src/a.txt", "src/z.txt")
+
+	for _, on := range []bool{false, true} {
+		des := "copies"
+		if on {
+			des = "links"
+		}
+		mr, _ := New(WithSource("src"), WithDestination(des), WithFS(mem), WithLogger(testLog), WithHardLinks(on))
+		// a second sync finds the links already there
+		for i := 0; i < 2; i++ {
+			if err := mr.Sync(context.Background()); err != nil {
+				t.Fatalf("Error syncing: %v", err)
+			}
+		}
+		for _, rel := range []string{"sub/b.txt", "z.txt"} {
+			expectFile(t, mem, des+"/"+rel, "a")
+			if linked := sameFile(mem, des+"/a.txt", des+"/"+rel); linked != on {
+				t.Errorf("Expected '%v' to be linked to 'a.txt' %v got %v", des+"/"+rel, on, linked)
+			}
+		}
+		if sameFile(mem, des+"/a.txt", des+"/c.txt") {
+			t.Errorf("Expected a file that isn't linked in the source to be copied.")
+		}
+	}
+}
+
+func TestHardLinksEvents(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src", 0755)
+	vfs.WriteFile(mem, "src/a.txt", []byte("a"), 0644)
+
+	mr, _ := New(WithSource("src"), WithDestination("des"), WithFS(mem), WithLogger(testLog), WithHardLinks(true))
+	m, err := mr.begin(context.Background())
+	if err != nil {
+		t.Fatalf("Error starting: %v", err)
+	}
+	defer func() {
+		m.closeDestination()
+		mr.finish(nil)
+	}()
+	if err := m.sync(); err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+
+	// a new link is linked to the file that's already there
+	mem.Link("src/a.txt", "src/b.txt")
+	info, _ := mem.Lstat("src/b.txt")
+	if err := m.handleCreate(watcher.Event{Op: watcher.Create, Path: m.relfp + "/b.txt", FileInfo: info}); err != nil {
+		t.Fatalf("Error creating: %v", err)
+	}
+	if !sameFile(mem, "des/a.txt", "des/b.txt") {
+		t.Errorf("Expected 'des/b.txt' to be a hard link to 'des/a.txt'.")
+	}
+
+	// a write through one link shows up in the other
+	vfs.WriteFile(mem, "src/a.txt", []byte("changed"), 0644)
+	info, _ = mem.Lstat("src/a.txt")
+	if err := m.handleWrite(watcher.Event{Op: watcher.Write, Path: m.relfp + "/a.txt", FileInfo: info}); err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+	expectFile(t, mem, "des/b.txt", "changed")
+	if !sameFile(mem, "des/a.txt", "des/b.txt") {
+		t.Errorf("Expected 'des/b.txt' to be linked to 'des/a.txt' again.")
+	}
+
+	// the index follows renames
+	mem.Rename("src/b.txt", "src/c.txt")
+	if err := m.move(m.relfp+"/c.txt", "b.txt", "c.txt"); err != nil {
+		t.Fatalf("Error moving: %v", err)
+	}
+
+	// destinations that can't hold links get copies, which are kept up to date
+	m.dest = struct{ destination.Destination }{m.dest}
+	vfs.WriteFile(mem, "src/a.txt", []byte("copied"), 0644)
+	info, _ = mem.Lstat("src/a.txt")
+	if err := m.handleWrite(watcher.Event{Op: watcher.Write, Path: m.relfp + "/a.txt", FileInfo: info}); err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+	expectFile(t, mem, "des/c.txt", "copied")
+	if sameFile(mem, "des/a.txt", "des/c.txt") {
+		t.Errorf("Expected 'des/c.txt' to be a copy.")
+	}
+}
+
+// failingLinker is a destination whose hard links fail with err.
+type failingLinker struct {
+	destination.Destination
+	err error
+}
+
+func (f failingLinker) Link(old, rel string) error { return f.err }
+
+func TestLinkFileErrors(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src", 0755)
+	vfs.MkdirAll(mem, "des", 0755)
+	vfs.WriteFile(mem, "src/a.txt", []byte("a"), 0644)
+	mem.Link("src/a.txt", "src/b.txt")
+
+	mr, _ := New(WithSource("src"), WithDestination("des"), WithFS(mem), WithLogger(testLog), WithHardLinks(true))
+	m, err := mr.begin(context.Background())
+	if err != nil {
+		t.Fatalf("Error starting: %v", err)
+	}
+	defer mr.finish(nil)
+	if err := m.openDestination(); err != nil {
+		t.Fatalf("Error opening the destination: %v", err)
+	}
+	defer m.closeDestination()
+	dest := m.dest
+
+	// an error making one link is returned, and links are still made after it
+	m.dest = failingLinker{dest, &os.LinkError{Op: "link", Old: "a.txt", New: "b.txt", Err: syscall.EIO}}
+	if linked, err := m.linkFile("a.txt", "b.txt"); linked || err == nil {
+		t.Errorf("Expected the error linking to be returned got %v: %v", linked, err)
+	}
+	if m.links.broken {
+		t.Errorf("Expected an error linking one file not to stop hard links.")
+	}
+
+	// a destination that can't hold links gets copies from then on
+	m.dest = failingLinker{dest, &os.LinkError{Op: "link", Old: "a.txt", New: "b.txt", Err: syscall.EXDEV}}
+	if linked, err := m.linkFile("a.txt", "b.txt"); linked || err != nil {
+		t.Errorf("Expected the file to be copied instead got %v: %v", linked, err)
+	}
+	if !m.links.broken {
+		t.Errorf("Expected hard links to be given up on.")
+	}
+}
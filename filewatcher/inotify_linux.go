@@ -0,0 +1,386 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/radovskyb/watcher"
+)
+
+// defaultBackend is used when a pair doesn't pick one.
+const defaultBackend = BackendInotify
+
+// inotifyMask is every inotify event mimic cares about.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+// inotifyBackend watches the source with the kernel's inotify api, it adds a watch for every
+// directory in the source and for every directory created after it started.
+type inotifyBackend struct {
+	fd     int
+	f      *os.File
+	filter FilterFunc
+
+	mu    sync.Mutex
+	roots []string
+	dirs  map[int]string
+	wds   map[string]int
+	infos map[string]os.FileInfo
+
+	event  chan watcher.Event
+	error  chan error
+	closed chan struct{}
+	once   sync.Once
+}
+
+// newInotifyBackend creates an inotify instance. The file descriptor is non blocking so that
+// closing it wakes up the goroutine reading events, which is also why the descriptor is kept
+// around instead of calling Fd, as that would switch it back to blocking.
+func newInotifyBackend(filter FilterFunc) (Backend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	return &inotifyBackend{
+		fd:     fd,
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		filter: filter,
+		dirs:   make(map[int]string),
+		wds:    make(map[string]int),
+		infos:  make(map[string]os.FileInfo),
+		event:  make(chan watcher.Event),
+		error:  make(chan error),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+func (b *inotifyBackend) AddRecursive(name string) error {
+	name, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	if _, err = b.addRecursive(name); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.roots = append(b.roots, name)
+	b.mu.Unlock()
+	return nil
+}
+
+// rewatch walks the sources again after the kernel's queue overflowed. Directories that were
+// created while events were being dropped are watched, and the ones that are gone are forgotten.
+func (b *inotifyBackend) rewatch() {
+	b.mu.Lock()
+	roots := append([]string{}, b.roots...)
+	b.mu.Unlock()
+
+	found := make(map[string]os.FileInfo)
+	for _, root := range roots {
+		infos, err := b.addRecursive(root)
+		if err != nil {
+			b.sendError(err)
+		}
+		for path, info := range infos {
+			found[path] = info
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for path, wd := range b.wds {
+		if _, ok := found[path]; !ok {
+			if b.dirs[wd] == path {
+				delete(b.dirs, wd)
+			}
+			delete(b.wds, path)
+			delete(b.infos, path)
+		}
+	}
+}
+
+// addRecursive adds a watch on every directory under name that passes the filter and returns
+// everything it found.
+func (b *inotifyBackend) addRecursive(name string) (map[string]os.FileInfo, error) {
+	found := make(map[string]os.FileInfo)
+	return found, filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// the file is gone already, there is nothing left to watch
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path != name && b.skip(info, path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		found[path] = info
+		if !info.IsDir() {
+			return nil
+		}
+
+		wd, err := syscall.InotifyAddWatch(b.fd, path, inotifyMask)
+		if err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		b.mu.Lock()
+		b.dirs[wd] = path
+		b.wds[path] = wd
+		b.infos[path] = info
+		b.mu.Unlock()
+		return nil
+	})
+}
+
+// skip runs the filter on the path.
+func (b *inotifyBackend) skip(info os.FileInfo, path string) bool {
+	return b.filter != nil && b.filter(info, path) == watcher.ErrSkip
+}
+
+func (b *inotifyBackend) WatchedFiles() map[string]os.FileInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	files := make(map[string]os.FileInfo, len(b.infos))
+	for path, info := range b.infos {
+		files[path] = info
+	}
+	return files
+}
+
+// Start reads events from inotify until the backend is closed.
+func (b *inotifyBackend) Start() error {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := b.f.Read(buf)
+		if err != nil {
+			select {
+			case <-b.closed:
+				return nil
+			default:
+			}
+			return err
+		}
+		b.handle(buf[:n])
+	}
+}
+
+// moved is the first half of a rename, waiting for the second half with the same cookie.
+type moved struct {
+	path  string
+	isDir bool
+}
+
+// handle turns a buffer of raw inotify events into watcher events.
+func (b *inotifyBackend) handle(buf []byte) {
+	moves := make(map[uint32]moved)
+	var order []uint32
+
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+		name := strings.TrimRight(string(nameBytes), "\x00")
+		offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+		if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			// the watches are brought up to date before the source is rescanned, so nothing
+			// created from then on is missed
+			b.rewatch()
+			b.sendError(ErrOverflow)
+			continue
+		}
+
+		b.mu.Lock()
+		dir, ok := b.dirs[int(raw.Wd)]
+		b.mu.Unlock()
+		if !ok {
+			continue
+		}
+		path := dir
+		if name != "" {
+			path = filepath.Join(dir, name)
+		}
+		isDir := raw.Mask&syscall.IN_ISDIR != 0
+
+		switch {
+		case raw.Mask&(syscall.IN_DELETE_SELF|syscall.IN_IGNORED) != 0:
+			b.forget(path)
+		case raw.Mask&syscall.IN_MOVED_FROM != 0:
+			moves[raw.Cookie] = moved{path, isDir}
+			order = append(order, raw.Cookie)
+		case raw.Mask&syscall.IN_MOVED_TO != 0:
+			from, ok := moves[raw.Cookie]
+			if !ok {
+				// moved in from outside the source, so it's new to us
+				b.create(path)
+				continue
+			}
+			delete(moves, raw.Cookie)
+			b.move(from.path, path)
+		case raw.Mask&syscall.IN_CREATE != 0:
+			b.create(path)
+		case raw.Mask&syscall.IN_DELETE != 0:
+			b.remove(path, isDir)
+		case raw.Mask&syscall.IN_MODIFY != 0:
+			b.send(watcher.Write, path)
+		case raw.Mask&syscall.IN_ATTRIB != 0:
+			b.send(watcher.Chmod, path)
+		}
+	}
+
+	// anything moved out of the source is gone as far as the destination is concerned
+	for _, cookie := range order {
+		if from, ok := moves[cookie]; ok {
+			b.remove(from.path, from.isDir)
+		}
+	}
+}
+
+// create sends a create event for the path. New directories are watched straight away, and
+// anything that was written into them before the watch was added gets a create event too.
+func (b *inotifyBackend) create(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || b.skip(info, path) {
+		return
+	}
+	if !info.IsDir() {
+		b.sendEvent(watcher.Event{Op: watcher.Create, Path: path, FileInfo: info})
+		return
+	}
+
+	found, err := b.addRecursive(path)
+	if err != nil {
+		b.sendError(err)
+	}
+	b.sendEvent(watcher.Event{Op: watcher.Create, Path: path, FileInfo: info})
+	for fp, info := range found {
+		if fp != path {
+			b.sendEvent(watcher.Event{Op: watcher.Create, Path: fp, FileInfo: info})
+		}
+	}
+}
+
+// move sends a rename when the path stays in the same directory and a move when it doesn't.
+// The watches of a moved directory are kept, only their paths are updated.
+func (b *inotifyBackend) move(from, to string) {
+	info, err := os.Lstat(to)
+	if err != nil {
+		b.remove(from, false)
+		return
+	}
+
+	b.mu.Lock()
+	for wd, dir := range b.dirs {
+		if dir == from || strings.HasPrefix(dir, from+"/") {
+			newDir := to + strings.TrimPrefix(dir, from)
+			b.dirs[wd] = newDir
+			delete(b.wds, dir)
+			b.wds[newDir] = wd
+			b.infos[newDir] = b.infos[dir]
+			delete(b.infos, dir)
+		}
+	}
+	b.mu.Unlock()
+
+	op := watcher.Move
+	if filepath.Dir(from) == filepath.Dir(to) {
+		op = watcher.Rename
+	}
+	b.sendEvent(watcher.Event{Op: op, Path: from + " -> " + to, FileInfo: info})
+}
+
+// remove sends a remove event. The file is already gone, so its info only knows if it was a
+// directory.
+func (b *inotifyBackend) remove(path string, isDir bool) {
+	info := removedInfo{name: filepath.Base(path), dir: isDir}
+	if b.skip(info, path) {
+		return
+	}
+	if isDir {
+		b.forget(path)
+	}
+	b.sendEvent(watcher.Event{Op: watcher.Remove, Path: path, FileInfo: info})
+}
+
+// forget drops a directory that no longer exists.
+func (b *inotifyBackend) forget(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wd, ok := b.wds[path]; ok {
+		delete(b.dirs, wd)
+		delete(b.wds, path)
+		delete(b.infos, path)
+	}
+}
+
+// send sends an event for a path that still exists.
+func (b *inotifyBackend) send(op watcher.Op, path string) {
+	info, err := os.Lstat(path)
+	if err != nil || b.skip(info, path) {
+		return
+	}
+	b.sendEvent(watcher.Event{Op: op, Path: path, FileInfo: info})
+}
+
+func (b *inotifyBackend) sendEvent(event watcher.Event) {
+	select {
+	case b.event <- event:
+	case <-b.closed:
+	}
+}
+
+func (b *inotifyBackend) sendError(err error) {
+	select {
+	case b.error <- err:
+	case <-b.closed:
+	}
+}
+
+func (b *inotifyBackend) Close() {
+	b.once.Do(func() {
+		close(b.closed)
+		b.f.Close()
+	})
+}
+
+func (b *inotifyBackend) Events() <-chan watcher.Event {
+	return b.event
+}
+
+func (b *inotifyBackend) Errors() <-chan error {
+	return b.error
+}
+
+func (b *inotifyBackend) Closed() <-chan struct{} {
+	return b.closed
+}
+
+// removedInfo is the file info of a file that has already been removed.
+type removedInfo struct {
+	name string
+	dir  bool
+}
+
+func (ri removedInfo) Name() string { return ri.name }
+func (ri removedInfo) Size() int64  { return 0 }
+func (ri removedInfo) Mode() os.FileMode {
+	if ri.dir {
+		return os.ModeDir
+	}
+	return 0
+}
+func (ri removedInfo) ModTime() time.Time { return time.Time{} }
+func (ri removedInfo) IsDir() bool        { return ri.dir }
+func (ri removedInfo) Sys() interface{}   { return nil }
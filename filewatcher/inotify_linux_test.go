@@ -0,0 +1,152 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/radovskyb/watcher"
+)
+
+func startInotify(t *testing.T, dir string) *inotifyBackend {
+	os.MkdirAll(dir, 0770)
+	b, err := newInotifyBackend(func(info os.FileInfo, fullPath string) error {
+		if filepath.Ext(fullPath) == ".swp" {
+			return watcher.ErrSkip
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error creating inotify backend: %v", err)
+	}
+	if err := b.AddRecursive(dir); err != nil {
+		t.Fatalf("Error adding '%v': %v", dir, err)
+	}
+	go b.Start()
+	return b.(*inotifyBackend)
+}
+
+func nextEvent(t *testing.T, b Backend) watcher.Event {
+	select {
+	case event := <-b.Events():
+		return event
+	case err := <-b.Errors():
+		t.Fatalf("Error watching: %v", err)
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for an event.")
+	}
+	return watcher.Event{}
+}
+
+func TestInotifyBackend(t *testing.T) {
+	dir := "testinotify"
+	b := startInotify(t, dir)
+	defer os.RemoveAll(dir)
+	defer b.Close()
+	abs, _ := filepath.Abs(dir)
+
+	os.Create(dir + "/test.txt.swp")
+	os.Create(dir + "/test.txt")
+	event := nextEvent(t, b)
+	if event.Op != watcher.Create || event.Path != abs+"/test.txt" {
+		t.Errorf("Expected CREATE for '%v' got %v '%v'", abs+"/test.txt", event.Op, event.Path)
+	}
+
+	os.Chmod(dir+"/test.txt", 0600)
+	if event = nextEvent(t, b); event.Op != watcher.Chmod {
+		t.Errorf("Expected CHMOD got %v", event.Op)
+	}
+
+	os.Rename(dir+"/test.txt", dir+"/rename.txt")
+	event = nextEvent(t, b)
+	if event.Op != watcher.Rename || event.Path != abs+"/test.txt -> "+abs+"/rename.txt" {
+		t.Errorf("Expected RENAME got %v '%v'", event.Op, event.Path)
+	}
+
+	// a new directory gets watched straight away
+	os.Mkdir(dir+"/sub", 0770)
+	if event = nextEvent(t, b); event.Op != watcher.Create || !event.IsDir() {
+		t.Errorf("Expected CREATE for a directory got %v '%v'", event.Op, event.Path)
+	}
+	os.Create(dir + "/sub/nested.txt")
+	if event = nextEvent(t, b); event.Op != watcher.Create || event.Path != abs+"/sub/nested.txt" {
+		t.Errorf("Expected CREATE for '%v' got %v '%v'", abs+"/sub/nested.txt", event.Op, event.Path)
+	}
+
+	os.Rename(dir+"/rename.txt", dir+"/sub/rename.txt")
+	if event = nextEvent(t, b); event.Op != watcher.Move {
+		t.Errorf("Expected MOVE got %v '%v'", event.Op, event.Path)
+	}
+
+	os.Remove(dir + "/sub/nested.txt")
+	if event = nextEvent(t, b); event.Op != watcher.Remove || event.Path != abs+"/sub/nested.txt" {
+		t.Errorf("Expected REMOVE for '%v' got %v '%v'", abs+"/sub/nested.txt", event.Op, event.Path)
+	}
+
+	if _, ok := b.WatchedFiles()[abs+"/sub"]; !ok {
+		t.Errorf("New directory is not being watched.")
+	}
+}
+
+func TestInotifyOverflow(t *testing.T) {
+	src, des := "testoverflow", "testoverflowdes"
+	os.MkdirAll(src, 0770)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(des)
+
+	mr, _ := New(WithSource(src), WithDestination(des), WithBackend(BackendInotify), WithDebounce(-1), WithLogger(testLog))
+	m, err := mr.begin(context.Background())
+	if err != nil {
+		t.Fatalf("Error starting: %v", err)
+	}
+	if err := m.sync(); err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+	w, _ := newInotifyBackend(m.filterHook)
+	b := w.(*inotifyBackend)
+	if err := b.AddRecursive(src); err != nil {
+		t.Fatalf("Error adding '%v': %v", src, err)
+	}
+	m.w = b
+
+	// the event for the new directory is dropped, as if the queue overflowed
+	os.Mkdir(src+"/new", 0770)
+	b.f.Read(make([]byte, 4096))
+
+	done := make(chan error)
+	go func() {
+		done <- m.loop(b.Events())
+	}()
+	go b.Start()
+	defer func() {
+		b.Close()
+		<-done
+		m.closeDestination()
+		mr.finish(nil)
+	}()
+
+	raw := syscall.InotifyEvent{Wd: -1, Mask: syscall.IN_Q_OVERFLOW}
+	buf := (*[syscall.SizeofInotifyEvent]byte)(unsafe.Pointer(&raw))[:]
+	go b.handle(buf)
+
+	// the rescan copies the directory, and it's watched from then on
+	waitFor(t, des+"/new")
+	ioutil.WriteFile(src+"/new/test.txt", []byte("test"), 0644)
+	for i := 0; i < 200; i++ {
+		if b, _ := ioutil.ReadFile(des + "/new/test.txt"); string(b) == "test" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected a write in a directory created during the overflow to be mirrored.")
+}
@@ -0,0 +1,19 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+//go:build !linux
+// +build !linux
+
+package filewatcher
+
+import "errors"
+
+// defaultBackend is used when a pair doesn't pick one.
+const defaultBackend = BackendPoll
+
+// newInotifyBackend fails everywhere but on linux.
+func newInotifyBackend(filter FilterFunc) (Backend, error) {
+	return nil, errors.New("the inotify backend is only supported on linux")
+}
@@ -0,0 +1,307 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/logging"
+	"github.com/KaiserGald/mimic/vfs"
+	"github.com/radovskyb/watcher"
+)
+
+// ErrRunning is returned when a Mirror is started or synced while it's already running.
+var ErrRunning = errors.New("mirror is already running")
+
+// eventBuffer is how many events a Mirror holds on to for a reader that is falling behind.
+const eventBuffer = 64
+
+// Event is a change that was mirrored into the destination, or given up on when Err is set.
+type Event struct {
+	Op watcher.Op
+	// Path is relative to the source.
+	Path string
+	// OldPath is where a renamed or moved path used to be, relative to the source.
+	OldPath string
+	Err     error
+}
+
+// Mirror mirrors a source directory into a destination, for programs that embed mimic instead of
+// running it. A Mirror can be started again after it has stopped, and any number of them can run
+// in the same process.
+type Mirror struct {
+	pair   Pair
+	log    logging.Logger
+	fs     vfs.FS
+	events chan Event
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Option configures a Mirror.
+type Option func(*Mirror)
+
+// WithSource sets the directory that is mirrored.
+func WithSource(fp string) Option {
+	return func(mr *Mirror) { mr.pair.Source = fp }
+}
+
+// WithDestination sets the directory, or the URL of the destination, the source is mirrored into.
+func WithDestination(fp string) Option {
+	return func(mr *Mirror) { mr.pair.Destination = fp }
+}
+
+// WithLogger sets where the Mirror logs to, nothing is logged without one.
+func WithLogger(lg logging.Logger) Option {
+	return func(mr *Mirror) { mr.log = lg }
+}
+
+// WithIgnore adds gitignore style patterns for paths that are never mirrored.
+func WithIgnore(patterns ...string) Option {
+	return func(mr *Mirror) { mr.pair.Ignore = append(mr.pair.Ignore, patterns...) }
+}
+
+// WithInclude adds patterns for paths that are mirrored even though an ignore pattern matches.
+func WithInclude(patterns ...string) Option {
+	return func(mr *Mirror) { mr.pair.Include = append(mr.pair.Include, patterns...) }
+}
+
+// WithBackend picks the backend used to watch the source, see BackendInotify and BackendPoll.
+func WithBackend(name string) Option {
+	return func(mr *Mirror) { mr.pair.Backend = name }
+}
+
+// WithInterval sets how often the poll backend polls the source.
+func WithInterval(d time.Duration) Option {
+	return func(mr *Mirror) { mr.pair.Interval = d }
+}
+
+// WithDebounce sets how long a path has to be quiet before it's mirrored.
+func WithDebounce(d time.Duration) Option {
+	return func(mr *Mirror) { mr.pair.Debounce = d }
+}
+
+// WithDelete sets what happens in the destination when something is removed from the source.
+func WithDelete(policy DeletePolicy) Option {
+	return func(mr *Mirror) { mr.pair.Delete = policy }
+}
+
+// WithCompare sets how files are compared to decide if they need to be copied.
+func WithCompare(cmp filehandler.Compare) Option {
+	return func(mr *Mirror) { mr.pair.Compare = cmp }
+}
+
+// WithBidirectional sets whether changes made in the destination are mirrored back into the
+// source as well.
+func WithBidirectional(on bool) Option {
+	return func(mr *Mirror) { mr.pair.Bidirectional = on }
+}
+
+// WithConflict sets what happens in bidirectional mode when a path changed on both sides.
+func WithConflict(policy ConflictPolicy) Option {
+	return func(mr *Mirror) { mr.pair.Conflict = policy }
+}
+
+// WithSymlinks sets what happens to symlinks in the source.
+func WithSymlinks(policy SymlinkPolicy) Option {
+	return func(mr *Mirror) { mr.pair.Symlinks = policy }
+}
+
+// WithPreserve sets the metadata copied into the destination along with modes.
+func WithPreserve(p filehandler.Preserve) Option {
+	return func(mr *Mirror) { mr.pair.Preserve = p }
+}
+
+// WithHardLinks keeps files that are hard links to each other in the source linked in the
+// destination.
+func WithHardLinks(on bool) Option {
+	return func(mr *Mirror) { mr.pair.HardLinks = on }
+}
+
+// WithProgressSize sets the size from which the progress of copying a file is logged.
+func WithProgressSize(size int64) Option {
+	return func(mr *Mirror) { mr.pair.ProgressSize = size }
+}
+
+// WithDelta updates large files that changed by writing only the parts of them that did.
+func WithDelta(on bool) Option {
+	return func(mr *Mirror) { mr.pair.Delta = on }
+}
+
+// WithFS sets the file system the source is read from and the destination is written to, it's
+// the OS by default. Only the OS can be watched, any other file system can only be synced.
+func WithFS(fsys vfs.FS) Option {
+	return func(mr *Mirror) { mr.fs = fsys }
+}
+
+// WithPair sets every setting of the pair at once, any options after it change it further.
+func WithPair(p Pair) Option {
+	return func(mr *Mirror) { mr.pair = p }
+}
+
+// New returns a Mirror configured by the options. It needs at least a source and a destination.
+func New(opts ...Option) (*Mirror, error) {
+	mr := &Mirror{log: logging.Discard, events: make(chan Event, eventBuffer)}
+	for _, opt := range opts {
+		opt(mr)
+	}
+	if mr.log == nil {
+		mr.log = logging.Discard
+	}
+
+	switch {
+	case mr.pair.Source == "":
+		return nil, errors.New("mirror is missing a source")
+	case mr.pair.Destination == "":
+		return nil, errors.New("mirror is missing a destination")
+	}
+	switch mr.pair.Backend {
+	case "", BackendInotify, BackendPoll:
+	default:
+		return nil, errors.New("unknown backend '" + mr.pair.Backend + "'")
+	}
+	if _, err := destination.Parse(mr.pair.Destination); err != nil {
+		return nil, err
+	}
+	return mr, nil
+}
+
+// Pair returns the settings the Mirror was created with.
+func (mr *Mirror) Pair() Pair {
+	return mr.pair
+}
+
+// Events returns the events that were mirrored, or given up on, while the Mirror was running. The
+// channel is never closed. Events are dropped when nobody reads them.
+func (mr *Mirror) Events() <-chan Event {
+	return mr.events
+}
+
+// Start brings the destination up to date with the source and then keeps mirroring changes in
+// the background, until the context is done or Stop is called. Start returns once the source is
+// being watched, or with the error that kept it from getting there.
+func (mr *Mirror) Start(ctx context.Context) error {
+	m, err := mr.begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		err := m.watch()
+		mr.finish(err)
+		failed <- err
+	}()
+
+	select {
+	case <-m.started:
+		return nil
+	case err := <-failed:
+		if err == nil {
+			err = m.ctx.Err()
+		}
+		return err
+	}
+}
+
+// Sync brings the destination up to date with the source once, without watching it. It returns
+// the context's error if the context is done before the destination is up to date.
+func (mr *Mirror) Sync(ctx context.Context) error {
+	m, err := mr.begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = m.sync()
+	if saveErr := m.state.Save(); err == nil {
+		err = saveErr
+	}
+	m.closeDestination()
+	if err == nil {
+		err = m.ctx.Err()
+	}
+	mr.finish(err)
+	return err
+}
+
+// Stop stops the Mirror and waits for it to finish the event it is mirroring, save its state and
+// close its watcher and destination. It returns the error the Mirror stopped with, if any.
+func (mr *Mirror) Stop() error {
+	mr.mu.Lock()
+	cancel, done := mr.cancel, mr.done
+	mr.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+
+	cancel()
+	<-done
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if mr.done == done {
+		mr.cancel, mr.done = nil, nil
+	}
+	return mr.err
+}
+
+// begin claims the Mirror for a run and returns a mirror for the pair that stops with the context.
+func (mr *Mirror) begin(ctx context.Context) (*mirror, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if mr.done != nil {
+		select {
+		case <-mr.done:
+		default:
+			return nil, ErrRunning
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	mr.cancel, mr.done, mr.err = cancel, make(chan struct{}), nil
+	m := newMirror(ctx, mr.pair, mr.log, mr.fs)
+	m.notify = mr.send
+	return m, nil
+}
+
+// finish records the error the run ended with and releases the Mirror.
+func (mr *Mirror) finish(err error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.err = err
+	mr.cancel()
+	close(mr.done)
+}
+
+// send hands the event to the reader of Events, without ever blocking the mirror.
+func (mr *Mirror) send(e Event) {
+	select {
+	case mr.events <- e:
+	default:
+		mr.log.Debug("Nobody is reading the events, dropping %v of '%v'.", e.Op, e.Path)
+	}
+}
+
+// report tells whoever is listening that the event was mirrored, or given up on. Writes to
+// directories are left out since there's nothing to mirror for them.
+func (m *mirror) report(event watcher.Event, err error) {
+	if m.notify == nil || event.Op == watcher.Write && event.FileInfo != nil && event.IsDir() {
+		return
+	}
+	e := Event{Op: event.Op, Path: m.relPath(event.Path), Err: err}
+	if path := strings.Split(event.Path, " -> "); len(path) == 2 {
+		e.OldPath, e.Path = m.relPath(path[0]), m.relPath(path[1])
+	}
+	m.notify(e)
+}
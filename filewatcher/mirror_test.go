@@ -0,0 +1,232 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/state"
+	"github.com/KaiserGald/mimic/vfs"
+	"github.com/radovskyb/watcher"
+)
+
+func TestNew(t *testing.T) {
+	tests := map[string][]Option{
+		"no source":           {WithDestination("des")},
+		"no destination":      {WithSource("src")},
+		"unknown backend":     {WithSource("src"), WithDestination("des"), WithBackend("fanotify")},
+		"unknown destination": {WithSource("src"), WithDestination("gopher://host/des")},
+	}
+	for name, opts := range tests {
+		if _, err := New(opts...); err == nil {
+			t.Errorf("Expected an error creating a mirror with %v.", name)
+		}
+	}
+
+	mr, err := New(WithPair(Pair{Source: "src", Ignore: []string{"*.tmp"}}), WithDestination("des"), WithIgnore("*.swp"))
+	if err != nil {
+		t.Fatalf("Error creating mirror: %v", err)
+	}
+	if p := mr.Pair(); p.String() != "src:des" || len(p.Ignore) != 2 {
+		t.Errorf("Options were not applied in order, got %+v", p)
+	}
+}
+
+func TestMirrorSync(t *testing.T) {
+	src, des := "testdir/syncsrc", "testdir/syncdes"
+	os.MkdirAll(src+"/sub", 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(des)
+	ioutil.WriteFile(src+"/sub/test.txt", []byte("test"), 0644)
+	ioutil.WriteFile(src+"/test.tmp", []byte("tmp"), 0644)
+
+	mr, err := New(WithSource(src), WithDestination(des), WithIgnore("*.tmp"), WithLogger(testLog))
+	if err != nil {
+		t.Fatalf("Error creating mirror: %v", err)
+	}
+	if err := mr.Sync(context.Background()); err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(des + "/sub/test.txt"); string(b) != "test" {
+		t.Errorf("Expected the file to be synced, got '%s'", b)
+	}
+	if _, err := os.Stat(des + "/test.tmp"); !os.IsNotExist(err) {
+		t.Errorf("Expected the ignored file not to be synced.")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mr.Sync(ctx); err != context.Canceled {
+		t.Errorf("Expected '%v' syncing with a cancelled context got '%v'", context.Canceled, err)
+	}
+}
+
+func TestMirrorSyncMem(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src/sub", 0755)
+	vfs.WriteFile(mem, "src/sub/test.txt", []byte("test"), 0644)
+
+	mr, _ := New(WithSource("src"), WithDestination("des"), WithFS(mem), WithLogger(testLog))
+	if err := mr.Sync(context.Background()); err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+	if b, _ := vfs.ReadFile(mem, "des/sub/test.txt"); string(b) != "test" {
+		t.Errorf("Expected the file to be synced, got '%s'", b)
+	}
+	if _, err := mem.Stat("des/" + state.FileName); err != nil {
+		t.Errorf("Expected the state to be saved in memory: %v", err)
+	}
+	if _, err := os.Stat("des"); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written to disk.")
+	}
+}
+
+func TestMirrorSyncArchive(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "src/sub", 0755)
+	vfs.WriteFile(mem, "src/sub/test.txt", []byte("test"), 0644)
+
+	mr, _ := New(WithSource("src"), WithDestination("zip://out/des.zip"), WithFS(mem), WithLogger(testLog))
+	if err := mr.Sync(context.Background()); err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+	b, err := vfs.ReadFile(mem, "out/des.zip")
+	if err != nil {
+		t.Fatalf("Expected the archive to be written when the sync is done: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("Error reading archive: %v", err)
+	}
+	if len(zr.File) != 2 || zr.File[0].Name != "sub/" || zr.File[1].Name != "sub/test.txt" {
+		t.Errorf("Expected the source in the archive got %v files", len(zr.File))
+	}
+}
+
+func TestMirrorStartStop(t *testing.T) {
+	src, des := "testdir/startsrc", "testdir/startdes"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(des)
+
+	mr, err := New(WithSource(src), WithDestination(des), WithBackend(BackendPoll),
+		WithInterval(10*time.Millisecond), WithDebounce(-1), WithLogger(testLog))
+	if err != nil {
+		t.Fatalf("Error creating mirror: %v", err)
+	}
+
+	// a mirror can be stopped and started again
+	for run := 0; run < 2; run++ {
+		if err := mr.Start(context.Background()); err != nil {
+			t.Fatalf("Error starting mirror: %v", err)
+		}
+		if err := mr.Start(context.Background()); err != ErrRunning {
+			t.Errorf("Expected '%v' starting twice got '%v'", ErrRunning, err)
+		}
+		if err := mr.Sync(context.Background()); err != ErrRunning {
+			t.Errorf("Expected '%v' syncing while running got '%v'", ErrRunning, err)
+		}
+
+		ioutil.WriteFile(src+"/test.txt", []byte("test"), 0644)
+		select {
+		case e := <-mr.Events():
+			if e.Path != "test.txt" || e.Err != nil {
+				t.Errorf("Expected an event for 'test.txt' got %+v", e)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for an event.")
+		}
+		if _, err := os.Stat(des + "/test.txt"); err != nil {
+			t.Errorf("Expected the file to be mirrored: %v", err)
+		}
+
+		if err := mr.Stop(); err != nil {
+			t.Errorf("Error stopping mirror: %v", err)
+		}
+		os.Remove(src + "/test.txt")
+		os.RemoveAll(des)
+	}
+	if err := mr.Stop(); err != nil {
+		t.Errorf("Expected stopping a stopped mirror to do nothing, got '%v'", err)
+	}
+}
+
+func TestMirrorStopArchive(t *testing.T) {
+	src, des := "testdir/archivesrc", "testdir/archive.zip"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll(src)
+	defer os.Remove(des)
+
+	// the archive isn't rebuilt while the mirror runs, only when it stops
+	mr, _ := New(WithSource(src), WithDestination("zip://"+des+"?settle=1h"), WithBackend(BackendPoll),
+		WithInterval(10*time.Millisecond), WithDebounce(-1), WithLogger(testLog))
+	if err := mr.Start(context.Background()); err != nil {
+		t.Fatalf("Error starting mirror: %v", err)
+	}
+	ioutil.WriteFile(src+"/test.txt", []byte("test"), 0644)
+	select {
+	case <-mr.Events():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for an event.")
+	}
+	if err := mr.Stop(); err != nil {
+		t.Errorf("Error stopping mirror: %v", err)
+	}
+
+	zr, err := zip.OpenReader(des)
+	if err != nil {
+		t.Fatalf("Expected the archive to be written when Stop returns: %v", err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 1 || zr.File[0].Name != "test.txt" {
+		t.Errorf("Expected the last change in the archive got %v files", len(zr.File))
+	}
+}
+
+func TestMirrorStartContext(t *testing.T) {
+	src := "testdir/ctxsrc"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll("testdir/ctxdes")
+
+	mr, _ := New(WithSource(src), WithDestination("testdir/ctxdes"), WithBackend(BackendPoll))
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := mr.Start(ctx); err != nil {
+		t.Fatalf("Error starting mirror: %v", err)
+	}
+	cancel()
+	if err := mr.Stop(); err != nil {
+		t.Errorf("Error stopping mirror: %v", err)
+	}
+
+	missing, _ := New(WithSource("testdir/nothere"), WithDestination("testdir/ctxdes"), WithBackend(BackendPoll))
+	if err := missing.Start(context.Background()); err == nil {
+		t.Errorf("Expected an error starting a mirror without a source.")
+	}
+}
+
+func TestReport(t *testing.T) {
+	var got []Event
+	m := &mirror{relfp: "/abs/src", notify: func(e Event) { got = append(got, e) }}
+	m.report(watcher.Event{Op: watcher.Rename, Path: "/abs/src/old.txt -> /abs/src/new.txt"}, nil)
+	m.report(watcher.Event{Op: watcher.Write, Path: "/abs/src/sub/test.txt"}, os.ErrPermission)
+
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 events got %v", len(got))
+	}
+	if got[0].Path != "new.txt" || got[0].OldPath != "old.txt" {
+		t.Errorf("Expected a rename from 'old.txt' to 'new.txt' got %+v", got[0])
+	}
+	if got[1].Path != "sub/test.txt" || got[1].Err != os.ErrPermission {
+		t.Errorf("Expected a failed write of 'sub/test.txt' got %+v", got[1])
+	}
+}
@@ -0,0 +1,136 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/state"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// defaultPruneThreshold is the percentage of the destination a prune may remove when a pair
+// doesn't set one.
+const defaultPruneThreshold = 50
+
+// Prune is how the destination is reconciled with the source on startup.
+type Prune struct {
+	// Enabled removes everything in the destination that isn't in the source.
+	Enabled bool
+	// DryRun only lists what would be removed.
+	DryRun bool
+	// Trash is a directory that pruned paths are moved into instead of being removed.
+	Trash string
+	// Threshold is the highest percentage of the destination that may be pruned, a prune that
+	// would remove more is aborted. 0 uses the default.
+	Threshold float64
+}
+
+// prune removes everything from the destination that has no counterpart in the source. Paths
+// that are ignored, the state index and the trash directory are left alone.
+func (m *mirror) prune() error {
+	m.log.Notice("[%v] Looking for paths in the destination that aren't in the source...", m)
+	local, isLocal := m.dest.(*destination.Local)
+	if m.Prune.Trash != "" && !isLocal {
+		return fmt.Errorf("a trash directory can only be used with a local destination")
+	}
+	tree, err := mapDestination(m.dest)
+	if err != nil {
+		return err
+	}
+
+	trash, _ := vfs.Abs(m.files.FS(), m.Prune.Trash)
+	var total int
+	var orphans []string
+	for file, info := range tree {
+		if file == state.FileName || m.isIgnored(file, info.IsDir()) {
+			continue
+		}
+		if m.Prune.Trash != "" {
+			if abs, _ := vfs.Abs(m.files.FS(), local.Path(file)); abs == trash || strings.HasPrefix(abs, trash+"/") {
+				continue
+			}
+		}
+		total++
+		if _, err := m.files.FS().Lstat(filepath.Join(m.Source, file)); os.IsNotExist(err) {
+			orphans = append(orphans, file)
+		}
+	}
+	if len(orphans) == 0 {
+		m.log.Info("[%v] Nothing to prune.", m)
+		return nil
+	}
+	sort.Strings(orphans)
+
+	threshold := m.Prune.Threshold
+	if threshold == 0 {
+		threshold = defaultPruneThreshold
+	}
+	percent := float64(len(orphans)) * 100 / float64(total)
+	action := "remove"
+	if m.Prune.Trash != "" {
+		action = "move to '" + m.Prune.Trash + "'"
+	}
+	m.log.Notice("[%v] Pruning would %v %d of %d paths (%.1f%%) in the destination:", m, action, len(orphans), total, percent)
+	for _, file := range orphans {
+		m.log.Notice("[%v]   %v", m, file)
+	}
+	if m.Prune.DryRun {
+		if percent > threshold {
+			m.log.Notice("[%v] Pruning would remove %.1f%% of the destination, more than the threshold of %v%%, so a real prune would be aborted.", m, percent, threshold)
+		}
+		m.log.Notice("[%v] Dry run, nothing was pruned.", m)
+		return nil
+	}
+	if percent > threshold {
+		return fmt.Errorf("pruning would remove %.1f%% of the destination, more than the threshold of %v%%", percent, threshold)
+	}
+
+	if m.Prune.Trash != "" {
+		return m.trash(local, orphans)
+	}
+	// remove the deepest paths first so directories are empty by the time they are removed
+	for i := len(orphans) - 1; i >= 0; i-- {
+		des := m.desPath(orphans[i])
+		m.log.Info("[%v] Pruning '%v'.", m, des)
+		if err := m.dest.Remove(orphans[i]); err != nil {
+			m.log.Error("[%v] Error pruning '%v': %v", m, des, err)
+		}
+	}
+	m.log.Notice("[%v] Pruned %d paths.", m, len(orphans))
+	return nil
+}
+
+// trash moves the orphans into a directory named after the current time in the trash
+// directory, keeping their paths. Orphans under a directory that is moved go with it.
+func (m *mirror) trash(local *destination.Local, orphans []string) error {
+	dir := filepath.Join(m.Prune.Trash, time.Now().Format("20060102-150405"))
+	var moved []string
+	for _, file := range orphans {
+		if len(moved) > 0 && strings.HasPrefix(file, moved[len(moved)-1]+"/") {
+			continue
+		}
+		des := local.Path(file)
+		to := filepath.Join(dir, file)
+		m.log.Info("[%v] Moving '%v' to '%v'.", m, des, to)
+		if err := vfs.MkdirAll(local.FS(), filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		if err := local.FS().Rename(des, to); err != nil {
+			m.log.Error("[%v] Error moving '%v' to the trash: %v", m, des, err)
+			continue
+		}
+		moved = append(moved, file)
+	}
+	m.log.Notice("[%v] Moved %d paths to '%v'.", m, len(moved), dir)
+	return nil
+}
@@ -0,0 +1,107 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KaiserGald/mimic/filehandler"
+)
+
+// pruneTree creates a source and a destination with two files in the destination that aren't in
+// the source, out of six paths in total.
+func pruneTree() *mirror {
+	os.RemoveAll("testdir/prune")
+	for _, dir := range []string{"testdir/prune/src/sub", "testdir/prune/des/sub", "testdir/prune/des/old"} {
+		os.MkdirAll(dir, 0777)
+	}
+	for _, file := range []string{"src/a.txt", "src/sub/b.txt", "des/a.txt", "des/sub/b.txt", "des/sub/c.txt", "des/old/d.txt"} {
+		ioutil.WriteFile("testdir/prune/"+file, []byte(file), 0644)
+	}
+	return &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest("testdir/prune/des"), Pair: Pair{Source: "testdir/prune/src", Destination: "testdir/prune/des"}}
+}
+
+func TestPrune(t *testing.T) {
+	defer os.RemoveAll("testdir/prune")
+	m := pruneTree()
+	m.Prune = Prune{Enabled: true, Threshold: 100}
+	if err := m.prune(); err != nil {
+		t.Fatalf("Error pruning: %v", err)
+	}
+	for _, file := range []string{"sub/c.txt", "old/d.txt", "old"} {
+		if _, err := os.Stat(filepath.Join(m.Destination, file)); !os.IsNotExist(err) {
+			t.Errorf("Expected '%v' to be pruned.", file)
+		}
+	}
+	for _, file := range []string{"a.txt", "sub/b.txt"} {
+		if _, err := os.Stat(filepath.Join(m.Destination, file)); err != nil {
+			t.Errorf("Expected '%v' to be kept: %v", file, err)
+		}
+	}
+}
+
+func TestPruneDryRun(t *testing.T) {
+	defer os.RemoveAll("testdir/prune")
+	m := pruneTree()
+	m.Prune = Prune{Enabled: true, DryRun: true, Threshold: 100}
+	if err := m.prune(); err != nil {
+		t.Fatalf("Error pruning: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(m.Destination, "old/d.txt")); err != nil {
+		t.Errorf("Expected a dry run to leave the destination alone: %v", err)
+	}
+}
+
+func TestPruneThreshold(t *testing.T) {
+	defer os.RemoveAll("testdir/prune")
+	m := pruneTree()
+	// 3 of the 6 paths in the destination would go
+	m.Prune = Prune{Enabled: true, Threshold: 40}
+	if err := m.prune(); err == nil {
+		t.Errorf("Expected pruning half the destination to be aborted.")
+	}
+	if _, err := os.Stat(filepath.Join(m.Destination, "old/d.txt")); err != nil {
+		t.Errorf("Expected an aborted prune to leave the destination alone: %v", err)
+	}
+
+	// a dry run only lists what a prune over the threshold would remove
+	m.Prune.DryRun = true
+	if err := m.prune(); err != nil {
+		t.Errorf("Expected a dry run over the threshold not to fail got %v", err)
+	}
+}
+
+func TestPruneTrash(t *testing.T) {
+	defer os.RemoveAll("testdir/prune")
+	m := pruneTree()
+	m.Prune = Prune{Enabled: true, Trash: "testdir/prune/des/.trash", Threshold: 100}
+	if err := m.prune(); err != nil {
+		t.Fatalf("Error pruning: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(m.Destination, "old")); !os.IsNotExist(err) {
+		t.Errorf("Expected 'old' to be moved out of the destination.")
+	}
+
+	moved, _ := filepath.Glob("testdir/prune/des/.trash/*/old/d.txt")
+	if len(moved) != 1 {
+		t.Errorf("Expected 'old/d.txt' to be in the trash, got %v", moved)
+	}
+	moved, _ = filepath.Glob("testdir/prune/des/.trash/*/sub/c.txt")
+	if len(moved) != 1 {
+		t.Errorf("Expected 'sub/c.txt' to be in the trash, got %v", moved)
+	}
+
+	// the trash is in the destination but is never pruned itself
+	if err := m.prune(); err != nil {
+		t.Fatalf("Error pruning again: %v", err)
+	}
+	if _, err := os.Stat("testdir/prune/des/.trash"); err != nil {
+		t.Errorf("Expected the trash to be left alone: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/radovskyb/watcher"
+)
+
+const (
+	// defaultRetries is how many times a failed event is retried when a pair doesn't say.
+	defaultRetries = 5
+	// retryBase is how long the first retry waits, every retry after it waits twice as long.
+	retryBase = time.Millisecond * 100
+	// retryMax is the longest a retry waits.
+	retryMax = time.Second * 10
+	// maxDeadLetters is how many failed events are remembered.
+	maxDeadLetters = 100
+)
+
+// attempt is an event that is being mirrored, along with how many times it has failed.
+type attempt struct {
+	event watcher.Event
+	count int
+}
+
+// deadLetter is an event that was given up on.
+type deadLetter struct {
+	Event    watcher.Event
+	Err      error
+	Attempts int
+	Time     time.Time
+}
+
+// transient checks if the error is likely to go away by itself, like a busy file, a full disk or
+// a destination that can't be reached.
+func transient(err error) bool {
+	if os.IsTimeout(err) || errors.Is(err, destination.ErrUnavailable) {
+		return true
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.EAGAIN, syscall.EBUSY, syscall.EINTR, syscall.ETXTBSY, syscall.ENOSPC,
+			syscall.EMFILE, syscall.ENFILE, syscall.EIO:
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait before the given retry, doubling every time with some jitter
+// so that a lot of failed events aren't all retried at once.
+func backoff(retry int) time.Duration {
+	d := retryBase << uint(retry-1)
+	if d > retryMax || d <= 0 {
+		d = retryMax
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retries returns how many times the pair retries a failed event.
+func (m *mirror) retries() int {
+	if m.Retries == 0 {
+		return defaultRetries
+	}
+	if m.Retries < 0 {
+		return 0
+	}
+	return m.Retries
+}
+
+// retry sends the attempt back to the event loop after a backoff if the error is transient and
+// it has retries left, otherwise the event is parked in the dead letters. It returns whether the
+// attempt is going to be retried. A retry that is due once the loop has stopped is dropped.
+func (m *mirror) retry(a *attempt, err error, retries chan<- *attempt) bool {
+	a.count++
+	if !transient(err) || a.count > m.retries() {
+		m.bury(a, err)
+		return false
+	}
+	d := backoff(a.count)
+	m.log.Notice("[%v] %v of '%v' failed: %v, retrying in %v.", m, a.event.Op, a.event.Path, err, d)
+	closed, done, quit := m.w.Closed(), m.done(), m.quit
+	time.AfterFunc(d, func() {
+		select {
+		case retries <- a:
+		case <-closed:
+		case <-done:
+		case <-quit:
+		}
+	})
+	return true
+}
+
+// bury gives up on the event and adds it to the dead letters, dropping the oldest one when
+// there are too many.
+func (m *mirror) bury(a *attempt, err error) {
+	m.log.Error("[%v] Giving up on %v of '%v' after %d attempts: %v", m, a.event.Op, a.event.Path, a.count, err)
+	m.report(a.event, err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dead = append(m.dead, deadLetter{Event: a.event, Err: err, Attempts: a.count, Time: time.Now()})
+	if len(m.dead) > maxDeadLetters {
+		m.dead = m.dead[len(m.dead)-maxDeadLetters:]
+	}
+}
+
+// deadLetters returns the events that were given up on, oldest first.
+func (m *mirror) deadLetters() []deadLetter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]deadLetter{}, m.dead...)
+}
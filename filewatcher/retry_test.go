@@ -0,0 +1,208 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/filehandler"
+	"github.com/KaiserGald/mimic/vfs"
+	"github.com/radovskyb/watcher"
+)
+
+// fakeBackend is a backend whose events are sent by the test.
+type fakeBackend struct {
+	events chan watcher.Event
+	errors chan error
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		events: make(chan watcher.Event),
+		errors: make(chan error),
+		closed: make(chan struct{}),
+	}
+}
+
+func (f *fakeBackend) AddRecursive(name string) error       { return nil }
+func (f *fakeBackend) WatchedFiles() map[string]os.FileInfo { return nil }
+func (f *fakeBackend) Start() error                         { <-f.closed; return nil }
+func (f *fakeBackend) Close()                               { f.once.Do(func() { close(f.closed) }) }
+func (f *fakeBackend) Events() <-chan watcher.Event         { return f.events }
+func (f *fakeBackend) Errors() <-chan error                 { return f.errors }
+func (f *fakeBackend) Closed() <-chan struct{}              { return f.closed }
+
+func TestTransient(t *testing.T) {
+	tests := map[error]bool{
+		&os.PathError{Op: "open", Path: "test.txt", Err: syscall.EBUSY}:   true,
+		&os.PathError{Op: "write", Path: "test.txt", Err: syscall.ENOSPC}: true,
+		&os.PathError{Op: "open", Path: "test.txt", Err: syscall.ENOENT}:  false,
+		&os.PathError{Op: "open", Path: "test.txt", Err: syscall.EACCES}:  false,
+		filehandler.ErrOutsideRoot:                                        false,
+		fmt.Errorf("%w: connection refused", destination.ErrUnavailable):  true,
+	}
+	for err, expected := range tests {
+		if actual := transient(err); actual != expected {
+			t.Errorf("Expected transient(%v) to be %v got %v", err, expected, actual)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for retry := 1; retry < 20; retry++ {
+		d := retryBase << uint(retry-1)
+		if d > retryMax {
+			d = retryMax
+		}
+		if actual := backoff(retry); actual < d/2 || actual > d {
+			t.Errorf("Expected retry %d to wait between %v and %v got %v", retry, d/2, d, actual)
+		}
+	}
+}
+
+func TestLoopSurvivesErrors(t *testing.T) {
+	b := newFakeBackend()
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest("testdir/missingdes"), Pair: Pair{Source: "testdir/missing", Destination: "testdir/missingdes"}, w: b}
+
+	done := make(chan error)
+	go func() {
+		done <- m.loop(b.events)
+	}()
+
+	// neither file exists, so both events fail for good
+	for _, name := range []string{"/a.txt", "/b.txt"} {
+		b.events <- watcher.Event{watcher.Write, name, removedInfo{name: name}}
+	}
+	b.errors <- errors.New("something went wrong")
+	b.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the loop to stop without an error got %v", err)
+	}
+
+	dead := m.deadLetters()
+	if len(dead) != 2 {
+		t.Fatalf("Expected 2 dead letters got %v", len(dead))
+	}
+	if dead[1].Event.Path != "/b.txt" || dead[1].Attempts != 1 {
+		t.Errorf("Expected '/b.txt' to be given up on after 1 attempt, got %+v", dead[1])
+	}
+}
+
+func TestLoopFailFast(t *testing.T) {
+	b := newFakeBackend()
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), dest: localDest("testdir/missingdes"), Pair: Pair{Source: "testdir/missing", Destination: "testdir/missingdes", FailFast: true}, w: b}
+
+	done := make(chan error)
+	go func() {
+		done <- m.loop(b.events)
+	}()
+	b.events <- watcher.Event{watcher.Write, "/a.txt", removedInfo{name: "a.txt"}}
+	if err := <-done; err == nil {
+		t.Errorf("Expected a failing event to stop the loop when failing fast.")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	b := newFakeBackend()
+	defer b.Close()
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), Pair: Pair{Retries: 1}, w: b}
+	busy := &os.PathError{Op: "open", Path: "a.txt", Err: syscall.EBUSY}
+	a := &attempt{event: watcher.Event{watcher.Write, "/a.txt", nil}}
+	retries := make(chan *attempt)
+
+	m.retry(a, busy, retries)
+	select {
+	case retried := <-retries:
+		if retried.count != 1 {
+			t.Errorf("Expected the first retry to have failed once, got %v", retried.count)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("A transient error wasn't retried.")
+	}
+
+	m.retry(a, busy, retries)
+	if len(m.deadLetters()) != 1 {
+		t.Errorf("Expected the event to be given up on once it's out of retries.")
+	}
+}
+
+// busyDest is a destination whose first copy fails with a transient error, it counts the copies.
+type busyDest struct {
+	destination.Destination
+	mu     sync.Mutex
+	copies int
+}
+
+func (b *busyDest) Differs(src, rel string, cmp filehandler.Compare) (bool, error) { return true, nil }
+
+func (b *busyDest) CopyFile(src, rel string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.copies++
+	if b.copies == 1 {
+		return &os.PathError{Op: "open", Path: rel, Err: syscall.EBUSY}
+	}
+	return b.Destination.CopyFile(src, rel)
+}
+
+func (b *busyDest) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.copies
+}
+
+func TestRetryReplaced(t *testing.T) {
+	mem := vfs.NewMem()
+	vfs.MkdirAll(mem, "/src", 0755)
+	vfs.WriteFile(mem, "/src/a.txt", []byte("a"), 0644)
+	des, _ := destination.Open("/des", destination.Options{Log: testLog, FS: mem})
+	dest := &busyDest{Destination: des}
+	b := newFakeBackend()
+	m := &mirror{log: testLog, files: filehandler.New(testLog, mem), dest: dest, Pair: Pair{Source: "/src", Destination: "/des"}, relfp: "/src", w: b}
+
+	done := make(chan error)
+	go func() {
+		done <- m.loop(b.events)
+	}()
+	info, _ := mem.Lstat("/src/a.txt")
+	// the first write fails and is retried, but the second one comes in before the retry does
+	b.events <- watcher.Event{Op: watcher.Write, Path: "/src/a.txt", FileInfo: info}
+	b.events <- watcher.Event{Op: watcher.Write, Path: "/src/a.txt", FileInfo: info}
+	time.Sleep(2 * retryBase)
+	b.Close()
+	<-done
+	if copies := dest.count(); copies != 2 {
+		t.Errorf("Expected the retry to be dropped for the newer write got %d copies", copies)
+	}
+}
+
+func TestRetryStopped(t *testing.T) {
+	b := newFakeBackend()
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &mirror{log: testLog, files: filehandler.New(testLog, nil), Pair: Pair{Retries: 1}, w: b, ctx: ctx}
+	busy := &os.PathError{Op: "open", Path: "a.txt", Err: syscall.EBUSY}
+	before := runtime.NumGoroutine()
+
+	// nothing reads the retry once the loop has stopped, and it's dropped rather than left waiting
+	m.retry(&attempt{event: watcher.Event{Op: watcher.Write, Path: "/a.txt"}}, busy, make(chan *attempt))
+	cancel()
+	time.Sleep(2 * retryBase)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected the retry not to be left waiting got %d goroutines, %d before", after, before)
+	}
+}
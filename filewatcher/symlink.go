@@ -0,0 +1,276 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// SymlinkPolicy decides what happens to symlinks in the source.
+type SymlinkPolicy string
+
+const (
+	// SymlinkPreserve copies symlinks as links pointing at the same place.
+	SymlinkPreserve SymlinkPolicy = "preserve"
+	// SymlinkFollow copies what symlinks point to, directories along with everything in them.
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkRewrite copies symlinks as links, with absolute links that point inside the source
+	// made relative so they point inside the destination instead.
+	SymlinkRewrite SymlinkPolicy = "rewrite"
+	// SymlinkSkip leaves symlinks out of the destination.
+	SymlinkSkip SymlinkPolicy = "skip"
+)
+
+// ParseSymlinks checks the name of a symlink policy, an empty name is SymlinkPreserve.
+func ParseSymlinks(name string) (SymlinkPolicy, error) {
+	switch s := SymlinkPolicy(name); s {
+	case "":
+		return SymlinkPreserve, nil
+	case SymlinkPreserve, SymlinkFollow, SymlinkRewrite, SymlinkSkip:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown symlink policy '%v'", name)
+}
+
+// symlinks returns the pair's symlink policy. Links are followed instead of kept for destinations
+// that can't hold them.
+func (m *mirror) symlinks() SymlinkPolicy {
+	policy := m.Symlinks
+	if policy == "" {
+		policy = SymlinkPreserve
+	}
+	if policy == SymlinkPreserve || policy == SymlinkRewrite {
+		if _, ok := m.dest.(destination.Linker); !ok {
+			return SymlinkFollow
+		}
+	}
+	return policy
+}
+
+// isLink checks if the info is of a symlink.
+func isLink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// statSource returns the info of the source path, following a symlink only if the policy does.
+func (m *mirror) statSource(fp string) (os.FileInfo, error) {
+	if m.symlinks() == SymlinkFollow {
+		return m.files.FS().Stat(fp)
+	}
+	return m.files.FS().Lstat(fp)
+}
+
+// mapSource returns a map of everything under the directory in the source, with the symlink
+// policy applied. Skipped links are left out, and followed links are mapped as what they point
+// to, along with everything under them, unless they are ignored.
+func (m *mirror) mapSource(dir string) (map[string]os.FileInfo, error) {
+	real, err := vfs.EvalSymlinks(m.files.FS(), dir)
+	if err != nil {
+		return nil, err
+	}
+	base, err := filepath.Rel(m.Source, dir)
+	if err != nil {
+		return nil, err
+	}
+	return m.mapLinks(dir, filepath.ToSlash(base), []string{real})
+}
+
+// mapLinks maps the directory for mapSource, base is where it is in the source. The chain holds
+// the real paths of the directories that were followed to get there, the last one being the
+// directory's own, and a link that points at or above one of them would be followed forever.
+func (m *mirror) mapLinks(dir, base string, chain []string) (map[string]os.FileInfo, error) {
+	// the directory itself can be a link, which isn't walked into
+	tree, err := mapTree(m.files.FS(), chain[len(chain)-1])
+	policy := m.symlinks()
+	if err != nil || policy == SymlinkPreserve || policy == SymlinkRewrite {
+		return tree, err
+	}
+
+	var links []string
+	for rel, info := range tree {
+		if isLink(info) {
+			links = append(links, rel)
+		}
+	}
+	sort.Strings(links)
+	for _, rel := range links {
+		delete(tree, rel)
+		fp := filepath.Join(dir, filepath.FromSlash(rel))
+		if policy == SymlinkSkip {
+			m.log.Debug("Skipping symlink '%v'.", fp)
+			continue
+		}
+		if m.isIgnored(path.Join(base, rel), true) {
+			m.log.Debug("'%v' is ignored, not following it.", fp)
+			continue
+		}
+		info, err := m.files.FS().Stat(fp)
+		if err != nil {
+			m.log.Notice("[%v] Can't follow symlink '%v', skipping it: %v", m, fp, err)
+			continue
+		}
+		if !info.IsDir() {
+			tree[rel] = info
+			continue
+		}
+		real, err := vfs.EvalSymlinks(m.files.FS(), fp)
+		if err != nil {
+			m.log.Notice("[%v] Can't follow symlink '%v', skipping it: %v", m, fp, err)
+			continue
+		}
+		parent, _ := vfs.EvalSymlinks(m.files.FS(), filepath.Dir(fp))
+		if loops(real, append(chain, parent)) {
+			m.log.Notice("[%v] Symlink '%v' points back at '%v', skipping it so it isn't followed forever.", m, fp, real)
+			continue
+		}
+		m.log.Debug("Following symlink '%v' to '%v'.", fp, real)
+		sub, err := m.mapLinks(fp, path.Join(base, rel), append(chain[:len(chain):len(chain)], real))
+		if err != nil {
+			return nil, err
+		}
+		tree[rel] = info
+		for p, info := range sub {
+			tree[rel+"/"+p] = info
+		}
+	}
+	return tree, nil
+}
+
+// loops checks if the directory is one of the others, or above one of them.
+func loops(dir string, others []string) bool {
+	for _, other := range others {
+		if other == dir || strings.HasPrefix(other, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyLink copies the symlink at src to rel as a link, rewriting it first if the policy says so.
+func (m *mirror) copyLink(src, rel string) error {
+	target, err := m.files.FS().Readlink(src)
+	if err != nil {
+		return err
+	}
+	if m.symlinks() == SymlinkRewrite {
+		target = m.rewriteLink(src, target)
+	}
+	if info, err := m.dest.Stat(rel); err == nil && info.IsDir() {
+		m.log.Debug("'%v' is a directory, removing it to make way for a link.", m.desPath(rel))
+		if err := m.dest.RemoveAll(rel); err != nil {
+			return err
+		}
+	}
+	if err := m.dest.CopyDir(filepath.Dir(src), path.Dir(rel)); err != nil {
+		return err
+	}
+	m.log.Info("[%v] Linking '%v' to '%v'.", m, m.desPath(rel), target)
+	return m.dest.(destination.Linker).Symlink(target, rel)
+}
+
+// rewriteLink makes an absolute link that points inside the source relative to where the link
+// is, so its copy points to the same place inside the destination. Any other link is left alone.
+func (m *mirror) rewriteLink(src, target string) string {
+	if !filepath.IsAbs(target) {
+		return target
+	}
+	root, err := vfs.Abs(m.files.FS(), m.Source)
+	if err != nil {
+		return target
+	}
+	if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return target
+	}
+	fp, err := vfs.Abs(m.files.FS(), src)
+	if err != nil {
+		return target
+	}
+	rewritten, err := filepath.Rel(filepath.Dir(fp), target)
+	if err != nil {
+		return target
+	}
+	m.log.Debug("Rewriting link '%v' from '%v' to '%v'.", src, target, rewritten)
+	return rewritten
+}
+
+// copyPath copies the source path to rel, whatever it is, following the symlink policy.
+func (m *mirror) copyPath(src, rel string) error {
+	info, err := m.files.FS().Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !isLink(info) {
+		if info.IsDir() {
+			return m.dest.CopyDir(src, rel)
+		}
+		return m.dest.CopyFile(src, rel)
+	}
+
+	switch m.symlinks() {
+	case SymlinkSkip:
+		m.log.Debug("Skipping symlink '%v'.", src)
+		return nil
+	case SymlinkPreserve, SymlinkRewrite:
+		return m.copyLink(src, rel)
+	}
+	info, err = m.files.FS().Stat(src)
+	if err != nil {
+		m.log.Notice("[%v] Can't follow symlink '%v', skipping it: %v", m, src, err)
+		return nil
+	}
+	if info.IsDir() {
+		return m.copyTree(src, rel)
+	}
+	return m.dest.CopyFile(src, rel)
+}
+
+// copyTree copies the source directory and everything in it to rel, following the symlink
+// policy.
+func (m *mirror) copyTree(src, rel string) error {
+	tree, err := m.mapSource(src)
+	if err != nil {
+		return err
+	}
+	if err := m.dest.CopyDir(src, rel); err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(tree))
+	for p := range tree {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if err := m.copyEntry(filepath.Join(src, filepath.FromSlash(p)), path.Join(rel, p), tree[p]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyEntry copies an entry of a tree from mapSource to rel.
+func (m *mirror) copyEntry(src, rel string, info os.FileInfo) error {
+	switch {
+	case isLink(info):
+		return m.copyLink(src, rel)
+	case info.IsDir():
+		return m.dest.CopyDir(src, rel)
+	}
+	return m.dest.CopyFile(src, rel)
+}
+
+// linked checks if the source path is a symlink.
+func (m *mirror) linked(src string) bool {
+	info, err := m.files.FS().Lstat(src)
+	return err == nil && isLink(info)
+}
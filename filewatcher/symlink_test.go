@@ -0,0 +1,157 @@
+// Package filewatcher
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package filewatcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KaiserGald/mimic/destination"
+)
+
+// linkTree creates a source with every kind of symlink in it, and returns its absolute path.
+func linkTree(t *testing.T, src string) string {
+	os.MkdirAll(src+"/dir", 0755)
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		t.Fatalf("Error finding the source: %v", err)
+	}
+	ioutil.WriteFile(src+"/file.txt", []byte("file"), 0644)
+	ioutil.WriteFile(src+"/dir/inner.txt", []byte("inner"), 0644)
+	os.Symlink("file.txt", src+"/rel")
+	os.Symlink(abs+"/dir/inner.txt", src+"/abs")
+	os.Symlink("/", src+"/outside")
+	os.Symlink("nothere", src+"/dangling")
+	os.Symlink("dir", src+"/dirlink")
+	os.Symlink(".", src+"/loop")
+	os.Symlink("..", src+"/dir/back")
+	os.Symlink("cycle", src+"/cycle")
+	return abs
+}
+
+// readLink returns where the link points, or what's in the file, or "" if there's nothing there.
+func readLink(fp string) string {
+	info, err := os.Lstat(fp)
+	if err != nil {
+		return ""
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, _ := os.Readlink(fp)
+		return "-> " + target
+	}
+	if info.IsDir() {
+		return "dir"
+	}
+	b, _ := ioutil.ReadFile(fp)
+	return string(b)
+}
+
+func TestSymlinkPolicies(t *testing.T) {
+	src := "testdir/linksrc"
+	defer os.RemoveAll(src)
+	abs := linkTree(t, src)
+
+	tests := map[SymlinkPolicy]map[string]string{
+		SymlinkPreserve: {
+			"rel": "-> file.txt", "abs": "-> " + abs + "/dir/inner.txt", "outside": "-> /", "dangling": "-> nothere",
+			"dirlink": "-> dir", "loop": "-> .", "dir/back": "-> ..", "cycle": "-> cycle", "file.txt": "file",
+		},
+		SymlinkRewrite: {
+			"rel": "-> file.txt", "abs": "-> dir/inner.txt", "outside": "-> /", "dangling": "-> nothere",
+			"dirlink": "-> dir", "loop": "-> .",
+		},
+		SymlinkFollow: {
+			"rel": "file", "abs": "inner", "dangling": "", "dirlink": "dir", "dirlink/inner.txt": "inner",
+			"dirlink/back": "", "loop": "", "dir/back": "", "cycle": "", "outside": "",
+		},
+		SymlinkSkip: {
+			"rel": "", "abs": "", "dangling": "", "dirlink": "", "loop": "", "dir/back": "", "file.txt": "file",
+			"dir/inner.txt": "inner",
+		},
+	}
+	for policy, expected := range tests {
+		t.Run(string(policy), func(t *testing.T) {
+			des := "testdir/linkdes-" + string(policy)
+			defer os.RemoveAll(des)
+			opts := []Option{WithSource(src), WithDestination(des), WithLogger(testLog), WithSymlinks(policy)}
+			if policy == SymlinkFollow {
+				// following '/' would copy the whole file system
+				opts = append(opts, WithIgnore("/outside"))
+			}
+			mr, _ := New(opts...)
+			done := make(chan error, 1)
+			go func() { done <- mr.Sync(context.Background()) }()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("Error syncing: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out syncing, symlinks are followed in a loop.")
+			}
+			for rel, want := range expected {
+				if got := readLink(filepath.Join(des, rel)); got != want {
+					t.Errorf("Expected '%v' to be '%v' got '%v'", rel, want, got)
+				}
+			}
+
+			// syncing again leaves everything as it is
+			if err := mr.Sync(context.Background()); err != nil {
+				t.Fatalf("Error syncing again: %v", err)
+			}
+			for rel, want := range expected {
+				if got := readLink(filepath.Join(des, rel)); got != want {
+					t.Errorf("Expected '%v' to still be '%v' got '%v'", rel, want, got)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseSymlinks("copy"); err == nil {
+		t.Errorf("Expected an error parsing an unknown symlink policy.")
+	}
+	// destinations that can't hold links get what they point to
+	m := &mirror{Pair: Pair{Symlinks: SymlinkRewrite}, dest: struct{ destination.Destination }{}}
+	if policy := m.symlinks(); policy != SymlinkFollow {
+		t.Errorf("Expected links to be followed for a destination without links got '%v'", policy)
+	}
+}
+
+func TestSymlinkEvents(t *testing.T) {
+	src, des := "testdir/linkevsrc", "testdir/linkevdes"
+	os.MkdirAll(src, 0777)
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(des)
+	ioutil.WriteFile(src+"/test.txt", []byte("test"), 0644)
+
+	mr, _ := New(WithSource(src), WithDestination(des), WithBackend(BackendPoll), WithInterval(10*time.Millisecond),
+		WithDebounce(-1), WithLogger(testLog))
+	if err := mr.Start(context.Background()); err != nil {
+		t.Fatalf("Error starting mirror: %v", err)
+	}
+	defer mr.Stop()
+
+	wait := func(fp, expected string) {
+		deadline := time.Now().Add(2 * time.Second)
+		for readLink(fp) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for '%v' to be '%v' got '%v'", fp, expected, readLink(fp))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	wait(des+"/test.txt", "test")
+	os.Symlink("test.txt", src+"/link")
+	wait(des+"/link", "-> test.txt")
+	os.Symlink("gone.txt", src+"/dangling")
+	wait(des+"/dangling", "-> gone.txt")
+	os.Remove(src + "/link")
+	wait(des+"/link", "")
+}
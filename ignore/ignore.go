@@ -0,0 +1,231 @@
+// Package ignore
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// FileName is the name of the files in the source tree that hold ignore patterns.
+const FileName = ".mimicignore"
+
+// rule is a single gitignore style pattern.
+type rule struct {
+	// base is the directory, relative to the source, of the file the rule came from.
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher decides which paths are ignored. Rules are checked in order and the last one to
+// match a path wins, the same way git does it.
+type Matcher struct {
+	rules []rule
+}
+
+// New creates a matcher from patterns that apply to the whole source tree. A pattern starting
+// with '!' includes paths that an earlier pattern ignored.
+func New(patterns []string) *Matcher {
+	m := &Matcher{}
+	m.Add("", patterns)
+	return m
+}
+
+// Load creates a matcher from the given patterns and every .mimicignore file found under root.
+// Files deeper in the tree take precedence over the ones above them.
+func Load(root string, patterns []string) (*Matcher, error) {
+	return LoadFS(vfs.OS, root, patterns)
+}
+
+// LoadFS is Load for a root in the given file system.
+func LoadFS(fsys vfs.FS, root string, patterns []string) (*Matcher, error) {
+	m := New(patterns)
+
+	var files []string
+	err := vfs.Walk(fsys, root, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && info.Name() == FileName {
+			files = append(files, fp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return strings.Count(files[i], "/") < strings.Count(files[j], "/")
+	})
+	for _, file := range files {
+		patterns, err := readFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		base, err := filepath.Rel(root, filepath.Dir(file))
+		if err != nil {
+			return nil, err
+		}
+		m.Add(filepath.ToSlash(base), patterns)
+	}
+
+	return m, nil
+}
+
+// readFile reads the patterns out of an ignore file, skipping blank lines and comments.
+func readFile(fsys vfs.FS, file string) ([]string, error) {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// Add adds patterns that only apply below the given directory, which is relative to the source.
+func (m *Matcher) Add(base string, patterns []string) {
+	if base == "." {
+		base = ""
+	}
+	for _, p := range patterns {
+		r := rule{base: base}
+		if strings.HasPrefix(p, "!") {
+			r.negate = true
+			p = p[1:]
+		} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			r.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+		if p == "" {
+			continue
+		}
+
+		// a pattern with a slash in it is matched from the base, otherwise it matches at any depth
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		expr := toRegexp(p)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			continue
+		}
+		r.re = re
+		m.rules = append(m.rules, r)
+	}
+}
+
+// toRegexp turns a glob with gitignore's '**' handling into a regular expression.
+func toRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// Match checks if the path, relative to the source, is ignored. A path inside an ignored
+// directory is always ignored.
+func (m *Matcher) Match(rel string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if rel == "" || rel == "." {
+		return false
+	}
+
+	// check the parent directories first
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// match runs the path against every rule, the last rule that matches decides.
+func (m *Matcher) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		p := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			p = strings.TrimPrefix(rel, r.base+"/")
+		}
+		if r.re.MatchString(p) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// IsIgnoreFile checks if the path is a .mimicignore file.
+func IsIgnoreFile(fp string) bool {
+	return path.Base(filepath.ToSlash(fp)) == FileName
+}
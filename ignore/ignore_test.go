@@ -0,0 +1,85 @@
+// Package ignore
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	m := New([]string{"*.swp", "build/", "/docs/*.md", "!docs/README.md", "logs/**/debug.log", "cache?"})
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"main.go", false, false},
+		{".main.go.swp", false, true},
+		{"src/.main.go.swp", false, true},
+		{"build", true, true},
+		{"build", false, false},
+		{"build/out.txt", false, true},
+		{"src/build/out.txt", false, true},
+		{"docs/guide.md", false, true},
+		{"docs/README.md", false, false},
+		{"src/docs/guide.md", false, false},
+		{"logs/debug.log", false, true},
+		{"logs/a/b/debug.log", false, true},
+		{"cache1", true, true},
+		{"cache", true, false},
+		{".", true, false},
+	}
+
+	for _, test := range tests {
+		if actual := m.Match(test.path, test.isDir); actual != test.expected {
+			t.Errorf("Expected Match('%v', %v) to be %v got %v", test.path, test.isDir, test.expected, actual)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	os.MkdirAll("testdir/sub/deeper", 0777)
+	defer os.RemoveAll("testdir")
+	ioutil.WriteFile("testdir/"+FileName, []byte("# comment\n*.log\n\ntmp/\n"), 0644)
+	ioutil.WriteFile("testdir/sub/"+FileName, []byte("!keep.log\n/local.txt\n"), 0644)
+	ioutil.WriteFile("testdir/sub/deeper/"+FileName, []byte("keep.log\n"), 0644)
+
+	m, err := Load("testdir", []string{"*.bak"})
+	if err != nil {
+		t.Fatalf("Error loading ignore files: %v", err)
+	}
+
+	tests := map[string]bool{
+		"app.log":               true,
+		"old.bak":               true,
+		"sub/keep.log":          false,
+		"sub/other.log":         true,
+		"sub/local.txt":         true,
+		"local.txt":             false,
+		"sub/deeper/local.txt":  false,
+		"sub/deeper/keep.log":   true,
+		"sub/deeper/notes.txt":  false,
+		"sub/" + FileName:       false,
+		"sub/tmp/anything.html": true,
+	}
+	for path, expected := range tests {
+		if actual := m.Match(path, false); actual != expected {
+			t.Errorf("Expected Match('%v') to be %v got %v", path, expected, actual)
+		}
+	}
+}
+
+func TestIsIgnoreFile(t *testing.T) {
+	if !IsIgnoreFile("/home/src/sub/" + FileName) {
+		t.Errorf("Expected '%v' to be an ignore file.", FileName)
+	}
+	if IsIgnoreFile("/home/src/sub/notes.txt") {
+		t.Errorf("Didn't expect 'notes.txt' to be an ignore file.")
+	}
+}
@@ -0,0 +1,41 @@
+// Package logging
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package logging
+
+import "github.com/KaiserGald/logger"
+
+// Logger is where mimic writes what it is doing. Every level takes a printf style format, from the
+// debug output only shown in dev mode up to errors, which are always shown.
+type Logger interface {
+	Debug(format string, args ...interface{})
+	Info(format string, args ...interface{})
+	Notice(format string, args ...interface{})
+	Error(format string, args ...interface{})
+}
+
+// Discard is a Logger that throws everything away.
+var Discard Logger = discard{}
+
+// New returns a Logger that writes to the given logger, at whatever level it is set to.
+func New(lg *logger.Logger) Logger {
+	return wrapped{lg}
+}
+
+type wrapped struct {
+	lg *logger.Logger
+}
+
+func (w wrapped) Debug(format string, args ...interface{})  { w.lg.Debug.Log(format, args...) }
+func (w wrapped) Info(format string, args ...interface{})   { w.lg.Info.Log(format, args...) }
+func (w wrapped) Notice(format string, args ...interface{}) { w.lg.Notice.Log(format, args...) }
+func (w wrapped) Error(format string, args ...interface{})  { w.lg.Error.Log(format, args...) }
+
+type discard struct{}
+
+func (discard) Debug(format string, args ...interface{})  {}
+func (discard) Info(format string, args ...interface{})   {}
+func (discard) Notice(format string, args ...interface{}) {}
+func (discard) Error(format string, args ...interface{})  {}
@@ -6,63 +6,312 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/KaiserGald/logger"
+	"github.com/KaiserGald/mimic/config"
+	"github.com/KaiserGald/mimic/control"
+	"github.com/KaiserGald/mimic/destination"
+	"github.com/KaiserGald/mimic/filehandler"
 	"github.com/KaiserGald/mimic/filewatcher"
+	"github.com/KaiserGald/mimic/logging"
 	"github.com/logrusorgru/aurora"
 )
 
+// exitDrainTimeout is the exit status when mimic was asked to stop but didn't finish in time.
+const exitDrainTimeout = 3
+
 var (
-	watch   string
-	color   bool
-	dev     bool
-	verbose bool
-	quiet   bool
-	l       *logger.Logger
-	au      aurora.Aurora
+	watch         listFlag
+	ignores       listFlag
+	includes      listFlag
+	configFile    string
+	controlSocket string
+	backend       string
+	compare       string
+	conflict      string
+	stateDir      string
+	symlinks      string
+	preserve      string
+	progressSize  string
+	trash         string
+	debounce      time.Duration
+	drain         time.Duration
+	retries       int
+	threshold     float64
+	inPlace       bool
+	hardLinks     bool
+	delta         bool
+	bidirectional bool
+	failFast      bool
+	prune         bool
+	dryRun        bool
+	color         bool
+	dev           bool
+	verbose       bool
+	quiet         bool
+	l             *logger.Logger
+	au            aurora.Aurora
 )
 
-func processFlags() (string, string) {
+// listFlag collects every value of a flag that can be given more than once.
+type listFlag []string
+
+// String returns the values as a comma separated list.
+func (lf *listFlag) String() string {
+	return strings.Join(*lf, ", ")
+}
+
+// Set adds another value to the list.
+func (lf *listFlag) Set(value string) error {
+	*lf = append(*lf, value)
+	return nil
+}
+
+func processFlags() []filewatcher.Pair {
+	flag.StringVar(&configFile, "config", "", "Loads the pairs and settings from a YAML or JSON config file. Flags override the values in the file.")
+
+	flag.StringVar(&backend, "b", "", "Short version of -backend. Watches the sources with the given backend, either 'inotify' or 'poll'.")
+	flag.StringVar(&backend, "backend", "", "Watches the sources with the given backend, either 'inotify' or 'poll'. Defaults to inotify on linux.")
+
+	flag.StringVar(&controlSocket, "control", "", "Listens for commands like 'reload' and 'status' on a unix socket at the given path.")
+
+	flag.StringVar(&compare, "compare", "", "Decides which files are copied, either 'size' for size and modification time, 'hash' or 'always'. Defaults to size.")
+
+	flag.BoolVar(&bidirectional, "bidirectional", false, "Mirrors changes made in the destinations back into their sources as well. Only works with local destinations.")
+
+	flag.StringVar(&conflict, "conflict", "", "Decides which side wins when a path changed on both sides in bidirectional mode, either 'newest', 'source' or 'keep-both'. Defaults to newest.")
+
+	flag.DurationVar(&debounce, "debounce", 0, "Waits until a path has been quiet this long before mirroring it, a negative value turns it off. Defaults to 100ms.")
+
 	flag.BoolVar(&color, "c", false, "Short version of -color. Starts mimic with colored output.")
 	flag.BoolVar(&color, "color", false, "Starts mimic with colored output.")
 
 	flag.BoolVar(&dev, "d", false, "Short version of -dev. Starts mimic in dev mode.")
 	flag.BoolVar(&dev, "dev", false, "Starts mimic in dev mode.")
 
+	flag.DurationVar(&drain, "drain-timeout", 10*time.Second, "How long to wait for the events being mirrored to finish when stopping before giving up.")
+
+	flag.BoolVar(&failFast, "fail-fast", false, "Stops mimic on the first error instead of retrying the event, which is useful for CI.")
+
+	flag.Var(&ignores, "i", "Short version of -ignore. Never mirrors paths matching the given gitignore style pattern.")
+	flag.Var(&ignores, "ignore", "Never mirrors paths matching the given gitignore style pattern. Can be given more than once.")
+
+	flag.Var(&includes, "include", "Mirrors paths matching the given pattern even if they are ignored. Can be given more than once.")
+
+	flag.BoolVar(&delta, "delta", false, "Updates large files in local destinations by writing only the parts of them that changed, and checks them against the sources afterwards.")
+
+	flag.BoolVar(&hardLinks, "hardlinks", false, "Keeps files that are hard links to each other in the sources linked in the destinations instead of copying each of them.")
+
+	flag.BoolVar(&inPlace, "inplace", false, "Writes copies straight into the destination files instead of renaming a temporary file over them.")
+
+	flag.StringVar(&preserve, "preserve", "", "Copies the given metadata along with modes, a comma separated list of 'times', 'owner', 'xattrs' and 'acls'. Destinations that can't hold some of it copy without it.")
+
+	flag.StringVar(&progressSize, "progress-size", "", "Logs the progress of copying files of at least the given size, like '100MB' or '2GB'. Nothing is logged by default.")
+
+	flag.BoolVar(&prune, "prune", false, "Removes everything from the destinations that isn't in their sources on startup.")
+	flag.BoolVar(&dryRun, "prune-dry-run", false, "Lists what -prune would remove without removing anything.")
+	flag.Float64Var(&threshold, "prune-threshold", 0, "Aborts pruning if it would remove more than this percentage of a destination. Defaults to 50.")
+
 	flag.BoolVar(&quiet, "q", false, "Short version of -quiet. Starts mimic with quiet output.")
 	flag.BoolVar(&quiet, "quiet", false, "Starts mimic with quiet output.")
 
+	flag.IntVar(&retries, "retries", 0, "Retries events that failed with a transient error this many times before giving up on them, a negative value turns it off. Defaults to 5.")
+
+	flag.StringVar(&stateDir, "state-dir", "", "Keeps the state index of every pair in the given directory instead of in its destination.")
+
+	flag.StringVar(&symlinks, "symlinks", "", "Decides what happens to symlinks in the sources, either 'preserve', 'follow', 'rewrite' or 'skip'. Defaults to preserve.")
+
+	flag.StringVar(&trash, "trash", "", "Moves pruned paths into the given directory instead of removing them.")
+
 	flag.BoolVar(&verbose, "v", false, "Short version of -verbose. Starts mimic with verbose output.")
 	flag.BoolVar(&verbose, "verbose", false, "Starts mimic with verbose output.")
 
-	flag.StringVar(&watch, "w", "", "Short version of -watch. Watches the specified files and copies them to the specified location. Example: mimic -w 'SOURCE:DESTINATION'")
-	flag.StringVar(&watch, "watch", "", "Watches the specified files and copies them to the specified location. Example: mimic -watch 'SOURCE:DESTINATION'")
+	flag.Var(&watch, "w", "Short version of -watch. Watches the specified files and copies them to the specified location. Example: mimic -w 'SOURCE:DESTINATION'")
+	flag.Var(&watch, "watch", "Watches the specified files and copies them to the specified location. Example: mimic -watch 'SOURCE:DESTINATION'")
 
 	flag.Parse()
 
-	src, des := handleFlags()
-	return src, des
+	return handleFlags()
 }
 
-func handleFlags() (string, string) {
+func handleFlags() []filewatcher.Pair {
+	cfg, err := loadConfig()
+	if err != nil {
+		printConfigError(configFile, err)
+		l.Notice.Log("Exiting now...")
+		os.Exit(1)
+	}
+	if cfg != nil {
+		set := flagsSet()
+		if !set["c"] && !set["color"] {
+			color = cfg.Color
+		}
+		if !set["inplace"] {
+			inPlace = cfg.InPlace
+		}
+		if !set["drain-timeout"] && cfg.DrainTimeout != 0 {
+			drain = cfg.DrainTimeout
+		}
+		if controlSocket == "" {
+			controlSocket = cfg.Control
+		}
+	}
+
 	l.ShowColor(color)
 	au = aurora.NewAurora(color)
-	var src, des string
-	if watch != "" {
-		fps := strings.Split(watch, ":")
-		src = fps[0]
-		des = fps[1]
-	} else {
+	pairs, err := buildPairs(cfg)
+	if err != nil {
+		l.Error.Log("%v", err)
+		usage()
+		os.Exit(1)
+	}
+
+	if len(pairs) == 0 {
 		fmt.Printf("\n%v needs to have a source and destination directory supplied via the %v or %v flag. Usage is: %v %v %v%v%v%v%v.\nThe source directory must already exist. %v will automatically create the destination directories and clone any existing files\nfrom the %v directory into the %v directory.\n\n", au.Magenta("Mimic"), au.Cyan("-w"), au.Cyan("-watch"), au.Gray("mimic"), au.Cyan("-w"), au.Gray("'"), au.Red("SOURCE"), au.Gray(":"), au.Green("DESTINATION"), au.Gray("'"), au.Magenta("Mimic"), au.Red("source"), au.Green("destination"))
 		usage()
 		l.Notice.Log("Exiting now...")
 		os.Exit(0)
 	}
 
+	setLogLevel(cfg)
+	return pairs
+}
+
+// flagsSet returns the names of the flags that were given on the command line.
+func flagsSet() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// loadConfig loads the config file, if one was given.
+func loadConfig() (*config.Config, error) {
+	if configFile == "" {
+		return nil, nil
+	}
+	return config.Load(configFile)
+}
+
+// buildPairs returns the pairs from the -w flags, or from the config file if there are none,
+// with the settings given on the command line applied on top.
+func buildPairs(cfg *config.Config) ([]filewatcher.Pair, error) {
+	if threshold < 0 || threshold > 100 {
+		return nil, fmt.Errorf("-prune-threshold has to be a percentage between 0 and 100")
+	}
+	if _, err := filehandler.ParseCompare(compare); err != nil {
+		return nil, err
+	}
+	if _, err := filewatcher.ParseConflict(conflict); err != nil {
+		return nil, err
+	}
+	if _, err := filewatcher.ParseSymlinks(symlinks); err != nil {
+		return nil, err
+	}
+	meta, err := filehandler.ParsePreserve(preserve)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := filehandler.ParseSize(progressSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []filewatcher.Pair
+	if len(watch) != 0 {
+		pairs, err = parseWatch(watch)
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg != nil {
+		pairs = cfg.WatchPairs()
+	}
+
+	set := flagsSet()
+	for i := range pairs {
+		pairs[i].Ignore = append(pairs[i].Ignore, ignores...)
+		pairs[i].Include = append(pairs[i].Include, includes...)
+		if backend != "" {
+			pairs[i].Backend = backend
+		}
+		if set["debounce"] {
+			pairs[i].Debounce = debounce
+		}
+		if compare != "" {
+			pairs[i].Compare = filehandler.Compare(compare)
+		}
+		if inPlace {
+			pairs[i].InPlace = true
+		}
+		if hardLinks {
+			pairs[i].HardLinks = true
+		}
+		if delta {
+			pairs[i].Delta = true
+		}
+		if bidirectional {
+			pairs[i].Bidirectional = true
+		}
+		if conflict != "" {
+			pairs[i].Conflict = filewatcher.ConflictPolicy(conflict)
+		}
+		if symlinks != "" {
+			pairs[i].Symlinks = filewatcher.SymlinkPolicy(symlinks)
+		}
+		if preserve != "" {
+			pairs[i].Preserve = meta
+		}
+		if progressSize != "" {
+			pairs[i].ProgressSize = progress
+		}
+		if stateDir != "" {
+			pairs[i].StateDir = stateDir
+		}
+		if set["retries"] {
+			pairs[i].Retries = retries
+		}
+		if failFast {
+			pairs[i].FailFast = true
+		}
+		if prune || dryRun {
+			pairs[i].Prune.Enabled = true
+		}
+		if dryRun {
+			pairs[i].Prune.DryRun = true
+		}
+		if trash != "" {
+			pairs[i].Prune.Trash = trash
+		}
+		if threshold != 0 {
+			pairs[i].Prune.Threshold = threshold
+		}
+	}
+	return pairs, nil
+}
+
+// setLogLevel sets the log level from the config file, and then from the command line.
+func setLogLevel(cfg *config.Config) {
+	if cfg != nil {
+		switch cfg.LogLevel {
+		case config.LevelQuiet:
+			l.SetLogLevel(logger.ErrorsOnly)
+		case config.LevelNormal:
+			l.SetLogLevel(logger.Normal)
+		case config.LevelVerbose:
+			l.SetLogLevel(logger.Verbose)
+		case config.LevelDev:
+			l.SetLogLevel(logger.All)
+		}
+	}
 	if quiet {
 		l.SetLogLevel(logger.ErrorsOnly)
 	}
@@ -72,25 +321,228 @@ func handleFlags() (string, string) {
 	if dev {
 		l.SetLogLevel(logger.All)
 	}
-	return src, des
+}
+
+// reload reads the config file again and updates the running pairs to match it. The flags
+// given on the command line still override the values in the file.
+func reload(g *filewatcher.Group) (string, error) {
+	l.Notice.Log("Reloading configuration...")
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", fmt.Errorf("error loading '%v', keeping the running configuration: %v", configFile, err)
+	}
+	pairs, err := buildPairs(cfg)
+	if err != nil {
+		return "", err
+	}
+	if len(pairs) == 0 {
+		return "", fmt.Errorf("no pairs to mirror, keeping the running configuration")
+	}
+	setLogLevel(cfg)
+	changes := g.Update(pairs)
+	l.Notice.Log("Configuration reloaded, %v.", changes)
+	return changes.String() + "\n", nil
+}
+
+// status describes every running pair.
+func status(g *filewatcher.Group) (string, error) {
+	var b strings.Builder
+	for _, s := range g.Status() {
+		fmt.Fprintf(&b, "%v", s.Pair)
+		if s.DeadLetters > 0 {
+			fmt.Fprintf(&b, " (%d failed events)", s.DeadLetters)
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// parseWatch turns the values given to -w into source and destination pairs. Each value is
+// either 'SOURCE:DESTINATION' or 'SOURCE:DESTINATION1,DESTINATION2' to fan a single source out
+// into several destinations. A destination is a directory or a URL with a registered scheme.
+func parseWatch(values []string) ([]filewatcher.Pair, error) {
+	var pairs []filewatcher.Pair
+	seen := make(map[string]bool)
+	for _, value := range values {
+		fps := strings.SplitN(value, ":", 2)
+		if len(fps) != 2 || fps[0] == "" || fps[1] == "" {
+			return nil, fmt.Errorf("'%v' is not a valid pair, expected 'SOURCE:DESTINATION'", value)
+		}
+		for _, des := range strings.Split(fps[1], ",") {
+			if des == "" {
+				return nil, fmt.Errorf("'%v' has an empty destination", value)
+			}
+			if _, err := destination.Parse(des); err != nil {
+				return nil, err
+			}
+			p := filewatcher.Pair{Source: fps[0], Destination: des}
+			if seen[p.String()] {
+				continue
+			}
+			seen[p.String()] = true
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs, nil
+}
+
+// configCommand runs the 'mimic config' subcommands and returns the exit status.
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Printf("Usage: mimic config validate [FILE]\n")
+		return 2
+	}
+
+	file := "mimic.yaml"
+	if len(args) > 1 {
+		file = args[1]
+	}
+	if _, err := config.Load(file); err != nil {
+		printConfigError(file, err)
+		return 1
+	}
+	fmt.Printf("'%v' is valid.\n", file)
+	return 0
+}
+
+// ctlCommand sends a command to the control socket of a running mimic and returns the exit
+// status.
+func ctlCommand(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	socket := fs.String("control", "mimic.sock", "The control socket of the running mimic.")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		fmt.Printf("Usage: mimic ctl [-control SOCKET] reload|status\n")
+		return 2
+	}
+	reply, err := control.Send(*socket, fs.Args()...)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Print(reply)
+	return 0
+}
+
+// printConfigError prints every problem in the config file, prefixed with its line number.
+func printConfigError(file string, err error) {
+	errs, ok := err.(config.ErrorList)
+	if !ok {
+		fmt.Printf("%v: %v\n", file, err)
+		return
+	}
+	for _, e := range errs {
+		fmt.Printf("%v:%v: %v\n", file, e.Line, e.Msg)
+	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(ctlCommand(os.Args[2:]))
+	}
+
 	l = logger.New()
-	srcfp, desfp := processFlags()
+	pairs := processFlags()
+	ctx, cancel := context.WithCancel(context.Background())
 	l.Info.Log("Starting filewatcher...")
-	err := filewatcher.WatchFiles(srcfp, desfp, l)
+	g := filewatcher.NewGroup(ctx, logging.New(l))
+	g.Update(pairs)
+	go handleSignals(cancel, g)
+
+	if controlSocket != "" {
+		s, err := control.Listen(controlSocket, map[string]control.Handler{
+			"reload": func(args []string) (string, error) { return reload(g) },
+			"status": func(args []string) (string, error) { return status(g) },
+		})
+		if err != nil {
+			l.Error.Log("Error creating control socket: %v", err)
+			os.Exit(1)
+		}
+		l.Info.Log("Listening for commands on '%v'.", controlSocket)
+		go s.Serve()
+		defer s.Close()
+	}
+
+	err := g.Wait()
 	if err != nil {
-		l.Error.Log("Error starting filewatcher: %v", err)
+		l.Error.Log("Error running filewatcher: %v", err)
+		os.Exit(1)
+	}
+
+}
+
+// handleSignals reloads the configuration on SIGHUP and stops mimic on SIGINT or SIGTERM. If
+// mimic hasn't stopped by the drain timeout, or another SIGINT or SIGTERM arrives, it exits
+// straight away. A SIGHUP while stopping is ignored.
+func handleSignals(cancel context.CancelFunc, g *filewatcher.Group) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	sig := <-sigs
+	for ; sig == syscall.SIGHUP; sig = <-sigs {
+		if _, err := reload(g); err != nil {
+			l.Error.Log("Error reloading configuration: %v", err)
+		}
+	}
+	l.Notice.Log("Received %v, stopping...", sig)
+	cancel()
+
+	if sig := waitDrain(sigs, time.After(drain)); sig != nil {
+		l.Error.Log("Received %v again, exiting now.", sig)
+	} else {
+		l.Error.Log("Timed out after %v waiting for mimic to stop.", drain)
 	}
+	os.Exit(exitDrainTimeout)
+}
 
+// waitDrain waits while mimic stops, until the timeout or a second SIGINT or SIGTERM, which it
+// returns. A SIGHUP while stopping doesn't reload anything, it's ignored.
+func waitDrain(sigs <-chan os.Signal, timeout <-chan time.Time) os.Signal {
+	for {
+		select {
+		case <-timeout:
+			return nil
+		case sig := <-sigs:
+			if sig != syscall.SIGHUP {
+				return sig
+			}
+			l.Notice.Log("Received %v while stopping, ignoring it.", sig)
+		}
+	}
 }
 
 func usage() {
 	fmt.Printf("%v %v%v\n", au.Gray("Usage of"), au.Magenta("mimic"), au.Gray(":"))
+	fmt.Printf("\t%v,%v string\n\t\tWatches the sources with the given backend, either 'inotify' or 'poll'. Defaults to inotify on linux.\n", au.Cyan("-b"), au.Cyan("-backend"))
+	fmt.Printf("\t%v\n\t\tMirrors changes made in the destinations back into their sources as well. Only works with local destinations.\n", au.Cyan("-bidirectional"))
 	fmt.Printf("\t%v,%v\n\t\tStarts mimic with colored output.\n", au.Cyan("-c"), au.Cyan("-color"))
+	fmt.Printf("\t%v string\n\t\tListens for commands like 'reload' and 'status' on a unix socket at the given path, send them with %v.\n", au.Cyan("-control"), au.Gray("mimic ctl"))
+	fmt.Printf("\t%v string\n\t\tDecides which files are copied, either 'size' for size and modification time, 'hash' or 'always'. Defaults to size.\n", au.Cyan("-compare"))
+	fmt.Printf("\t%v string\n\t\tDecides which side wins when a path changed on both sides in bidirectional mode, either 'newest', 'source' or 'keep-both'. Defaults to newest.\n", au.Cyan("-conflict"))
+	fmt.Printf("\t%v duration\n\t\tWaits until a path has been quiet this long before mirroring it, a negative value turns it off. Defaults to 100ms.\n", au.Cyan("-debounce"))
+	fmt.Printf("\t%v string\n\t\tLoads the pairs and settings from a YAML or JSON config file. Flags override the values in the file.\n", au.Cyan("-config"))
 	fmt.Printf("\t%v,%v\n\t\tStarts mimic in dev mode.\n", au.Cyan("-d"), au.Cyan("-dev"))
+	fmt.Printf("\t%v\n\t\tUpdates large files in local destinations by writing only the parts of them that changed, and checks them against the sources afterwards.\n", au.Cyan("-delta"))
+	fmt.Printf("\t%v duration\n\t\tHow long to wait for the events being mirrored to finish when stopping before giving up. Defaults to 10s.\n", au.Cyan("-drain-timeout"))
+	fmt.Printf("\t%v\n\t\tStops mimic on the first error instead of retrying the event, which is useful for CI.\n", au.Cyan("-fail-fast"))
+	fmt.Printf("\t%v\n\t\tKeeps files that are hard links to each other in the sources linked in the destinations instead of copying each of them.\n", au.Cyan("-hardlinks"))
+	fmt.Printf("\t%v,%v string\n\t\tNever mirrors paths matching the given gitignore style pattern. Can be given more than once.\n", au.Cyan("-i"), au.Cyan("-ignore"))
+	fmt.Printf("\t%v string\n\t\tMirrors paths matching the given pattern even if they are ignored. Can be given more than once.\n", au.Cyan("-include"))
+	fmt.Printf("\t%v\n\t\tWrites copies straight into the destination files instead of renaming a temporary file over them.\n", au.Cyan("-inplace"))
+	fmt.Printf("\t%v string\n\t\tCopies the given metadata along with modes, a comma separated list of 'times', 'owner', 'xattrs' and 'acls'. Destinations that can't hold some of it copy without it.\n", au.Cyan("-preserve"))
+	fmt.Printf("\t%v string\n\t\tLogs the progress of copying files of at least the given size, like '100MB' or '2GB'. Nothing is logged by default.\n", au.Cyan("-progress-size"))
+	fmt.Printf("\t%v\n\t\tRemoves everything from the destinations that isn't in their sources on startup.\n", au.Cyan("-prune"))
+	fmt.Printf("\t%v\n\t\tLists what -prune would remove without removing anything.\n", au.Cyan("-prune-dry-run"))
+	fmt.Printf("\t%v float\n\t\tAborts pruning if it would remove more than this percentage of a destination. Defaults to 50.\n", au.Cyan("-prune-threshold"))
 	fmt.Printf("\t%v,%v\n\t\tStarts mimic in quiet output mode.\n", au.Cyan("-q"), au.Cyan("-quiet"))
+	fmt.Printf("\t%v int\n\t\tRetries events that failed with a transient error this many times before giving up on them, a negative value turns it off. Defaults to 5.\n", au.Cyan("-retries"))
+	fmt.Printf("\t%v string\n\t\tKeeps the state index of every pair in the given directory instead of in its destination.\n", au.Cyan("-state-dir"))
+	fmt.Printf("\t%v string\n\t\tDecides what happens to symlinks in the sources, either 'preserve', 'follow', 'rewrite' or 'skip'. Defaults to preserve.\n", au.Cyan("-symlinks"))
+	fmt.Printf("\t%v string\n\t\tMoves pruned paths into the given directory instead of removing them.\n", au.Cyan("-trash"))
 	fmt.Printf("\t%v,%v\n\t\tStarts mimic in verbose output mode.\n", au.Cyan("-v"), au.Cyan("-verbose"))
 	fmt.Printf("\t%v,%v string\n\t\tWatches the specified files and copies them to the specified location. Example: %v %v %v%v%v%v%v\n", au.Cyan("-w"), au.Cyan("-watch"), au.Gray("mimic"), au.Cyan("-w"), au.Gray("'"), au.Red("SOURCE"), au.Gray(":"), au.Green("DESTINATION"), au.Gray("'"))
+	fmt.Printf("\t\tCan be given more than once, and a source can be mirrored into several destinations with %v%v%v%v%v%v%v\n", au.Gray("'"), au.Red("SOURCE"), au.Gray(":"), au.Green("DESTINATION1"), au.Gray(","), au.Green("DESTINATION2"), au.Gray("'"))
+	fmt.Printf("\t\tA destination is a directory or a URL naming its backend, one of %v.\n", strings.Join(destination.Schemes(), ", "))
 }
@@ -6,8 +6,11 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/KaiserGald/logger"
 )
@@ -21,8 +24,82 @@ func TestMain(m *testing.M) {
 func TestHandleFlags(t *testing.T) {
 	expSrc := "testsrc"
 	expDes := "testdes"
-	resSrc, resDes := handleFlags()
-	if (resSrc != expSrc) && (resDes != expDes) {
+	pairs := handleFlags()
+	if len(pairs) != 1 {
+		t.Fatalf("Expected 1 pair got %v", len(pairs))
+	}
+	resSrc, resDes := pairs[0].Source, pairs[0].Destination
+	if (resSrc != expSrc) || (resDes != expDes) {
 		t.Errorf("Strings do not match. Expected ['%v', '%v'] got ['%v', '%v']", expSrc, expDes, resSrc, resDes)
 	}
 }
+
+func TestParseWatch(t *testing.T) {
+	pairs, err := parseWatch([]string{"src:des", "assets:des1,des2", "src:des"})
+	if err != nil {
+		t.Fatalf("Error parsing pairs: %v", err)
+	}
+
+	expected := []string{"src:des", "assets:des1", "assets:des2"}
+	if len(pairs) != len(expected) {
+		t.Fatalf("Expected %v pairs got %v", len(expected), len(pairs))
+	}
+	for i := range expected {
+		if pairs[i].String() != expected[i] {
+			t.Errorf("Pairs do not match. Expected '%v' got '%v'", expected[i], pairs[i])
+		}
+	}
+
+	pairs, err = parseWatch([]string{"src:file:///tmp/des"})
+	if err != nil || pairs[0].Destination != "file:///tmp/des" {
+		t.Errorf("Expected a file URL destination got %v (%v)", pairs, err)
+	}
+
+	for _, bad := range []string{"src", ":des", "src:", "src:des1,", "src:gopher://host/des"} {
+		if _, err := parseWatch([]string{bad}); err == nil {
+			t.Errorf("Expected an error parsing '%v'", bad)
+		}
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	file := "testconfig.yaml"
+	ioutil.WriteFile(file, []byte("pairs:\n  - source: testsrc\n    destination: testdes\n"), 0644)
+	if status := configCommand([]string{"validate", file}); status != 0 {
+		t.Errorf("Expected '%v' to be valid, got status %v", file, status)
+	}
+
+	ioutil.WriteFile(file, []byte("pairs:\n  - source: testsrc\n"), 0644)
+	if status := configCommand([]string{"validate", file}); status != 1 {
+		t.Errorf("Expected '%v' to be invalid, got status %v", file, status)
+	}
+
+	if status := configCommand(nil); status != 2 {
+		t.Errorf("Expected a usage error, got status %v", status)
+	}
+	os.Remove(file)
+}
+
+func TestCtlCommand(t *testing.T) {
+	if status := ctlCommand(nil); status != 2 {
+		t.Errorf("Expected exit status 2 without a command got %v", status)
+	}
+	if status := ctlCommand([]string{"-control", "missing.sock", "status"}); status != 1 {
+		t.Errorf("Expected exit status 1 without a running mimic got %v", status)
+	}
+}
+
+func TestWaitDrain(t *testing.T) {
+	sigs := make(chan os.Signal, 2)
+	sigs <- syscall.SIGHUP
+	sigs <- syscall.SIGTERM
+	if sig := waitDrain(sigs, nil); sig != syscall.SIGTERM {
+		t.Errorf("Expected a reload while stopping to be ignored got %v", sig)
+	}
+
+	timeout := make(chan time.Time, 1)
+	timeout <- time.Now()
+	if sig := waitDrain(make(chan os.Signal), timeout); sig != nil {
+		t.Errorf("Expected the drain to time out got %v", sig)
+	}
+}
@@ -0,0 +1,221 @@
+// Package state
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KaiserGald/mimic/vfs"
+)
+
+// FileName is the name of the state file kept in the destination when no state directory is
+// given.
+const FileName = ".mimic-state.json"
+
+// version is bumped whenever the layout of the state file changes, older files are ignored.
+const version = 1
+
+// Entry is what mimic knew about a source path the last time it was mirrored.
+type Entry struct {
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mtime"`
+	Hash    string      `json:"hash,omitempty"`
+	Mode    os.FileMode `json:"mode"`
+	Synced  time.Time   `json:"synced"`
+}
+
+// NewEntry creates an entry for the file as it is now.
+func NewEntry(info os.FileInfo, hash string) Entry {
+	return Entry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hash,
+		Mode:    info.Mode(),
+		Synced:  time.Now(),
+	}
+}
+
+// IsDir checks if the entry is a directory.
+func (e Entry) IsDir() bool {
+	return e.Mode.IsDir()
+}
+
+// Matches checks if the file is still the same as when the entry was made.
+func (e Entry) Matches(info os.FileInfo) bool {
+	if e.IsDir() || info.IsDir() {
+		return e.IsDir() == info.IsDir()
+	}
+	return e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) && e.Mode == info.Mode()
+}
+
+// file is the layout of the state file on disk.
+type file struct {
+	Version int              `json:"version"`
+	Entries map[string]Entry `json:"entries"`
+}
+
+// DB is the state index of a single pair, keyed by paths relative to the source. A nil DB
+// keeps no state, so every method is safe to call on it.
+type DB struct {
+	path string
+	fs   vfs.FS
+
+	mu      sync.Mutex
+	entries map[string]Entry
+	dirty   bool
+}
+
+// Open loads the state file at the path, a file that doesn't exist yet is an empty index.
+func Open(path string) (*DB, error) {
+	return OpenFS(vfs.OS, path)
+}
+
+// OpenFS loads the state file at the path in the file system, the index is saved to it as well.
+func OpenFS(fsys vfs.FS, path string) (*DB, error) {
+	db := &DB{path: path, fs: fsys, entries: make(map[string]Entry)}
+	b, err := vfs.ReadFile(fsys, path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("reading state file '%v': %v", path, err)
+	}
+	if f.Version != version {
+		// an old layout just means a full sync, not an error
+		return db, nil
+	}
+	if f.Entries != nil {
+		db.entries = f.Entries
+	}
+	return db, nil
+}
+
+// Path returns the path of the state file.
+func (db *DB) Path() string {
+	if db == nil {
+		return ""
+	}
+	return db.path
+}
+
+// Get returns the entry of the path.
+func (db *DB) Get(rel string) (Entry, bool) {
+	if db == nil {
+		return Entry{}, false
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	e, ok := db.entries[rel]
+	return e, ok
+}
+
+// Put sets the entry of the path.
+func (db *DB) Put(rel string, e Entry) {
+	if db == nil {
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.entries[rel] = e
+	db.dirty = true
+}
+
+// Remove forgets the path and everything under it.
+func (db *DB) Remove(rel string) {
+	if db == nil {
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for path := range db.entries {
+		if path == rel || strings.HasPrefix(path, rel+"/") {
+			delete(db.entries, path)
+			db.dirty = true
+		}
+	}
+}
+
+// Rename moves the entries of the path and everything under it to the new path.
+func (db *DB) Rename(old, new string) {
+	if db == nil {
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for path, e := range db.entries {
+		if path == old || strings.HasPrefix(path, old+"/") {
+			delete(db.entries, path)
+			db.entries[new+strings.TrimPrefix(path, old)] = e
+			db.dirty = true
+		}
+	}
+}
+
+// Paths returns every path in the index, sorted.
+func (db *DB) Paths() []string {
+	if db == nil {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	paths := make([]string, 0, len(db.entries))
+	for path := range db.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Save writes the index to disk if it changed since it was last saved. The file is written to
+// a temporary file first and renamed into place, so a crash never leaves half a state file.
+func (db *DB) Save() error {
+	if db == nil {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !db.dirty {
+		return nil
+	}
+
+	b, err := json.Marshal(file{Version: version, Entries: db.entries})
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(db.path)
+	if err := vfs.MkdirAll(db.fs, dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := vfs.TempFile(db.fs, dir, "."+filepath.Base(db.path)+".")
+	if err != nil {
+		return err
+	}
+	defer db.fs.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := db.fs.Rename(tmp.Name(), db.path); err != nil {
+		return err
+	}
+	db.dirty = false
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package state
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaveAndOpen(t *testing.T) {
+	os.MkdirAll("testdir", 0777)
+	defer os.RemoveAll("testdir")
+	ioutil.WriteFile("testdir/file.txt", []byte("Some content"), 0644)
+	info, _ := os.Stat("testdir/file.txt")
+
+	db, err := Open("testdir/state/" + FileName)
+	if err != nil {
+		t.Fatalf("Error opening a new state file: %v", err)
+	}
+	db.Put("file.txt", NewEntry(info, "abc"))
+	db.Put("dir", Entry{Mode: os.ModeDir | 0755})
+	if err := db.Save(); err != nil {
+		t.Fatalf("Error saving state: %v", err)
+	}
+
+	db, err = Open("testdir/state/" + FileName)
+	if err != nil {
+		t.Fatalf("Error opening state: %v", err)
+	}
+	e, ok := db.Get("file.txt")
+	if !ok {
+		t.Fatalf("Expected 'file.txt' to be in the state.")
+	}
+	if !e.Matches(info) || e.Hash != "abc" {
+		t.Errorf("Expected the entry to match the file, got %+v", e)
+	}
+	if e, _ := db.Get("dir"); !e.IsDir() {
+		t.Errorf("Expected 'dir' to be a directory.")
+	}
+
+	later := time.Now().Add(time.Hour)
+	os.Chtimes("testdir/file.txt", later, later)
+	info, _ = os.Stat("testdir/file.txt")
+	if e.Matches(info) {
+		t.Errorf("Didn't expect the entry to match a touched file.")
+	}
+}
+
+func TestRemoveAndRename(t *testing.T) {
+	db := &DB{entries: make(map[string]Entry)}
+	for _, path := range []string{"a", "a/b", "a/b/c.txt", "ab.txt", "d.txt"} {
+		db.Put(path, Entry{})
+	}
+
+	db.Rename("a", "x")
+	expected := []string{"ab.txt", "d.txt", "x", "x/b", "x/b/c.txt"}
+	if actual := db.Paths(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v after renaming got %v", expected, actual)
+	}
+
+	db.Remove("x/b")
+	expected = []string{"ab.txt", "d.txt", "x"}
+	if actual := db.Paths(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v after removing got %v", expected, actual)
+	}
+}
+
+func TestNilDB(t *testing.T) {
+	var db *DB
+	db.Put("file.txt", Entry{})
+	if _, ok := db.Get("file.txt"); ok {
+		t.Errorf("Didn't expect a nil state to keep anything.")
+	}
+	if err := db.Save(); err != nil {
+		t.Errorf("Didn't expect an error saving a nil state: %v", err)
+	}
+}
+
+func TestOpenOldVersion(t *testing.T) {
+	os.MkdirAll("testdir", 0777)
+	defer os.RemoveAll("testdir")
+	ioutil.WriteFile("testdir/old.json", []byte(`{"version": 0, "entries": {"file.txt": {}}}`), 0644)
+
+	db, err := Open("testdir/old.json")
+	if err != nil {
+		t.Fatalf("Error opening an old state file: %v", err)
+	}
+	if len(db.Paths()) != 0 {
+		t.Errorf("Expected an old state file to be ignored.")
+	}
+}
@@ -0,0 +1,607 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	errNotDir   = syscall.ENOTDIR
+	errIsDir    = syscall.EISDIR
+	errNotEmpty = syscall.ENOTEMPTY
+	errLoop     = syscall.ELOOP
+	errBadFile  = syscall.EBADF
+	errNoAttr   = syscall.ENODATA
+)
+
+// Mem is a file system that only lives in memory, for tests and dry runs. Relative paths are
+// relative to its root. It's safe to use from several goroutines.
+type Mem struct {
+	mu    sync.Mutex
+	nodes map[string]*node
+	// inodes counts the nodes ever made, to number them.
+	inodes uint64
+}
+
+// node is a file, directory or symlink in a Mem.
+type node struct {
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+	target  string
+	ino     uint64
+	links   uint64 // hard links to the node besides the first
+	uid     int
+	gid     int
+	xattrs  map[string][]byte
+}
+
+// NewMem returns an empty Mem with only a root directory.
+func NewMem() *Mem {
+	root := string(filepath.Separator)
+	return &Mem{nodes: map[string]*node{root: {mode: os.ModeDir | 0755, modTime: time.Now(), ino: 1}}, inodes: 1}
+}
+
+// inode returns the number of a new node.
+func (m *Mem) inode() uint64 {
+	m.inodes++
+	return m.inodes
+}
+
+// Abs returns the path relative to the root of the Mem.
+func (m *Mem) Abs(name string) (string, error) {
+	return m.clean(name), nil
+}
+
+func (m *Mem) clean(name string) string {
+	return filepath.Join(string(filepath.Separator), name)
+}
+
+// resolve follows the symlinks in the path, and in its last element when follow is set, and
+// returns the key of the node it ends up at.
+func (m *Mem) resolve(name string, follow bool) (string, error) {
+	rest := strings.Split(m.clean(name), string(filepath.Separator))
+	resolved := string(filepath.Separator)
+	links := 0
+	for len(rest) > 0 {
+		part := rest[0]
+		rest = rest[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		n, ok := m.nodes[next]
+		if !ok || n.mode&os.ModeSymlink == 0 || len(rest) == 0 && !follow {
+			if ok && len(rest) > 0 && !n.mode.IsDir() && n.mode&os.ModeSymlink == 0 {
+				return "", errNotDir
+			}
+			if !ok && len(rest) > 0 {
+				return "", os.ErrNotExist
+			}
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxLinks {
+			return "", errLoop
+		}
+		if filepath.IsAbs(n.target) {
+			resolved = string(filepath.Separator)
+		}
+		rest = append(strings.Split(n.target, string(filepath.Separator)), rest...)
+	}
+	return resolved, nil
+}
+
+// lookup returns the node at the path, following symlinks when follow is set.
+func (m *Mem) lookup(op, name string, follow bool) (string, *node, error) {
+	key, err := m.resolve(name, follow)
+	if err != nil {
+		return "", nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	n, ok := m.nodes[key]
+	if !ok {
+		return key, nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return key, n, nil
+}
+
+// parent checks the directory a new node at the path would go in, and returns the node's key.
+func (m *Mem) parent(op, name string) (string, error) {
+	key, err := m.resolve(name, false)
+	if err != nil {
+		return "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	dir, ok := m.nodes[filepath.Dir(key)]
+	if !ok {
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	if !dir.mode.IsDir() {
+		return "", &os.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return key, nil
+}
+
+// children returns the keys of everything under the directory, sorted.
+func (m *Mem) children(key string) []string {
+	prefix := key + string(filepath.Separator)
+	if key == string(filepath.Separator) {
+		prefix = key
+	}
+	var keys []string
+	for k := range m.nodes {
+		if k != key && strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *Mem) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *Mem) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *Mem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, n, err := m.lookup("open", name, true)
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case err == nil && n.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	case os.IsNotExist(err) && flag&os.O_CREATE != 0:
+		// a dangling symlink creates its target
+		if key == "" {
+			key = name
+		}
+		if key, err = m.parent("open", key); err != nil {
+			return nil, err
+		}
+		n = &node{mode: perm & os.ModePerm, modTime: time.Now(), ino: m.inode()}
+		m.nodes[key] = n
+	case err != nil:
+		return nil, err
+	}
+	if flag&os.O_TRUNC != 0 && !n.mode.IsDir() {
+		n.data = nil
+		n.modTime = time.Now()
+	}
+	return &memFile{fs: m, name: name, node: n, flag: flag}, nil
+}
+
+func (m *Mem) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, err := m.parent("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.nodes[key]; ok {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	m.nodes[key] = &node{mode: os.ModeDir | perm&os.ModePerm, modTime: time.Now(), ino: m.inode()}
+	return nil
+}
+
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, n, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if n.mode.IsDir() && len(m.children(key)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	m.unlink(key)
+	return nil
+}
+
+// unlink removes the node's key, and the node with it if it was its last link.
+func (m *Mem) unlink(key string) {
+	if n := m.nodes[key]; n.links > 0 {
+		n.links--
+	}
+	delete(m.nodes, key)
+}
+
+func (m *Mem) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("link", oldname, false)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: unwrap(err)}
+	}
+	if n.mode.IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	key, err := m.parent("link", newname)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: unwrap(err)}
+	}
+	if _, ok := m.nodes[key]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	n.links++
+	m.nodes[key] = n
+	return nil
+}
+
+func (m *Mem) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldkey, n, err := m.lookup("rename", oldname, false)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: unwrap(err)}
+	}
+	newkey, err := m.parent("rename", newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: unwrap(err)}
+	}
+	if oldkey == newkey {
+		return nil
+	}
+	if strings.HasPrefix(newkey, oldkey+string(filepath.Separator)) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrInvalid}
+	}
+	if existing, ok := m.nodes[newkey]; ok {
+		switch {
+		case existing == n:
+			// both are links to the same file, which leaves nothing to do
+			return nil
+		case existing.mode.IsDir() && !n.mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errIsDir}
+		case !existing.mode.IsDir() && n.mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errNotDir}
+		case existing.mode.IsDir() && len(m.children(newkey)) > 0:
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errNotEmpty}
+		}
+	}
+
+	if _, ok := m.nodes[newkey]; ok {
+		m.unlink(newkey)
+	}
+	for _, child := range m.children(oldkey) {
+		m.nodes[newkey+strings.TrimPrefix(child, oldkey)] = m.nodes[child]
+		delete(m.nodes, child)
+	}
+	m.nodes[newkey] = n
+	delete(m.nodes, oldkey)
+	return nil
+}
+
+func (m *Mem) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	n.mode = n.mode&os.ModeType | mode&os.ModePerm
+	return nil
+}
+
+func (m *Mem) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	n.modTime = mtime
+	return nil
+}
+
+func (m *Mem) Stat(name string) (os.FileInfo, error) {
+	return m.stat("stat", name, true)
+}
+
+func (m *Mem) Lstat(name string) (os.FileInfo, error) {
+	return m.stat("lstat", name, false)
+}
+
+func (m *Mem) stat(op, name string, follow bool) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, n, err := m.lookup(op, name, follow)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(filepath.Base(key)), nil
+}
+
+func (m *Mem) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, err := m.parent("symlink", newname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: unwrap(err)}
+	}
+	if _, ok := m.nodes[key]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	m.nodes[key] = &node{mode: os.ModeSymlink | 0777, modTime: time.Now(), target: oldname, ino: m.inode()}
+	return nil
+}
+
+func (m *Mem) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrInvalid}
+	}
+	return n.target, nil
+}
+
+func (m *Mem) Lchown(name string, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("lchown", name, false)
+	if err != nil {
+		return err
+	}
+	n.uid, n.gid = uid, gid
+	return nil
+}
+
+func (m *Mem) Listxattr(name string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("listxattr", name, true)
+	if err != nil {
+		return nil, err
+	}
+	var attrs []string
+	for attr := range n.xattrs {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	return attrs, nil
+}
+
+func (m *Mem) Getxattr(name, attr string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("getxattr", name, true)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := n.xattrs[attr]
+	if !ok {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: errNoAttr}
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m *Mem) Setxattr(name, attr string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("setxattr", name, true)
+	if err != nil {
+		return err
+	}
+	if n.xattrs == nil {
+		n.xattrs = make(map[string][]byte)
+	}
+	n.xattrs[attr] = append([]byte{}, value...)
+	return nil
+}
+
+func (m *Mem) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, n, err := m.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	var infos []os.FileInfo
+	for _, child := range m.children(key) {
+		if filepath.Dir(child) == key {
+			infos = append(infos, m.nodes[child].info(filepath.Base(child)))
+		}
+	}
+	return infos, nil
+}
+
+// unwrap returns the error inside a path error.
+func unwrap(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+func (n *node) info(name string) os.FileInfo {
+	size := int64(len(n.data))
+	if n.mode&os.ModeSymlink != 0 {
+		size = int64(len(n.target))
+	}
+	return memInfo{name: name, size: size, mode: n.mode, modTime: n.modTime, uid: n.uid, gid: n.gid, ino: n.ino, nlink: n.links + 1}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	uid     int
+	gid     int
+	ino     uint64
+	nlink   uint64
+}
+
+func (mi memInfo) Name() string       { return mi.name }
+func (mi memInfo) Size() int64        { return mi.size }
+func (mi memInfo) Mode() os.FileMode  { return mi.mode }
+func (mi memInfo) ModTime() time.Time { return mi.modTime }
+func (mi memInfo) IsDir() bool        { return mi.mode.IsDir() }
+func (mi memInfo) Sys() interface{}   { return nil }
+func (mi memInfo) Owner() (int, int)  { return mi.uid, mi.gid }
+
+// Links returns the number of the node and how many hard links it has, like Links wants.
+func (mi memInfo) Links() (FileID, uint64) {
+	return FileID{Ino: mi.ino}, mi.nlink
+}
+
+// memFile is an open file in a Mem.
+type memFile struct {
+	fs     *Mem
+	name   string
+	node   *node
+	flag   int
+	off    int64
+	closed bool
+}
+
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) check(op string, write bool) error {
+	switch {
+	case f.closed:
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	case f.node.mode.IsDir():
+		return &os.PathError{Op: op, Path: f.name, Err: errIsDir}
+	case write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0, !write && f.flag&os.O_WRONLY != 0:
+		return &os.PathError{Op: op, Path: f.name, Err: errBadFile}
+	}
+	return nil
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.node.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.node.data))
+	}
+	if end := f.off + int64(len(b)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.off:], b)
+	f.off += int64(len(b))
+	f.node.modTime = time.Now()
+	return len(b), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: os.ErrInvalid}
+	}
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size]
+	} else {
+		f.node.data = append(f.node.data, make([]byte, size-int64(len(f.node.data)))...)
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
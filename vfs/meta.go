@@ -0,0 +1,109 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package vfs
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrUnsupported is returned for metadata the file system can't hold.
+var ErrUnsupported = errors.New("not supported by the file system")
+
+// Owner returns the ids of the user and group that own the file the info is of, ok is false when
+// the file system doesn't record them. Infos with their own idea of it implement
+// Owner() (uid, gid int).
+func Owner(info os.FileInfo) (uid, gid int, ok bool) {
+	if o, ok := info.(interface {
+		Owner() (uid, gid int)
+	}); ok {
+		uid, gid = o.Owner()
+		return uid, gid, true
+	}
+	return sysOwner(info)
+}
+
+// FileID identifies a file, whichever of its hard links it's reached by.
+type FileID struct {
+	Dev uint64
+	Ino uint64
+}
+
+// Links returns the identity of the file the info is of and how many hard links it has, ok is
+// false when the file system doesn't tell. Infos with their own idea of it implement
+// Links() (FileID, uint64).
+func Links(info os.FileInfo) (id FileID, nlink uint64, ok bool) {
+	if l, ok := info.(interface {
+		Links() (FileID, uint64)
+	}); ok {
+		id, nlink = l.Links()
+		return id, nlink, true
+	}
+	return sysLinks(info)
+}
+
+// Link makes newname a hard link to oldname, for file systems that implement
+// Link(oldname, newname string) error.
+func Link(fsys FS, oldname, newname string) error {
+	if l, ok := fsys.(interface {
+		Link(oldname, newname string) error
+	}); ok {
+		return l.Link(oldname, newname)
+	}
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrUnsupported}
+}
+
+// Lchown changes the owner of the path without following a symlink, for file systems that
+// implement Lchown(name string, uid, gid int) error.
+func Lchown(fsys FS, name string, uid, gid int) error {
+	if c, ok := fsys.(interface {
+		Lchown(name string, uid, gid int) error
+	}); ok {
+		return c.Lchown(name, uid, gid)
+	}
+	return &os.PathError{Op: "lchown", Path: name, Err: ErrUnsupported}
+}
+
+// xattrFS is a file system that can hold extended attributes, which is also where POSIX ACLs
+// are kept.
+type xattrFS interface {
+	Listxattr(name string) ([]string, error)
+	Getxattr(name, attr string) ([]byte, error)
+	Setxattr(name, attr string, value []byte) error
+}
+
+// Listxattr returns the names of the extended attributes of the path.
+func Listxattr(fsys FS, name string) ([]string, error) {
+	if x, ok := fsys.(xattrFS); ok {
+		return x.Listxattr(name)
+	}
+	return nil, &os.PathError{Op: "listxattr", Path: name, Err: ErrUnsupported}
+}
+
+// Getxattr returns the value of the extended attribute of the path.
+func Getxattr(fsys FS, name, attr string) ([]byte, error) {
+	if x, ok := fsys.(xattrFS); ok {
+		return x.Getxattr(name, attr)
+	}
+	return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrUnsupported}
+}
+
+// Setxattr sets the extended attribute of the path, creating it if it doesn't exist.
+func Setxattr(fsys FS, name, attr string, value []byte) error {
+	if x, ok := fsys.(xattrFS); ok {
+		return x.Setxattr(name, attr, value)
+	}
+	return &os.PathError{Op: "setxattr", Path: name, Err: ErrUnsupported}
+}
+
+// IsUnsupported checks if the error means the file system can't hold the metadata, either
+// because it doesn't implement it or because the file system underneath it refused.
+func IsUnsupported(err error) bool {
+	return errors.Is(err, ErrUnsupported) || sysUnsupported(err)
+}
+
+func (osFS) Lchown(name string, uid, gid int) error { return os.Lchown(name, uid, gid) }
+func (osFS) Link(oldname, newname string) error     { return os.Link(oldname, newname) }
@@ -0,0 +1,74 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+//go:build linux
+// +build linux
+
+package vfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// sysOwner returns the owner recorded in the info from the OS.
+func sysOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Uid), int(st.Gid), true
+	}
+	return 0, 0, false
+}
+
+// sysLinks returns the identity and hard links recorded in the info from the OS.
+func sysLinks(info os.FileInfo) (id FileID, nlink uint64, ok bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return FileID{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}, uint64(st.Nlink), true
+	}
+	return FileID{}, 0, false
+}
+
+// sysUnsupported checks if the OS refused because the file system can't hold the metadata.
+func sysUnsupported(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP)
+}
+
+func (osFS) Listxattr(name string) ([]string, error) {
+	size, err := syscall.Listxattr(name, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	// attributes can be added in between, the second call fails with ERANGE then
+	if size, err = syscall.Listxattr(name, buf); err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	return strings.FieldsFunc(string(buf[:size]), func(r rune) bool { return r == 0 }), nil
+}
+
+func (osFS) Getxattr(name, attr string) ([]byte, error) {
+	size, err := syscall.Getxattr(name, attr, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	buf := make([]byte, size)
+	if size > 0 {
+		if size, err = syscall.Getxattr(name, attr, buf); err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: name, Err: err}
+		}
+	}
+	return buf[:size], nil
+}
+
+func (osFS) Setxattr(name, attr string, value []byte) error {
+	if err := syscall.Setxattr(name, attr, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+//go:build !linux
+// +build !linux
+
+package vfs
+
+import "os"
+
+// sysOwner only knows where the OS keeps the owner on linux.
+func sysOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// sysLinks only knows where the OS keeps hard links on linux.
+func sysLinks(info os.FileInfo) (id FileID, nlink uint64, ok bool) {
+	return FileID{}, 0, false
+}
+
+// sysUnsupported only knows the errors of the OS on linux, elsewhere the OS has no extended
+// attributes to refuse.
+func sysUnsupported(err error) bool {
+	return false
+}
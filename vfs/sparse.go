@@ -0,0 +1,41 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package vfs
+
+import "os"
+
+// Extent is a range of a file that holds data, the rest of a sparse file is holes that read as
+// zeros without taking up any space.
+type Extent struct {
+	Off int64
+	Len int64
+}
+
+// Extents returns the ranges of the first size bytes of the file that hold data, in order. Files
+// the OS can't find the holes in, and files that aren't from the OS, are a single range.
+func Extents(f File, size int64) []Extent {
+	if osf, ok := f.(*os.File); ok {
+		if extents, ok := sysExtents(osf, size); ok {
+			return extents
+		}
+	}
+	if size <= 0 {
+		return nil
+	}
+	return []Extent{{Off: 0, Len: size}}
+}
+
+// Clone makes dst share the data of src, which is as good as a copy on file systems that copy it
+// once either of them is written to, without copying anything yet. It fails for files that
+// aren't from the OS, and on file systems that can't.
+func Clone(dst, src File) error {
+	d, ok1 := dst.(*os.File)
+	s, ok2 := src.(*os.File)
+	if !ok1 || !ok2 {
+		return &os.LinkError{Op: "clone", Old: src.Name(), New: dst.Name(), Err: ErrUnsupported}
+	}
+	return sysClone(d, s)
+}
@@ -0,0 +1,69 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+//go:build linux
+// +build linux
+
+package vfs
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// seekData and seekHole are the whences that move to the next data or hole in a file.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// sysExtents finds the data in the file with SEEK_DATA and SEEK_HOLE, ok is false when the file
+// system doesn't support them.
+func sysExtents(f *os.File, size int64) (extents []Extent, ok bool) {
+	for off := int64(0); off < size; {
+		data, err := f.Seek(off, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// there's no more data, the rest is a hole
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		if data >= size {
+			break
+		}
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return nil, false
+		}
+		if hole > size {
+			hole = size
+		}
+		extents = append(extents, Extent{Off: data, Len: hole - data})
+		off = hole
+	}
+	return extents, true
+}
+
+// ficlone returns the FICLONE ioctl, _IOW(0x94, 9, int), which is encoded differently on a few
+// architectures.
+func ficlone() uintptr {
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le", "ppc", "ppc64", "ppc64le", "sparc64":
+		return 0x80049409
+	}
+	return 0x40049409
+}
+
+// sysClone reflinks the files with FICLONE, which file systems like btrfs and XFS support.
+func sysClone(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone(), src.Fd())
+	if errno != 0 {
+		return &os.LinkError{Op: "clone", Old: src.Name(), New: dst.Name(), Err: errno}
+	}
+	return nil
+}
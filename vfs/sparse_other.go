@@ -0,0 +1,21 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+//go:build !linux
+// +build !linux
+
+package vfs
+
+import "os"
+
+// sysExtents only finds holes on linux.
+func sysExtents(f *os.File, size int64) (extents []Extent, ok bool) {
+	return nil, false
+}
+
+// sysClone only clones files on linux.
+func sysClone(dst, src *os.File) error {
+	return &os.LinkError{Op: "clone", Old: src.Name(), New: dst.Name(), Err: ErrUnsupported}
+}
@@ -0,0 +1,310 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxLinks is how many symlinks EvalSymlinks follows before giving up on a loop.
+const maxLinks = 255
+
+// File is an open file in a FS. *os.File is a File.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FS is a file system mimic reads from and writes to. Paths use the separators of the platform,
+// and errors can be checked with os.IsNotExist and os.IsExist like the ones from the os package.
+type FS interface {
+	Open(name string) (File, error)
+	Create(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Mkdir(name string, perm os.FileMode) error
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	// ReadDir returns the entries of the directory sorted by name.
+	ReadDir(name string) ([]os.FileInfo, error)
+}
+
+// OS is the local file system.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (File, error) {
+	return osFile(os.Open(name))
+}
+
+func (osFS) Create(name string) (File, error) {
+	return osFile(os.Create(name))
+}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return osFile(os.OpenFile(name, flag, perm))
+}
+
+// osFile keeps a nil *os.File from turning into a File that isn't nil.
+func osFile(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Mkdir(name string, perm os.FileMode) error         { return os.Mkdir(name, perm) }
+func (osFS) Remove(name string) error                          { return os.Remove(name) }
+func (osFS) Rename(oldname, newname string) error              { return os.Rename(oldname, newname) }
+func (osFS) Chmod(name string, mode os.FileMode) error         { return os.Chmod(name, mode) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error { return os.Chtimes(name, atime, mtime) }
+func (osFS) Stat(name string) (os.FileInfo, error)             { return os.Stat(name) }
+func (osFS) Lstat(name string) (os.FileInfo, error)            { return os.Lstat(name) }
+func (osFS) Symlink(oldname, newname string) error             { return os.Symlink(oldname, newname) }
+func (osFS) Readlink(name string) (string, error)              { return os.Readlink(name) }
+
+func (osFS) ReadDir(name string) ([]os.FileInfo, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// Walk walks the tree at root like filepath.Walk, without following symlinks.
+func Walk(fsys FS, root string, fn filepath.WalkFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walk(fsys, root, info, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walk(fsys FS, path string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	infos, err := fsys.ReadDir(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	for _, child := range infos {
+		err = walk(fsys, filepath.Join(path, child.Name()), child, fn)
+		if err != nil {
+			if !child.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MkdirAll creates the directory along with any parents that don't exist yet.
+func MkdirAll(fsys FS, path string, perm os.FileMode) error {
+	if info, err := fsys.Stat(path); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: path, Err: errNotDir}
+	}
+	if parent := filepath.Dir(path); parent != path {
+		if err := MkdirAll(fsys, parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := fsys.Mkdir(path, perm); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveAll removes the path and everything in it. A path that doesn't exist isn't an error.
+func RemoveAll(fsys FS, path string) error {
+	info, err := fsys.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		infos, err := fsys.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, child := range infos {
+			if err := RemoveAll(fsys, filepath.Join(path, child.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	if err := fsys.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ReadFile returns the contents of the file.
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// WriteFile writes the data to the file, creating it with the given mode if it doesn't exist.
+func WriteFile(fsys FS, name string, data []byte, perm os.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var tempSeq uint32
+
+// TempFile creates a new file in the directory, named by the prefix followed by a random
+// number, and opens it for reading and writing.
+func TempFile(fsys FS, dir, prefix string) (File, error) {
+	seed := uint32(time.Now().UnixNano()) + uint32(os.Getpid())
+	for i := 0; i < 10000; i++ {
+		n := seed + atomic.AddUint32(&tempSeq, 1)*7919
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(n), 10))
+		f, err := fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+	return nil, &os.PathError{Op: "createtemp", Path: filepath.Join(dir, prefix+"*"), Err: os.ErrExist}
+}
+
+// TempSymlink creates a symlink to target in the directory, named like TempFile names its files,
+// and returns its path.
+func TempSymlink(fsys FS, target, dir, prefix string) (string, error) {
+	return tempPath("symlink", dir, prefix, func(name string) error { return fsys.Symlink(target, name) })
+}
+
+// TempLink creates a hard link to oldname in the directory, named like TempFile names its files,
+// and returns its path.
+func TempLink(fsys FS, oldname, dir, prefix string) (string, error) {
+	return tempPath("link", dir, prefix, func(name string) error { return Link(fsys, oldname, name) })
+}
+
+// tempPath calls create with new names in the directory until one doesn't exist yet.
+func tempPath(op, dir, prefix string, create func(name string) error) (string, error) {
+	seed := uint32(time.Now().UnixNano()) + uint32(os.Getpid())
+	for i := 0; i < 10000; i++ {
+		n := seed + atomic.AddUint32(&tempSeq, 1)*7919
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(n), 10))
+		err := create(name)
+		if os.IsExist(err) {
+			continue
+		}
+		return name, err
+	}
+	return "", &os.PathError{Op: op, Path: filepath.Join(dir, prefix+"*"), Err: os.ErrExist}
+}
+
+// Abs returns the absolute form of the path in the file system. Relative paths are relative to
+// the working directory for the OS, file systems with their own idea of it implement
+// Abs(path string) (string, error).
+func Abs(fsys FS, path string) (string, error) {
+	if a, ok := fsys.(interface {
+		Abs(path string) (string, error)
+	}); ok {
+		return a.Abs(path)
+	}
+	return filepath.Abs(path)
+}
+
+// EvalSymlinks returns the absolute path with every symlink in it resolved, like
+// filepath.EvalSymlinks.
+func EvalSymlinks(fsys FS, path string) (string, error) {
+	abs, err := Abs(fsys, path)
+	if err != nil {
+		return "", err
+	}
+
+	resolved := string(filepath.Separator)
+	rest := strings.Split(abs, string(filepath.Separator))
+	links := 0
+	for len(rest) > 0 {
+		part := rest[0]
+		rest = rest[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		info, err := fsys.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxLinks {
+			return "", &os.PathError{Op: "evalsymlinks", Path: path, Err: errors.New("too many links")}
+		}
+		target, err := fsys.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = string(filepath.Separator)
+		}
+		rest = append(strings.Split(target, string(filepath.Separator)), rest...)
+	}
+	return resolved, nil
+}
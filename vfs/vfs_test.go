@@ -0,0 +1,322 @@
+// Package vfs
+// 18 October 2026
+// Code is licensed under the MIT License
+// © 2026 Scott Isenberg
+
+package vfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forEachFS runs the test against the OS, in a temporary directory, and against a Mem.
+func forEachFS(t *testing.T, test func(t *testing.T, fsys FS, root string)) {
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("os", func(t *testing.T) { test(t, OS, dir) })
+	t.Run("mem", func(t *testing.T) {
+		mem := NewMem()
+		if err := MkdirAll(mem, "/tmp/vfs", 0755); err != nil {
+			t.Fatalf("Error creating root: %v", err)
+		}
+		test(t, mem, "/tmp/vfs")
+	})
+}
+
+func TestFiles(t *testing.T) {
+	forEachFS(t, func(t *testing.T, fsys FS, root string) {
+		name := filepath.Join(root, "test.txt")
+		if err := WriteFile(fsys, name, []byte("hello world"), 0640); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+		if b, err := ReadFile(fsys, name); err != nil || string(b) != "hello world" {
+			t.Errorf("Expected 'hello world' got '%s' (%v)", b, err)
+		}
+
+		f, err := fsys.OpenFile(name, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("Error opening file: %v", err)
+		}
+		f.Seek(6, io.SeekStart)
+		f.Write([]byte("mimic"))
+		f.Truncate(8)
+		f.Close()
+		if b, _ := ReadFile(fsys, name); string(b) != "hello mi" {
+			t.Errorf("Expected 'hello mi' got '%s'", b)
+		}
+
+		if _, err := fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600); !os.IsExist(err) {
+			t.Errorf("Expected an exists error creating an existing file exclusively, got %v", err)
+		}
+		if _, err := fsys.Open(filepath.Join(root, "missing.txt")); !os.IsNotExist(err) {
+			t.Errorf("Expected a not exist error opening a missing file, got %v", err)
+		}
+		if _, err := fsys.Create(filepath.Join(root, "missing", "test.txt")); !os.IsNotExist(err) {
+			t.Errorf("Expected a not exist error creating a file in a missing directory, got %v", err)
+		}
+
+		modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		fsys.Chmod(name, 0600)
+		fsys.Chtimes(name, modtime, modtime)
+		info, err := fsys.Stat(name)
+		if err != nil || info.Mode() != 0600 || !info.ModTime().Equal(modtime) || info.Size() != 8 {
+			t.Errorf("Expected mode 0600, %v and size 8, got %v", modtime, info)
+		}
+
+		tmp, err := TempFile(fsys, root, ".test.txt.")
+		if err != nil || !strings.HasPrefix(filepath.Base(tmp.Name()), ".test.txt.") {
+			t.Fatalf("Error creating a temporary file: %v", err)
+		}
+		tmp.Close()
+		if err := fsys.Rename(tmp.Name(), name); err != nil {
+			t.Errorf("Error renaming over a file: %v", err)
+		}
+		if b, _ := ReadFile(fsys, name); len(b) != 0 {
+			t.Errorf("Expected the file to be replaced, got '%s'", b)
+		}
+	})
+}
+
+func TestDirs(t *testing.T) {
+	forEachFS(t, func(t *testing.T, fsys FS, root string) {
+		dir := filepath.Join(root, "a", "b")
+		if err := MkdirAll(fsys, dir, 0755); err != nil {
+			t.Fatalf("Error creating directories: %v", err)
+		}
+		WriteFile(fsys, filepath.Join(dir, "z.txt"), []byte("z"), 0644)
+		WriteFile(fsys, filepath.Join(dir, "y.txt"), []byte("y"), 0644)
+		if err := fsys.Mkdir(dir, 0755); !os.IsExist(err) {
+			t.Errorf("Expected an exists error making an existing directory, got %v", err)
+		}
+
+		infos, err := fsys.ReadDir(dir)
+		if err != nil || len(infos) != 2 || infos[0].Name() != "y.txt" {
+			t.Errorf("Expected y.txt and z.txt got %v (%v)", infos, err)
+		}
+		if err := fsys.Remove(filepath.Join(root, "a")); err == nil {
+			t.Errorf("Expected an error removing a directory that isn't empty.")
+		}
+
+		moved := filepath.Join(root, "c")
+		if err := fsys.Rename(filepath.Join(root, "a"), moved); err != nil {
+			t.Fatalf("Error renaming directory: %v", err)
+		}
+		var walked []string
+		Walk(fsys, moved, func(path string, info os.FileInfo, err error) error {
+			rel, _ := filepath.Rel(moved, path)
+			walked = append(walked, rel)
+			return err
+		})
+		if strings.Join(walked, ",") != ".,b,b/y.txt,b/z.txt" {
+			t.Errorf("Expected the whole tree to be moved and walked, got %v", walked)
+		}
+
+		if err := RemoveAll(fsys, moved); err != nil {
+			t.Errorf("Error removing tree: %v", err)
+		}
+		if _, err := fsys.Lstat(moved); !os.IsNotExist(err) {
+			t.Errorf("Expected the tree to be removed, got %v", err)
+		}
+	})
+}
+
+func TestSymlinks(t *testing.T) {
+	forEachFS(t, func(t *testing.T, fsys FS, root string) {
+		dir := filepath.Join(root, "dir")
+		MkdirAll(fsys, dir, 0755)
+		WriteFile(fsys, filepath.Join(dir, "test.txt"), []byte("test"), 0644)
+		link := filepath.Join(root, "link")
+		if err := fsys.Symlink("dir", link); err != nil {
+			t.Fatalf("Error creating symlink: %v", err)
+		}
+
+		if target, err := fsys.Readlink(link); err != nil || target != "dir" {
+			t.Errorf("Expected the link to point at 'dir' got '%v' (%v)", target, err)
+		}
+		if info, _ := fsys.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("Expected Lstat to return the link, got %v", info.Mode())
+		}
+		if info, _ := fsys.Stat(link); !info.IsDir() {
+			t.Errorf("Expected Stat to follow the link, got %v", info.Mode())
+		}
+		if b, _ := ReadFile(fsys, filepath.Join(link, "test.txt")); string(b) != "test" {
+			t.Errorf("Expected to read through the link, got '%s'", b)
+		}
+
+		resolved, err := EvalSymlinks(fsys, filepath.Join(link, "test.txt"))
+		real, _ := EvalSymlinks(fsys, filepath.Join(dir, "test.txt"))
+		if err != nil || resolved != real {
+			t.Errorf("Expected '%v' got '%v' (%v)", real, resolved, err)
+		}
+
+		loop := filepath.Join(root, "loop")
+		fsys.Symlink("loop", loop)
+		if _, err := EvalSymlinks(fsys, loop); err == nil {
+			t.Errorf("Expected an error resolving a symlink loop.")
+		}
+		if _, err := fsys.Stat(loop); err == nil {
+			t.Errorf("Expected an error following a symlink loop.")
+		}
+	})
+}
+
+func TestMemAbs(t *testing.T) {
+	mem := NewMem()
+	WriteFile(mem, "test.txt", []byte("test"), 0644)
+	if b, err := ReadFile(mem, "/test.txt"); err != nil || string(b) != "test" {
+		t.Errorf("Expected relative paths to be relative to the root, got '%s' (%v)", b, err)
+	}
+	if abs, _ := Abs(mem, "sub/../test.txt"); abs != "/test.txt" {
+		t.Errorf("Expected '/test.txt' got '%v'", abs)
+	}
+}
+
+func TestMeta(t *testing.T) {
+	forEachFS(t, func(t *testing.T, fsys FS, root string) {
+		name := filepath.Join(root, "test.txt")
+		WriteFile(fsys, name, []byte("test"), 0644)
+
+		info, _ := fsys.Stat(name)
+		if uid, gid, ok := Owner(info); ok {
+			if err := Lchown(fsys, name, uid, gid); err != nil {
+				t.Errorf("Error changing the owner to the one it already has: %v", err)
+			}
+		}
+
+		err := Setxattr(fsys, name, "user.mimic", []byte("test"))
+		if IsUnsupported(err) {
+			t.Skipf("The file system has no extended attributes: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("Error setting extended attribute: %v", err)
+		}
+		if attrs, err := Listxattr(fsys, name); err != nil || !strings.Contains(strings.Join(attrs, " "), "user.mimic") {
+			t.Errorf("Expected the attribute to be listed got %v (%v)", attrs, err)
+		}
+		if value, err := Getxattr(fsys, name, "user.mimic"); err != nil || string(value) != "test" {
+			t.Errorf("Expected 'test' got '%s' (%v)", value, err)
+		}
+		if _, err := Getxattr(fsys, name, "user.missing"); err == nil {
+			t.Errorf("Expected an error getting an attribute that isn't set.")
+		}
+	})
+
+	mem := NewMem()
+	WriteFile(mem, "test.txt", []byte("test"), 0644)
+	if err := Lchown(mem, "test.txt", 1000, 100); err != nil {
+		t.Fatalf("Error changing owner: %v", err)
+	}
+	info, _ := mem.Stat("test.txt")
+	if uid, gid, ok := Owner(info); !ok || uid != 1000 || gid != 100 {
+		t.Errorf("Expected the owner to be 1000:100 got %v:%v (%v)", uid, gid, ok)
+	}
+	plain := struct{ FS }{mem}
+	if err := Lchown(plain, "test.txt", 0, 0); !IsUnsupported(err) {
+		t.Errorf("Expected a file system without owners to be unsupported got %v", err)
+	}
+	if _, err := Listxattr(plain, "test.txt"); !IsUnsupported(err) {
+		t.Errorf("Expected a file system without extended attributes to be unsupported got %v", err)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	forEachFS(t, func(t *testing.T, fsys FS, root string) {
+		name, link := filepath.Join(root, "test.txt"), filepath.Join(root, "link.txt")
+		WriteFile(fsys, name, []byte("test"), 0644)
+
+		info, _ := fsys.Lstat(name)
+		id, nlink, ok := Links(info)
+		if !ok {
+			t.Skip("The file system doesn't tell hard links apart.")
+		}
+		if nlink != 1 {
+			t.Errorf("Expected 1 link got %v", nlink)
+		}
+		if err := Link(fsys, name, link); err != nil {
+			t.Fatalf("Error linking: %v", err)
+		}
+		if err := Link(fsys, name, link); !os.IsExist(err) {
+			t.Errorf("Expected an error linking over an existing file got %v", err)
+		}
+		if err := Link(fsys, root, filepath.Join(root, "dir")); err == nil {
+			t.Errorf("Expected an error linking a directory.")
+		}
+		WriteFile(fsys, link, []byte("changed"), 0644)
+		if b, _ := ReadFile(fsys, name); string(b) != "changed" {
+			t.Errorf("Expected a write through the link to change the file got '%s'", b)
+		}
+		info, _ = fsys.Lstat(link)
+		if other, nlink, _ := Links(info); other != id || nlink != 2 {
+			t.Errorf("Expected the link to be the same file with 2 links got %v, %v", other, nlink)
+		}
+
+		// renaming a link over another link to the same file leaves both
+		if err := fsys.Rename(link, name); err != nil {
+			t.Fatalf("Error renaming: %v", err)
+		}
+		if _, err := fsys.Lstat(link); err != nil {
+			t.Errorf("Expected the link to be left in place got %v", err)
+		}
+		tmp, err := TempLink(fsys, name, root, ".link")
+		if err != nil || !strings.HasPrefix(filepath.Base(tmp), ".link") {
+			t.Errorf("Expected a temporary link got '%v' (%v)", tmp, err)
+		}
+		fsys.Remove(tmp)
+
+		fsys.Remove(link)
+		info, _ = fsys.Lstat(name)
+		if _, nlink, _ := Links(info); nlink != 1 {
+			t.Errorf("Expected 1 link after removing the other got %v", nlink)
+		}
+	})
+
+	plain := struct{ FS }{NewMem()}
+	if err := Link(plain, "a", "b"); !IsUnsupported(err) {
+		t.Errorf("Expected a file system without hard links to be unsupported got %v", err)
+	}
+}
+
+func TestExtents(t *testing.T) {
+	forEachFS(t, func(t *testing.T, fsys FS, root string) {
+		f, err := fsys.Create(filepath.Join(root, "sparse"))
+		if err != nil {
+			t.Fatalf("Error creating file: %v", err)
+		}
+		defer f.Close()
+		f.Seek(1<<20, io.SeekStart)
+		f.Write([]byte("data"))
+		f.Truncate(4 << 20)
+
+		extents := Extents(f, 4<<20)
+		if len(extents) == 0 || extents[0].Off > 1<<20 {
+			t.Fatalf("Expected the data to be found got %v", extents)
+		}
+		last := extents[len(extents)-1]
+		if len(extents) == 1 && last.Off == 0 && last.Len == 4<<20 {
+			t.Skip("The file system doesn't find holes.")
+		}
+		if last.Off+last.Len > 2<<20 {
+			t.Errorf("Expected the hole at the end to be left out got %v", extents)
+		}
+		if extents := Extents(f, 0); len(extents) != 0 {
+			t.Errorf("Expected no data in nothing got %v", extents)
+		}
+	})
+
+	mem := NewMem()
+	src, _ := mem.Create("src")
+	dst, _ := mem.Create("dst")
+	if err := Clone(dst, src); !IsUnsupported(err) {
+		t.Errorf("Expected cloning files that aren't from the OS to be unsupported got %v", err)
+	}
+}